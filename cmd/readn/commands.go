@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/thang-qt/Readn/src/storage"
+)
+
+type command struct {
+	usage       string
+	description string
+	run         func(db string, args []string) error
+}
+
+var commands = map[string]command{
+	"backup": {
+		usage:       "backup <file>",
+		description: "write a consistent snapshot of the database to the file (safe while the server runs)",
+		run:         cmdBackup,
+	},
+	"restore": {
+		usage:       "restore <file>",
+		description: "replace the database with the backup file (stop the server first)",
+		run:         cmdRestore,
+	},
+	"db": {
+		usage:       "db check|vacuum|reindex-search|stats",
+		description: "database maintenance: integrity & foreign key checks, compaction, search index rebuild, size report",
+		run:         cmdDB,
+	},
+	"feeds": {
+		usage:       "feeds [-user <name>] add <url> [-folder <path>] | list [-json] | rm <id|url>...",
+		description: "manage the feeds of the user (the first one by default); folder paths are titles separated by `/`",
+		run:         cmdFeeds,
+	},
+	"folders": {
+		usage:       "folders [-user <name>] add <path> | list [-json] | rm <id|path>...",
+		description: "manage the folders of the user",
+		run:         cmdFolders,
+	},
+	"opml": {
+		usage:       "opml [-user <name>] import <file|-> | export [file]",
+		description: "import or export the subscriptions of the user",
+		run:         cmdOPML,
+	},
+	"refresh": {
+		usage:       "refresh",
+		description: "fetch all feeds once and exit (e.g. for cron)",
+		run:         cmdRefresh,
+	},
+	"users": {
+		usage:       "users list [-json] | disable-totp <username>",
+		description: "list users or turn off two-factor authentication for a locked out user",
+		run:         cmdUsers,
+	},
+}
+
+var commandOrder = []string{"feeds", "folders", "opml", "refresh", "users", "backup", "restore", "db"}
+
+func printCommands(out io.Writer) {
+	fmt.Fprintln(out, "\nCommands:")
+	for _, name := range commandOrder {
+		cmd := commands[name]
+		fmt.Fprintf(out, "  %s\n    \t%s\n", cmd.usage, cmd.description)
+	}
+}
+
+func runCommand(db string, args []string) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	return cmd.run(db, args[1:])
+}
+
+func cmdBackup(db string, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: backup <file>")
+	}
+	store, err := storage.New(db)
+	if err != nil {
+		return err
+	}
+	if err := store.Backup(args[0]); err != nil {
+		return err
+	}
+	slog.Info("database saved", "path", args[0])
+	return nil
+}
+
+func cmdRestore(db string, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: restore <file>")
+	}
+	if err := storage.Restore(args[0], db); err != nil {
+		return err
+	}
+	slog.Info("database restored", "from", args[0], "previous", db+".bak")
+	return nil
+}
+
+func cmdDB(db string, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: db check|vacuum|reindex-search|stats")
+	}
+	store, err := storage.New(db)
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "check":
+		problems, err := store.Check()
+		if err != nil {
+			return err
+		}
+		for _, problem := range problems {
+			fmt.Println(problem)
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("found %d problems", len(problems))
+		}
+		fmt.Println("ok")
+	case "vacuum":
+		if err := store.Vacuum(); err != nil {
+			return err
+		}
+		slog.Info("database compacted")
+	case "reindex-search":
+		if err := store.ReindexSearch(); err != nil {
+			return err
+		}
+		slog.Info("search index rebuilt")
+	case "stats":
+		stats, err := store.Stats(10)
+		if err != nil {
+			return err
+		}
+		printStats(os.Stdout, stats)
+	default:
+		return fmt.Errorf("unknown db command %q", args[0])
+	}
+	return nil
+}
+
+func printStats(out io.Writer, stats *storage.DBStats) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "file size\t%s\n", formatBytes(stats.FileSize))
+	fmt.Fprintf(w, "free space\t%s\n", formatBytes(stats.FreeSize))
+
+	fmt.Fprintln(w, "\nTABLE\tROWS")
+	for _, table := range stats.Tables {
+		fmt.Fprintf(w, "%s\t%d\n", table.Name, table.Rows)
+	}
+
+	fmt.Fprintln(w, "\nFEED\tITEMS\tSIZE")
+	for _, feed := range stats.Feeds {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", feed.Title, feed.Items, formatBytes(feed.Bytes))
+	}
+
+	fmt.Fprintln(w, "\nITEM\tFEED\tSIZE")
+	for _, item := range stats.LargestItems {
+		fmt.Fprintf(w, "%d %s\t%s\t%s\n", item.ItemId, item.Title, item.FeedTitle, formatBytes(item.Bytes))
+	}
+	w.Flush()
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Config file in a restricted key = value format, which is valid TOML
+// but takes neither arrays, inline tables, dotted or quoted keys nor
+// multi-line strings; these are rejected with an error:
+//
+//	# server options, named after the flags
+//	addr = "0.0.0.0:7070"
+//	auth-file = "/etc/readn/auth"
+//
+//	# settings stored on the first start, editable in the UI afterwards
+//	[settings]
+//	refresh_rate = 30
+//
+//	# settings enforced on every start, read-only in the UI
+//	[locked_settings]
+//	ai_api_url = "https://example.com/v1/chat/completions"
+//
+// Flags and YARR_* environment variables take precedence over the file.
+type config struct {
+	options        map[string]string
+	settings       map[string]interface{}
+	lockedSettings map[string]interface{}
+}
+
+func loadConfig(path string) (*config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseConfig(f)
+}
+
+func parseConfig(r io.Reader) (*config, error) {
+	cfg := &config{
+		options:        make(map[string]string),
+		settings:       make(map[string]interface{}),
+		lockedSettings: make(map[string]interface{}),
+	}
+	section := ""
+	scanner := bufio.NewScanner(r)
+	for num := 1; scanner.Scan(); num++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[[") {
+			return nil, fmt.Errorf("line %d: arrays of tables are not supported", num)
+		}
+		if strings.HasPrefix(line, "[") {
+			section = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, "["), "]"))
+			if !strings.HasSuffix(line, "]") || (section != "settings" && section != "locked_settings") {
+				return nil, fmt.Errorf("line %d: unknown section %s", num, line)
+			}
+			continue
+		}
+		key, raw, found := strings.Cut(line, "=")
+		if !found {
+			return nil, fmt.Errorf("line %d: expected `key = value`", num)
+		}
+		key = strings.TrimSpace(key)
+		if strings.ContainsAny(key, `"'`) {
+			return nil, fmt.Errorf("line %d: quoted keys are not supported", num)
+		}
+		if strings.Contains(key, ".") {
+			return nil, fmt.Errorf("line %d: dotted keys are not supported", num)
+		}
+		val, err := parseConfigValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", num, err)
+		}
+		switch section {
+		case "":
+			cfg.options[normalizeOptName(key)] = fmt.Sprint(val)
+		case "settings":
+			cfg.settings[key] = val
+		case "locked_settings":
+			cfg.lockedSettings[key] = val
+		}
+	}
+	return cfg, scanner.Err()
+}
+
+func parseConfigValue(raw string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(raw, `"""`) || strings.HasPrefix(raw, "'''"):
+		return nil, fmt.Errorf("multi-line strings are not supported")
+	case strings.HasPrefix(raw, "["):
+		return nil, fmt.Errorf("arrays are not supported")
+	case strings.HasPrefix(raw, "{"):
+		return nil, fmt.Errorf("inline tables are not supported")
+	}
+	if strings.HasPrefix(raw, `"`) || strings.HasPrefix(raw, `'`) {
+		quote := raw[0]
+		end := 1
+		for ; end < len(raw) && raw[end] != quote; end++ {
+			if quote == '"' && raw[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(raw) {
+			return nil, fmt.Errorf("unterminated string %s", raw)
+		}
+		if rest := strings.TrimSpace(raw[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return nil, fmt.Errorf("unexpected %s after string", rest)
+		}
+		if quote == '\'' {
+			return raw[1:end], nil
+		}
+		return strconv.Unquote(raw[:end+1])
+	}
+
+	raw, _, _ = strings.Cut(raw, "#")
+	raw = strings.TrimSpace(raw)
+	switch raw {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if num, err := strconv.ParseInt(strings.ReplaceAll(raw, "_", ""), 10, 64); err == nil {
+		return num, nil
+	}
+	if num, err := strconv.ParseFloat(strings.ReplaceAll(raw, "_", ""), 64); err == nil {
+		return num, nil
+	}
+	return nil, fmt.Errorf("invalid value %s", raw)
+}
+
+// Option names in the config file match the flags, e.g. `auth-file`
+// for `--auth-file` & YARR_AUTHFILE, `backup-dir` for YARR_BACKUP_DIR.
+func normalizeOptName(name string) string {
+	name = strings.ToLower(strings.TrimPrefix(name, "YARR_"))
+	return strings.NewReplacer("-", "", "_", "").Replace(name)
+}
+
+// Finds the config file path given with the `--config` flag
+// before the flags get parsed, since it provides their defaults.
+func configPath(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, val, hasVal := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != "config" {
+			continue
+		}
+		if hasVal {
+			return val
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return os.Getenv("YARR_CONFIG")
+}
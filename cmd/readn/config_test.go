@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := parseConfig(strings.NewReader(`
+# comment
+addr = "0.0.0.0:7070"  # trailing comment
+auth-file = '/etc/readn/auth'
+backup-keep = 3
+
+[settings]
+refresh_rate = 30
+theme_name = "with \"quotes\" # and hash"
+
+[locked_settings]
+ai_enable_chat = false
+theme_size = 1.5
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantOptions := map[string]string{
+		"addr":       "0.0.0.0:7070",
+		"authfile":   "/etc/readn/auth",
+		"backupkeep": "3",
+	}
+	if !reflect.DeepEqual(cfg.options, wantOptions) {
+		t.Errorf("invalid options\nwant: %#v\nhave: %#v", wantOptions, cfg.options)
+	}
+	wantSettings := map[string]interface{}{
+		"refresh_rate": int64(30),
+		"theme_name":   `with "quotes" # and hash`,
+	}
+	if !reflect.DeepEqual(cfg.settings, wantSettings) {
+		t.Errorf("invalid settings\nwant: %#v\nhave: %#v", wantSettings, cfg.settings)
+	}
+	wantLocked := map[string]interface{}{
+		"ai_enable_chat": false,
+		"theme_size":     1.5,
+	}
+	if !reflect.DeepEqual(cfg.lockedSettings, wantLocked) {
+		t.Errorf("invalid locked settings\nwant: %#v\nhave: %#v", wantLocked, cfg.lockedSettings)
+	}
+
+	for _, invalid := range []string{"addr", "addr = 0.0.0.0", `addr = "unterminated`, "[server]"} {
+		if _, err := parseConfig(strings.NewReader(invalid)); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestParseConfigUnsupported(t *testing.T) {
+	for input, want := range map[string]string{
+		`addr = ["0.0.0.0:7070"]`:                "line 1: arrays are not supported",
+		`addr = { host = "0.0.0.0" }`:            "line 1: inline tables are not supported",
+		"[settings]\ntheme.name = \"night\"":     "line 2: dotted keys are not supported",
+		`"auth-file" = "/etc/readn/auth"`:        "line 1: quoted keys are not supported",
+		"ai_personality = \"\"\"\nterse\n\"\"\"": "line 1: multi-line strings are not supported",
+		"[[settings]]":                           "line 1: arrays of tables are not supported",
+	} {
+		_, err := parseConfig(strings.NewReader(input))
+		if err == nil || err.Error() != want {
+			t.Errorf("expected %q for %q, got %v", want, input, err)
+		}
+	}
+}
+
+func TestConfigPath(t *testing.T) {
+	for _, args := range [][]string{
+		{"-config", "readn.toml"},
+		{"-db", "x.db", "--config=readn.toml", "refresh"},
+	} {
+		if have := configPath(args); have != "readn.toml" {
+			t.Errorf("invalid config path in %v: %q", args, have)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/thang-qt/Readn/src/server"
+	"github.com/thang-qt/Readn/src/server/opml"
+	"github.com/thang-qt/Readn/src/storage"
+	"github.com/thang-qt/Readn/src/worker"
+)
+
+// Parses flags interleaved with positional arguments
+// (`feeds add <url> -folder News` as well as `feeds add -folder News <url>`).
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	positional := make([]string, 0)
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func printJSON(out io.Writer, v interface{}) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// Opens the database on behalf of the user named by the `-user` flag
+// preceding the subcommand, the default user otherwise.
+// Returns the args following the flag.
+func openUserStore(db, command string, args []string) (*storage.Storage, []string, error) {
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	username := fs.String("user", "", "`username` of the user to act on behalf of")
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	store, err := storage.New(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	if *username != "" {
+		user := store.GetUserByName(*username)
+		if user == nil {
+			return nil, nil, fmt.Errorf("user %s not found", *username)
+		}
+		store = store.ForUser(user.Id)
+	}
+	return store, fs.Args(), nil
+}
+
+func findFolder(store *storage.Storage, path string) *storage.Folder {
+	if id, err := strconv.ParseInt(path, 10, 64); err == nil {
+		return store.GetFolder(id)
+	}
+	folders := store.ListFolders()
+	for id, folderPath := range storage.FolderPaths(folders) {
+		if folderPath == strings.Trim(path, "/") {
+			return store.GetFolder(id)
+		}
+	}
+	return nil
+}
+
+// Creates the missing folders along the path.
+func createFolder(store *storage.Storage, path string) *storage.Folder {
+	var folder *storage.Folder
+	for _, title := range strings.Split(strings.Trim(path, "/"), "/") {
+		var parentId *int64
+		if folder != nil {
+			parentId = &folder.Id
+		}
+		if folder = store.CreateFolder(title, parentId); folder == nil {
+			return nil
+		}
+	}
+	return folder
+}
+
+func findFeed(store *storage.Storage, idOrLink string) *storage.Feed {
+	if id, err := strconv.ParseInt(idOrLink, 10, 64); err == nil {
+		return store.GetFeed(id)
+	}
+	for _, feed := range store.ListFeeds() {
+		if feed.FeedLink == idOrLink {
+			return &feed
+		}
+	}
+	return nil
+}
+
+func cmdFeeds(db string, args []string) error {
+	usage := fmt.Errorf("usage: feeds [-user <name>] add <url> [-folder <path>] | list [-json] | rm <id|url>...")
+	if len(args) == 0 {
+		return usage
+	}
+	store, args, err := openUserStore(db, "feeds", args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return usage
+	}
+
+	fs := flag.NewFlagSet("feeds "+args[0], flag.ContinueOnError)
+	switch args[0] {
+	case "add":
+		folderPath := fs.String("folder", "", "`path` of the folder to put the feed in (created if missing)")
+		args, err := parseArgs(fs, args[1:])
+		if err != nil {
+			return err
+		}
+		if len(args) != 1 {
+			return usage
+		}
+		var folderId *int64
+		if *folderPath != "" {
+			folder := createFolder(store, *folderPath)
+			if folder == nil {
+				return fmt.Errorf("failed to create folder %s", *folderPath)
+			}
+			folderId = &folder.Id
+		}
+
+		result, err := worker.DiscoverFeed(args[0])
+		switch {
+		case err != nil:
+			return fmt.Errorf("failed to discover feed for %s: %s", args[0], err)
+		case len(result.Sources) > 0:
+			for _, source := range result.Sources {
+				fmt.Printf("%s\t%s\n", source.Url, source.Title)
+			}
+			return fmt.Errorf("found multiple feeds, add one of the above")
+		case result.Feed == nil:
+			return fmt.Errorf("no feeds found at %s", args[0])
+		}
+		feed := worker.NewWorker(store).CreateFeed(store.UserId(), result, folderId)
+		if feed == nil {
+			return fmt.Errorf("failed to add feed %s", result.FeedLink)
+		}
+		slog.Info("added feed", "feed_id", feed.Id, "title", feed.Title, "feed_url", feed.FeedLink)
+	case "list":
+		asJSON := fs.Bool("json", false, "print as json")
+		if _, err := parseArgs(fs, args[1:]); err != nil {
+			return err
+		}
+		feeds := store.ListFeeds()
+		if *asJSON {
+			return printJSON(os.Stdout, feeds)
+		}
+		paths := storage.FolderPaths(store.ListFolders())
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTITLE\tFOLDER\tURL")
+		for _, feed := range feeds {
+			folder := ""
+			if feed.FolderId != nil {
+				folder = paths[*feed.FolderId]
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", feed.Id, feed.Title, folder, feed.FeedLink)
+		}
+		w.Flush()
+	case "rm":
+		if len(args) < 2 {
+			return usage
+		}
+		for _, arg := range args[1:] {
+			feed := findFeed(store, arg)
+			if feed == nil || !store.DeleteFeed(feed.Id) {
+				return fmt.Errorf("feed %s not found", arg)
+			}
+			slog.Info("removed feed", "feed_id", feed.Id, "title", feed.Title)
+		}
+	default:
+		return usage
+	}
+	return nil
+}
+
+func cmdFolders(db string, args []string) error {
+	usage := fmt.Errorf("usage: folders [-user <name>] add <path> | list [-json] | rm <id|path>...")
+	if len(args) == 0 {
+		return usage
+	}
+	store, args, err := openUserStore(db, "folders", args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return usage
+	}
+
+	fs := flag.NewFlagSet("folders "+args[0], flag.ContinueOnError)
+	switch args[0] {
+	case "add":
+		if len(args) != 2 {
+			return usage
+		}
+		folder := createFolder(store, args[1])
+		if folder == nil {
+			return fmt.Errorf("failed to create folder %s", args[1])
+		}
+		slog.Info("added folder", "folder_id", folder.Id, "path", args[1])
+	case "list":
+		asJSON := fs.Bool("json", false, "print as json")
+		if _, err := parseArgs(fs, args[1:]); err != nil {
+			return err
+		}
+		folders := store.ListFolders()
+		if *asJSON {
+			return printJSON(os.Stdout, folders)
+		}
+		paths := storage.FolderPaths(folders)
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tPATH")
+		for _, folder := range folders {
+			fmt.Fprintf(w, "%d\t%s\n", folder.Id, paths[folder.Id])
+		}
+		w.Flush()
+	case "rm":
+		if len(args) < 2 {
+			return usage
+		}
+		for _, arg := range args[1:] {
+			folder := findFolder(store, arg)
+			if folder == nil || !store.DeleteFolder(folder.Id) {
+				return fmt.Errorf("folder %s not found", arg)
+			}
+			slog.Info("removed folder", "folder_id", folder.Id, "title", folder.Title)
+		}
+	default:
+		return usage
+	}
+	return nil
+}
+
+func cmdOPML(db string, args []string) error {
+	usage := fmt.Errorf("usage: opml [-user <name>] import <file|-> | export [file]")
+	if len(args) == 0 {
+		return usage
+	}
+	store, args, err := openUserStore(db, "opml", args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return usage
+	}
+
+	switch args[0] {
+	case "import":
+		if len(args) != 2 {
+			return usage
+		}
+		in := os.Stdin
+		if args[1] != "-" {
+			if in, err = os.Open(args[1]); err != nil {
+				return err
+			}
+			defer in.Close()
+		}
+		doc, err := opml.Parse(in)
+		if err != nil {
+			return err
+		}
+		server.ImportOPML(store, doc)
+		slog.Info("imported feeds", "count", len(doc.AllFeeds()))
+	case "export":
+		if len(args) > 2 {
+			return usage
+		}
+		out := os.Stdout
+		if len(args) == 2 && args[1] != "-" {
+			if out, err = os.Create(args[1]); err != nil {
+				return err
+			}
+			defer out.Close()
+		}
+		doc := server.ExportOPML(store)
+		if _, err := out.Write([]byte(doc.OPML())); err != nil {
+			return err
+		}
+	default:
+		return usage
+	}
+	return nil
+}
+
+func cmdRefresh(db string, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: refresh")
+	}
+	store, err := storage.New(db)
+	if err != nil {
+		return err
+	}
+	w := worker.NewWorker(store)
+	w.RefreshFeedsAndWait()
+	for _, feed := range store.ListFeedsMissingIcons() {
+		w.FindFeedFavicon(feed)
+	}
+	store.DeleteOldItems()
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/thang-qt/Readn/src/storage"
+)
+
+func TestParseArgs(t *testing.T) {
+	for _, args := range [][]string{
+		{"http://example.com", "-folder", "Tech/Blogs"},
+		{"-folder", "Tech/Blogs", "http://example.com"},
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		folder := fs.String("folder", "", "")
+		have, err := parseArgs(fs, args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"http://example.com"}; !reflect.DeepEqual(have, want) || *folder != "Tech/Blogs" {
+			t.Errorf("invalid parse of %v: %v, folder %q", args, have, *folder)
+		}
+	}
+}
+
+func TestOpenUserStore(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "storage.db")
+	store, err := storage.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := store.CreateUser("alice", "", false)
+	store.ForUser(alice.Id).CreateFolder("Tech", nil)
+
+	store, args, err := openUserStore(db, "folders", []string{"-user", "alice", "list", "-json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"list", "-json"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("invalid args: %v", args)
+	}
+	if store.UserId() != alice.Id || len(store.ListFolders()) != 1 {
+		t.Errorf("expected the storage of the user, got %d", store.UserId())
+	}
+
+	if store, _, _ := openUserStore(db, "folders", []string{"list"}); store.UserId() != storage.DefaultUserId {
+		t.Errorf("expected the default user, got %d", store.UserId())
+	}
+	if _, _, err := openUserStore(db, "folders", []string{"-user", "bob", "list"}); err == nil {
+		t.Error("expected an error for an unknown user")
+	}
+}
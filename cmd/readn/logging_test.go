@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogHandler(t *testing.T) {
+	var out bytes.Buffer
+	handler, err := newLogHandler(&out, "warn", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(handler)
+	logger.Info("skipped")
+	logger.Warn("failed to refresh feed", "feed_id", 1)
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("expected a single json record, got %q", out.String())
+	}
+	source, _ := record["source"].(string)
+	if record["msg"] != "failed to refresh feed" || record["feed_id"] != 1.0 || !strings.HasPrefix(source, "logging_test.go:") {
+		t.Errorf("unexpected record %v", record)
+	}
+
+	if _, err := newLogHandler(&out, "verbose", "text"); err == nil {
+		t.Error("expected invalid level error")
+	}
+	if _, err := newLogHandler(&out, "info", "xml"); err == nil {
+		t.Error("expected invalid format error")
+	}
+}
@@ -6,12 +6,16 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/thang-qt/Readn/src/platform"
 	"github.com/thang-qt/Readn/src/server"
+	serverauth "github.com/thang-qt/Readn/src/server/auth"
 	"github.com/thang-qt/Readn/src/storage"
 	"github.com/thang-qt/Readn/src/worker"
 )
@@ -21,12 +25,18 @@ var GitHash string = "unknown"
 
 var OptList = make([]string, 0)
 
+// Options from the config file, see `config`.
+var configOptions = make(map[string]string)
+
 func opt(envVar, defaultValue string) string {
 	OptList = append(OptList, envVar)
 	value := os.Getenv(envVar)
 	if value != "" {
 		return value
 	}
+	if value, ok := configOptions[normalizeOptName(envVar)]; ok {
+		return value
+	}
 	return defaultValue
 }
 
@@ -45,96 +55,160 @@ func parseAuthfile(authfile io.Reader) (username, password string, err error) {
 	return username, password, nil
 }
 
+func readAuthfile(path string) (username, password string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+	return parseAuthfile(f)
+}
+
 func main() {
 	platform.FixConsoleIfNeeded()
 
-	var addr, db, authfile, auth, certfile, keyfile, basepath, logfile string
+	var addr, db, authfile, auth, certfile, keyfile, basepath, logfile, loglevel, logformat string
+	var backupdir, backupinterval, backupkeep, configfile, metricstoken string
+	var authheader, trustedproxies string
 	var ver, open bool
 
+	cfg := &config{}
+	cfgPath := configPath(os.Args[1:])
+	if cfgPath != "" {
+		var err error
+		if cfg, err = loadConfig(cfgPath); err != nil {
+			log.Fatal("Failed to load config file: ", err)
+		}
+		configOptions = cfg.options
+	}
+
 	flag.CommandLine.SetOutput(os.Stdout)
 
 	flag.Usage = func() {
 		out := flag.CommandLine.Output()
 		fmt.Fprintf(out, "Usage of %s:\n", os.Args[0])
+		fmt.Fprintf(out, "  %s [flags] [command]\n\nFlags:\n", os.Args[0])
 		flag.PrintDefaults()
+		printCommands(out)
 		fmt.Fprintln(out, "\nThe environmental variables, if present, will be used to provide\nthe default values for the params above:")
 		fmt.Fprintln(out, " ", strings.Join(OptList, ", "))
 	}
 
+	flag.StringVar(&configfile, "config", opt("YARR_CONFIG", ""), "`path` to config file (see doc/config.md)")
 	flag.StringVar(&addr, "addr", opt("YARR_ADDR", "127.0.0.1:7070"), "address to run server on")
 	flag.StringVar(&basepath, "base", opt("YARR_BASE", ""), "base path of the service url")
 	flag.StringVar(&authfile, "auth-file", opt("YARR_AUTHFILE", ""), "`path` to a file containing username:password. Takes precedence over --auth (or YARR_AUTH)")
 	flag.StringVar(&auth, "auth", opt("YARR_AUTH", ""), "string with username and password in the format `username:password`")
+	flag.StringVar(&authheader, "auth-header", opt("YARR_AUTH_HEADER", ""), "`header` with the username set by a reverse proxy doing the auth (e.g. Remote-User)")
+	flag.StringVar(&trustedproxies, "trusted-proxies", opt("YARR_TRUSTED_PROXIES", ""), "comma-separated `cidrs` of the reverse proxies trusted with the auth & X-Forwarded-For headers")
 	flag.StringVar(&certfile, "cert-file", opt("YARR_CERTFILE", ""), "`path` to cert file for https")
 	flag.StringVar(&keyfile, "key-file", opt("YARR_KEYFILE", ""), "`path` to key file for https")
 	flag.StringVar(&db, "db", opt("YARR_DB", ""), "storage file `path`")
 	flag.StringVar(&logfile, "log-file", opt("YARR_LOGFILE", ""), "`path` to log file to use instead of stdout")
+	flag.StringVar(&loglevel, "log-level", opt("YARR_LOG_LEVEL", "info"), "minimal log `level`: debug, info, warn or error")
+	flag.StringVar(&logformat, "log-format", opt("YARR_LOG_FORMAT", "text"), "log `format`: text or json")
+	flag.StringVar(&backupdir, "backup-dir", opt("YARR_BACKUP_DIR", ""), "`path` to a directory for scheduled database backups")
+	flag.StringVar(&backupinterval, "backup-interval", opt("YARR_BACKUP_INTERVAL", "24h"), "`duration` between scheduled backups")
+	flag.StringVar(&backupkeep, "backup-keep", opt("YARR_BACKUP_KEEP", "7"), "`number` of scheduled backups to keep (0 keeps all)")
+	flag.StringVar(&metricstoken, "metrics-token", opt("YARR_METRICS_TOKEN", ""), "bearer `token` for /metrics, to scrape it without logging in")
 	flag.BoolVar(&ver, "version", false, "print application version")
 	flag.BoolVar(&open, "open", false, "open the server in browser")
 	flag.Parse()
 
+	for name := range configOptions {
+		known := false
+		for _, envVar := range OptList {
+			known = known || normalizeOptName(envVar) == name
+		}
+		if !known {
+			log.Fatalf("Unknown option %s in config file", name)
+		}
+	}
+
 	if ver {
 		fmt.Printf("v%s (%s)\n", Version, GitHash)
 		return
 	}
 
-	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+	logout := io.Writer(os.Stdout)
 	if logfile != "" {
 		file, err := os.OpenFile(logfile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
 		if err != nil {
 			log.Fatal("Failed to setup log file: ", err)
 		}
 		defer file.Close()
-		log.SetOutput(file)
-	} else {
-		log.SetOutput(os.Stdout)
+		logout = file
+	} else if flag.NArg() > 0 {
+		// keep stdout clean for the command output
+		logout = os.Stderr
 	}
+	loghandler, err := newLogHandler(logout, loglevel, logformat)
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(slog.New(loghandler))
 
 	if open && strings.HasPrefix(addr, "unix:") {
-		log.Fatal("Cannot open ", addr, " in browser")
+		fatal("cannot open unix socket in browser", "addr", addr)
 	}
 
 	if db == "" {
 		configPath, err := os.UserConfigDir()
 		if err != nil {
-			log.Fatal("Failed to get config dir: ", err)
+			fatal("failed to get config dir", "err", err)
 		}
 
 		storagePath := filepath.Join(configPath, "yarr")
 		if err := os.MkdirAll(storagePath, 0755); err != nil {
-			log.Fatal("Failed to create app config dir: ", err)
+			fatal("failed to create app config dir", "err", err)
 		}
 		db = filepath.Join(storagePath, "storage.db")
 	}
 
-	log.Printf("using db file %s", db)
+	slog.Info("using db file", "path", db)
+
+	if flag.NArg() > 0 {
+		if err := runCommand(db, flag.Args()); err != nil {
+			fatal(err.Error())
+		}
+		return
+	}
 
 	var username, password string
-	var err error
 	if authfile != "" {
-		f, err := os.Open(authfile)
+		username, password, err = readAuthfile(authfile)
 		if err != nil {
-			log.Fatal("Failed to open auth file: ", err)
-		}
-		defer f.Close()
-		username, password, err = parseAuthfile(f)
-		if err != nil {
-			log.Fatal("Failed to parse auth file: ", err)
+			fatal("failed to read auth file", "err", err)
 		}
 	} else if auth != "" {
 		username, password, err = parseAuthfile(strings.NewReader(auth))
 		if err != nil {
-			log.Fatal("Failed to parse auth literal: ", err)
+			fatal("failed to parse auth literal", "err", err)
 		}
 	}
 
 	if (certfile != "" || keyfile != "") && (certfile == "" || keyfile == "") {
-		log.Fatalf("Both cert & key files are required")
+		fatal("both cert & key files are required")
+	}
+
+	proxies, err := serverauth.ParseTrustedProxies(trustedproxies)
+	if err != nil {
+		fatal("failed to parse trusted proxies", "err", err)
+	}
+	if authheader != "" && len(proxies) == 0 && !strings.HasPrefix(addr, "unix:") {
+		fatal("the auth header requires trusted proxies or a unix socket")
 	}
 
 	store, err := storage.New(db)
 	if err != nil {
-		log.Fatal("Failed to initialise database: ", err)
+		fatal("failed to initialise database", "err", err)
+	}
+
+	if err := store.SeedSettings(cfg.settings); err != nil {
+		fatal("failed to apply config settings", "err", err)
+	}
+	if err := store.LockSettings(cfg.lockedSettings); err != nil {
+		fatal("failed to apply config locked settings", "err", err)
 	}
 
 	worker.SetVersion(Version)
@@ -150,13 +224,45 @@ func main() {
 	}
 
 	if username != "" && password != "" {
-		srv.Username = username
-		srv.Password = password
+		srv.SetCredentials(username, password)
 	}
 
-	log.Printf("starting server at %s", srv.GetAddr())
+	srv.AuthHeader = authheader
+	srv.TrustedProxies = proxies
+	srv.MetricsToken = metricstoken
+
+	if backupdir != "" {
+		srv.BackupDir = backupdir
+		if srv.BackupInterval, err = time.ParseDuration(backupinterval); err != nil {
+			fatal("invalid backup interval", "err", err)
+		}
+		if srv.BackupKeep, err = strconv.Atoi(backupkeep); err != nil {
+			fatal("invalid number of backups to keep", "err", err)
+		}
+	}
+
+	slog.Info("starting server", "url", srv.GetAddr())
 	if open {
 		platform.Open(srv.GetAddr())
 	}
+	handleSignals(srv, func() {
+		if cfgPath != "" {
+			if cfg, err := loadConfig(cfgPath); err != nil {
+				slog.Error("failed to reload config file", "err", err)
+			} else if err := store.SeedSettings(cfg.settings); err != nil {
+				slog.Error("failed to apply config settings", "err", err)
+			} else if err := store.LockSettings(cfg.lockedSettings); err != nil {
+				slog.Error("failed to apply config locked settings", "err", err)
+			}
+		}
+		if authfile != "" {
+			if username, password, err := readAuthfile(authfile); err != nil {
+				slog.Error("failed to read auth file", "err", err)
+			} else {
+				srv.SetCredentials(username, password)
+			}
+		}
+		srv.ReloadSettings()
+	})
 	platform.Start(srv)
 }
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/thang-qt/Readn/src/server"
+)
+
+const shutdownTimeout = 30 * time.Second
+
+// Shuts the server down on SIGINT/SIGTERM and calls `reload` on SIGHUP.
+// Server options (address, paths, ...) are not reloaded, only
+// the settings from the config file and the credentials from the auth file.
+func handleSignals(srv *server.Server, reload func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGHUP {
+				slog.Info("reloading config")
+				reload()
+				continue
+			}
+			slog.Info("shutting down", "signal", sig.String())
+			// let a repeated signal kill the process
+			signal.Reset(syscall.SIGINT, syscall.SIGTERM)
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			srv.Shutdown(ctx)
+			cancel()
+			slog.Info("server stopped")
+			return
+		}
+	}()
+}
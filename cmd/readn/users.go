@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/thang-qt/Readn/src/storage"
+)
+
+func cmdUsers(db string, args []string) error {
+	usage := fmt.Errorf("usage: users list [-json] | disable-totp <username>")
+	if len(args) == 0 {
+		return usage
+	}
+	store, err := storage.New(db)
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("users "+args[0], flag.ContinueOnError)
+	switch args[0] {
+	case "list":
+		asJSON := fs.Bool("json", false, "print as json")
+		if _, err := parseArgs(fs, args[1:]); err != nil {
+			return err
+		}
+		users := store.ListUsers()
+		if *asJSON {
+			return printJSON(os.Stdout, users)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tUSERNAME\tADMIN\tDISABLED\t2FA")
+		for _, user := range users {
+			fmt.Fprintf(w, "%d\t%s\t%t\t%t\t%t\n", user.Id, user.Username, user.IsAdmin, user.Disabled, user.TOTPEnabled)
+		}
+		w.Flush()
+	case "disable-totp":
+		if len(args) != 2 {
+			return usage
+		}
+		user := store.GetUserByName(args[1])
+		if user == nil {
+			return fmt.Errorf("user %s not found", args[1])
+		}
+		if !store.DisableUserTOTP(user.Id) {
+			return fmt.Errorf("failed to disable two-factor authentication")
+		}
+		slog.Info("two-factor authentication disabled", "user_id", user.Id, "username", user.Username)
+	default:
+		return usage
+	}
+	return nil
+}
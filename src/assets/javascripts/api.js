@@ -6,6 +6,7 @@
     if (['post', 'put', 'delete'].indexOf(init.method) !== -1) {
       init['headers'] = init['headers'] || {}
       init['headers']['x-requested-by'] = 'yarr'
+      init['headers']['x-csrf-token'] = window.app.csrf_token
     }
     return fetch(resource, init)
   }
@@ -52,6 +53,12 @@
       list_errors: function() {
         return api('get', './api/feeds/errors').then(json)
       },
+      get_retention: function(id) {
+        return api('get', './api/feeds/' + id + '/retention').then(json)
+      },
+      update_retention: function(id, data) {
+        return api('put', './api/feeds/' + id + '/retention', data)
+      },
     },
     folders: {
       list: function() {
@@ -83,6 +90,56 @@
       mark_read: function(query) {
         return api('put', './api/items' + param(query))
       },
+      list_labels: function(id) {
+        return api('get', './api/items/' + id + '/labels').then(json)
+      },
+      update_labels: function(id, label_ids) {
+        return api('put', './api/items/' + id + '/labels', {label_ids: label_ids}).then(json)
+      },
+      get_note: function(id) {
+        return api('get', './api/items/' + id + '/notes').then(function(res) {
+          return res.status === 404 ? null : res.json()
+        })
+      },
+      update_note: function(id, text) {
+        return api('put', './api/items/' + id + '/notes', {text: text})
+      },
+      list_highlights: function(id) {
+        return api('get', './api/items/' + id + '/highlights').then(json)
+      },
+      create_highlight: function(id, data) {
+        return api('post', './api/items/' + id + '/highlights', data).then(json)
+      },
+    },
+    highlights: {
+      list: function() {
+        return api('get', './api/highlights').then(json)
+      },
+      update: function(id, data) {
+        return api('put', './api/highlights/' + id, data)
+      },
+      delete: function(id) {
+        return api('delete', './api/highlights/' + id)
+      },
+    },
+    labels: {
+      list: function() {
+        return api('get', './api/labels').then(json)
+      },
+      create: function(data) {
+        return api('post', './api/labels', data).then(json)
+      },
+      update: function(id, data) {
+        return api('put', './api/labels/' + id, data)
+      },
+      delete: function(id) {
+        return api('delete', './api/labels/' + id)
+      },
+    },
+    saved: {
+      create: function(url) {
+        return api('post', './api/saved', {url: url}).then(json)
+      },
     },
     settings: {
       get: function() {
@@ -92,6 +149,11 @@
         return api('put', './api/settings', data)
       },
     },
+    retention: {
+      report: function() {
+        return api('get', './api/retention').then(json)
+      },
+    },
     status: function() {
       return api('get', './api/status').then(json)
     },
@@ -104,6 +166,28 @@
     logout: function() {
       return api('post', './logout')
     },
+    account: {
+      get: function() {
+        return api('get', './api/account').then(json)
+      },
+      totp_setup: function() {
+        return api('post', './api/account/totp').then(json)
+      },
+      totp_confirm: function(code) {
+        return api('post', './api/account/totp/confirm', {code: code})
+      },
+      totp_disable: function(code) {
+        return api('delete', './api/account/totp', {code: code})
+      },
+    },
+    sessions: {
+      list: function() {
+        return api('get', './api/account/sessions').then(json)
+      },
+      delete_others: function() {
+        return api('delete', './api/account/sessions').then(json)
+      },
+    },
     crawl: function(url) {
       return api('get', './page?url=' + encodeURIComponent(url)).then(json)
     },
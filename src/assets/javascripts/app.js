@@ -268,6 +268,12 @@ var vm = new Vue({
         'size': s.theme_size,
       },
       'refreshRate': s.refresh_rate,
+      'retention': {
+        'keepDays': s.retention_keep_days,
+        'keepSize': s.retention_keep_size,
+        'contentDays': s.retention_content_days,
+      },
+      'retentionReport': null,
       'aiKey': s.ai_api_key || '',
       'aiURL': s.ai_api_url || 'https://api.aimlapi.com/v1/chat/completions',
       'aiModel': s.ai_model || 'gpt-4o-mini',
@@ -280,6 +286,8 @@ var vm = new Vue({
       'aiEnableChat': s.ai_enable_chat !== undefined ? s.ai_enable_chat : true,
       'aiEnableTextActions': s.ai_enable_text_actions !== undefined ? s.ai_enable_text_actions : true,
       'authenticated': app.authenticated,
+      'isAdmin': app.is_admin,
+      'lockedSettings': app.locked_settings || [],
       'feed_errors': {},
       'sidebarCollapsed': s.sidebar_collapsed,
       'chatPanelVisible': false,
@@ -297,13 +305,43 @@ var vm = new Vue({
           folders[feed.folder_id].push(feed)
         return folders
       }, {})
-      var folders = this.folders.slice().map(function(folder) {
-        folder.feeds = feedsByFolders[folder.id]
-        return folder
-      })
+      var foldersByParent = this.folders.reduce(function(acc, folder) {
+        var key = folder.parent_id || null
+        if (!acc[key]) acc[key] = []
+        acc[key].push(folder)
+        return acc
+      }, {})
+      // depth-first order, so that subfolders follow their parents
+      var folders = []
+      var walk = function(parentId, depth, hidden) {
+        (foldersByParent[parentId] || []).forEach(function(folder) {
+          folder.feeds = feedsByFolders[folder.id]
+          folder.depth = depth
+          folder.hidden = hidden
+          folders.push(folder)
+          walk(folder.id, depth + 1, hidden || !folder.is_expanded)
+        })
+      }
+      walk(null, 0, false)
       folders.push({id: null, feeds: feedsByFolders[null]})
       return folders
     },
+    folderAncestors: function() {
+      var foldersById = this.foldersById
+      return this.folders.reduce(function(acc, folder) {
+        var ancestors = [], parent = foldersById[folder.parent_id]
+        while (parent && ancestors.indexOf(parent.id) === -1) {
+          ancestors.push(parent.id)
+          parent = foldersById[parent.parent_id]
+        }
+        acc[folder.id] = ancestors
+        return acc
+      }, {})
+    },
+    bookmarklet: function() {
+      var target = new URL('./save?url=', window.location.href).href
+      return "javascript:location.href='" + target + "'+encodeURIComponent(location.href)"
+    },
     feedsById: function() {
       return this.feeds.reduce(function(acc, f) { acc[f.id] = f; return acc }, {})
     },
@@ -638,6 +676,24 @@ var vm = new Vue({
         }.bind(this))
       }
     },
+    saveURL: function() {
+      var url = prompt('Enter article URL:')
+      if (!url) return
+      api.saved.create(url).then(function(result) {
+        if (result.status !== 'success') return alert('Failed to save the article.')
+        vm.refreshFeeds()
+        vm.refreshStats()
+        vm.feedSelected = 'feed:' + result.item.feed_id
+      })
+    },
+    moveFolder: function(folder, parent) {
+      var parent_id = parent ? parent.id : null
+      api.folders.update(folder.id, {parent_id: parent_id}).then(function(res) {
+        if (!res.ok) return alert('Folder cannot be moved there.')
+        folder.parent_id = parent_id
+        vm.refreshStats()
+      })
+    },
     deleteFolder: function(folder) {
       if (confirm('Are you sure you want to delete ' + folder.title + '?')) {
         api.folders.delete(folder.id).then(function() {
@@ -655,6 +711,12 @@ var vm = new Vue({
         })
       }
     },
+    toggleFeedSpark: function(feed) {
+      var isSpark = !feed.is_spark
+      api.feeds.update(feed.id, {is_spark: isSpark}).then(function() {
+        feed.is_spark = isSpark
+      })
+    },
     renameFeed: function(feed) {
       var newTitle = prompt('Enter new title', feed.title)
       if (newTitle) {
@@ -663,6 +725,17 @@ var vm = new Vue({
         })
       }
     },
+    updateFeedRetention: function(feed) {
+      api.feeds.get_retention(feed.id).then(function(policy) {
+        var days = prompt(
+          'Keep items for how many days? (0 keeps forever, empty uses the global setting)',
+          policy.keep_days === null ? '' : policy.keep_days,
+        )
+        if (days === null) return
+        policy.keep_days = days.trim() === '' ? null : Math.max(0, parseInt(days) || 0)
+        api.feeds.update_retention(feed.id, policy)
+      })
+    },
     deleteFeed: function(feed) {
       if (confirm('Are you sure you want to delete ' + feed.title + '?')) {
         api.feeds.delete(feed.id).then(function() {
@@ -737,6 +810,37 @@ var vm = new Vue({
         document.location.reload()
       })
     },
+    toggleTOTP: function() {
+      api.account.get().then(function(user) {
+        if (user.totp_enabled) {
+          var code = prompt('Enter a code from your authenticator app (or a recovery code) to turn off two-factor authentication:')
+          if (!code) return
+          api.account.totp_disable(code).then(function(res) {
+            alert(res.ok ? 'Two-factor authentication is off.' : 'Invalid code.')
+          })
+          return
+        }
+        api.account.totp_setup().then(function(setup) {
+          var code = prompt(
+            'Add this key to your authenticator app:\n\n' + setup.secret +
+            '\n\n(or import ' + setup.uri + ')\n\nthen enter the code it shows:'
+          )
+          if (!code) return
+          api.account.totp_confirm(code).then(function(res) {
+            if (!res.ok) return alert('Invalid code, two-factor authentication is still off.')
+            res.json().then(function(result) {
+              alert('Two-factor authentication is on. Keep these recovery codes safe, each works once:\n\n' + result.recovery_codes.join('\n'))
+            })
+          })
+        })
+      })
+    },
+    logoutOthers: function() {
+      if (!confirm('Log out all the other sessions?')) return
+      api.sessions.delete_others().then(function(result) {
+        alert('Logged out ' + result.deleted + ' session(s).')
+      })
+    },
     toggleReadability: function() {
       if (this.itemSelectedReadability) {
         this.itemSelectedReadability = null
@@ -1034,6 +1138,27 @@ var vm = new Vue({
       this.aiSummarizePrompt = value
       api.settings.update({ai_summarize_prompt: value})
     },
+    isLocked: function(key) {
+      return this.lockedSettings.indexOf(key) != -1
+    },
+    updateRetention: function(key, value) {
+      value = Math.max(0, parseInt(value) || 0)
+      this.retention[key] = value
+      this.retentionReport = null
+      var data = {}
+      data['retention_' + key.replace(/[A-Z]/g, function(c) { return '_' + c.toLowerCase() })] = value
+      api.settings.update(data)
+    },
+    previewRetention: function() {
+      api.retention.report().then(function(report) {
+        vm.retentionReport = report
+      })
+    },
+    formatBytes: function(bytes) {
+      if (bytes < 1024) return bytes + ' B'
+      if (bytes < 1024 * 1024) return (bytes / 1024).toFixed(1) + ' KB'
+      return (bytes / 1024 / 1024).toFixed(1) + ' MB'
+    },
     updateAIEnableArticleSummary: function(value) {
       this.aiEnableArticleSummary = value
       api.settings.update({ai_enable_article_summary: value})
@@ -1230,10 +1355,13 @@ var vm = new Vue({
 
         var n = vm.feedStats[feed.id][filter] || 0
 
-        if (!statsFolders[feed.folder_id]) statsFolders[feed.folder_id] = 0
+        var folderIds = [feed.folder_id].concat(this.folderAncestors[feed.folder_id] || [])
+        for (var j = 0; j < folderIds.length; j++) {
+          if (!statsFolders[folderIds[j]]) statsFolders[folderIds[j]] = 0
+          statsFolders[folderIds[j]] += n
+        }
 
         statsFeeds[feed.id] = n
-        statsFolders[feed.folder_id] += n
         statsTotal += n
       }
 
@@ -1308,6 +1436,7 @@ var vm = new Vue({
     initTextSelection: function() {
       var self = this
       var selectedText = ''
+      var selectedRange = null
       var tooltipJustShown = false
       
       // Handle text selection
@@ -1331,6 +1460,7 @@ var vm = new Vue({
         }
         
         selectedText = selection.toString().trim()
+        selectedRange = range.cloneRange()
         if (selectedText.length < 3) {
           tooltip.classList.remove('show')
           return
@@ -1349,7 +1479,9 @@ var vm = new Vue({
       document.addEventListener('click', function(e) {
         if (e.target.closest('.ai-tooltip-option')) {
           var action = e.target.closest('.ai-tooltip-option').getAttribute('data-action')
-          if (selectedText) {
+          if (selectedText && action === 'highlight') {
+            self.createHighlight(selectedRange, selectedText)
+          } else if (selectedText) {
             self.handleAIAction(action, selectedText)
             var tooltip = document.getElementById('ai-tooltip')
             if (tooltip) tooltip.classList.remove('show')
@@ -1407,6 +1539,28 @@ var vm = new Vue({
       })
     },
     
+    createHighlight: function(range, text) {
+      var item = this.itemSelectedDetails
+      var content = document.querySelector('.content')
+      if (!item || !range || !content) return
+
+      // surrounding text anchors the quote if it occurs more than once
+      var before = document.createRange()
+      before.setStart(content, 0)
+      before.setEnd(range.startContainer, range.startOffset)
+      var after = document.createRange()
+      after.setStart(range.endContainer, range.endOffset)
+      after.setEnd(content, content.childNodes.length)
+
+      var comment = prompt('Add a comment (optional):', '')
+      if (comment === null) return
+      api.items.create_highlight(item.id, {
+        text: text,
+        prefix: before.toString().slice(-32),
+        suffix: after.toString().slice(0, 32),
+        comment: comment,
+      })
+    },
     handleAIAction: function(action, text) {
       // Set the context text
       this.chatContext = text
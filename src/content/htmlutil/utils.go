@@ -75,3 +75,13 @@ func TruncateText(input string, size int) string {
 	}
 	return input
 }
+
+// Estimated number of minutes it takes to read the content,
+// based on the average reading speed of 200 words per minute.
+func ReadingTime(content string) int {
+	words := len(strings.Fields(ExtractText(content)))
+	if words == 0 {
+		return 0
+	}
+	return (words + 199) / 200
+}
@@ -1,6 +1,9 @@
 package htmlutil
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestExtractText(t *testing.T) {
 	testcases := [][2]string{
@@ -42,3 +45,22 @@ func TestTruncateText(t *testing.T) {
 		t.Errorf("\nsize: %d\nwant: %#v\nhave: %#v", size, want, have)
 	}
 }
+
+func TestReadingTime(t *testing.T) {
+	testcases := []struct {
+		words int
+		want  int
+	}{
+		{0, 0},
+		{1, 1},
+		{200, 1},
+		{201, 2},
+		{1000, 5},
+	}
+	for _, testcase := range testcases {
+		content := "<p>" + strings.Repeat("word ", testcase.words) + "</p>"
+		if have := ReadingTime(content); have != testcase.want {
+			t.Errorf("\nwords: %d\nwant: %d\nhave: %d", testcase.words, testcase.want, have)
+		}
+	}
+}
@@ -108,3 +108,64 @@ func FindIcons(body string, base string) []string {
 	}
 	return icons
 }
+
+func metaContent(doc *html.Node, names ...string) string {
+	isMeta := func(n *html.Node) bool {
+		return n.Type == html.ElementNode && n.Data == "meta"
+	}
+	metas := htmlutil.FindNodes(doc, isMeta)
+	for _, name := range names {
+		for _, node := range metas {
+			key := htmlutil.Attr(node, "property")
+			if key == "" {
+				key = htmlutil.Attr(node, "name")
+			}
+			if strings.EqualFold(key, name) {
+				if content := strings.TrimSpace(htmlutil.Attr(node, "content")); content != "" {
+					return content
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func FindTitle(body string) string {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	// css: meta[property=og:title]
+	if title := metaContent(doc, "og:title", "twitter:title"); title != "" {
+		return title
+	}
+	// css: head > title
+	for _, node := range htmlutil.Query(doc, "title") {
+		if title := strings.TrimSpace(htmlutil.Text(node)); title != "" {
+			return title
+		}
+	}
+	return ""
+}
+
+func FindImage(body string, base string) string {
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	// css: meta[property=og:image]
+	if image := metaContent(doc, "og:image", "og:image:url", "twitter:image"); image != "" {
+		return htmlutil.AbsoluteUrl(image, base)
+	}
+	// css: link[rel=image_src]
+	isLink := func(n *html.Node) bool {
+		return n.Type == html.ElementNode && n.Data == "link" &&
+			strings.EqualFold(htmlutil.Attr(n, "rel"), "image_src")
+	}
+	if nodes := htmlutil.FindNodes(doc, isLink); len(nodes) > 0 {
+		return htmlutil.AbsoluteUrl(htmlutil.Attr(nodes[0], "href"), base)
+	}
+	return ""
+}
@@ -95,3 +95,31 @@ func TestFindIcons(t *testing.T) {
 		t.Fatal("invalid result")
 	}
 }
+
+func TestFindTitleAndImage(t *testing.T) {
+	body := `
+		<!DOCTYPE html>
+		<html lang="en">
+		<head>
+			<title>Page title | Site</title>
+			<meta property="og:title" content="Article title">
+			<meta property="og:image" content="/images/lead.jpg">
+		</head>
+		<body></body>
+		</html>
+	`
+	if have := FindTitle(body); have != "Article title" {
+		t.Errorf("invalid title: %#v", have)
+	}
+	if have := FindImage(body, base); have != base+"/images/lead.jpg" {
+		t.Errorf("invalid image: %#v", have)
+	}
+
+	body = `<html><head><title> Page title </title></head><body><p>text</p></body></html>`
+	if have := FindTitle(body); have != "Page title" {
+		t.Errorf("invalid fallback title: %#v", have)
+	}
+	if have := FindImage(body, base); have != "" {
+		t.Errorf("expected no image, got %#v", have)
+	}
+}
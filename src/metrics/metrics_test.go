@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCounter(t *testing.T) {
+	c := &Counter{vec{name: "test_total", help: "Test.", labels: []string{"status"}, series: make(map[string]*series)}}
+	c.Inc("200")
+	c.Inc("200")
+	c.Add(3, "error")
+
+	var out bytes.Buffer
+	c.write(&out)
+	want := strings.Join([]string{
+		"# HELP test_total Test.",
+		"# TYPE test_total counter",
+		`test_total{status="200"} 2`,
+		`test_total{status="error"} 3`,
+		"",
+	}, "\n")
+	if out.String() != want {
+		t.Fatalf("invalid output:\n%s", out.String())
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := &Histogram{
+		vec:     vec{name: "test_seconds", help: "Test.", series: make(map[string]*series)},
+		buckets: []float64{0.5, 1},
+	}
+	h.Observe(0.2)
+	h.Observe(0.7)
+	h.Observe(3)
+
+	var out bytes.Buffer
+	h.write(&out)
+	want := strings.Join([]string{
+		"# HELP test_seconds Test.",
+		"# TYPE test_seconds histogram",
+		`test_seconds_bucket{le="0.5"} 1`,
+		`test_seconds_bucket{le="1"} 2`,
+		`test_seconds_bucket{le="+Inf"} 3`,
+		"test_seconds_sum 3.9",
+		"test_seconds_count 3",
+		"",
+	}, "\n")
+	if out.String() != want {
+		t.Fatalf("invalid output:\n%s", out.String())
+	}
+}
@@ -10,22 +10,24 @@ import (
 )
 
 type atomFeed struct {
-	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
-	ID      string      `xml:"id"`
-	Title   atomText    `xml:"title"`
-	Links   atomLinks   `xml:"link"`
-	Entries []atomEntry `xml:"entry"`
+	XMLName xml.Name     `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string       `xml:"id"`
+	Title   atomText     `xml:"title"`
+	Links   atomLinks    `xml:"link"`
+	Authors []atomPerson `xml:"author"`
+	Entries []atomEntry  `xml:"entry"`
 }
 
 type atomEntry struct {
-	ID        string    `xml:"id"`
-	Title     atomText  `xml:"title"`
-	Summary   atomText  `xml:"summary"`
-	Published string    `xml:"published"`
-	Updated   string    `xml:"updated"`
-	Links     atomLinks `xml:"link"`
-	Content   atomText  `xml:"http://www.w3.org/2005/Atom content"`
-	OrigLink  string    `xml:"http://rssnamespace.org/feedburner/ext/1.0 origLink"`
+	ID        string       `xml:"id"`
+	Title     atomText     `xml:"title"`
+	Summary   atomText     `xml:"summary"`
+	Published string       `xml:"published"`
+	Updated   string       `xml:"updated"`
+	Links     atomLinks    `xml:"link"`
+	Content   atomText     `xml:"http://www.w3.org/2005/Atom content"`
+	OrigLink  string       `xml:"http://rssnamespace.org/feedburner/ext/1.0 origLink"`
+	Authors   []atomPerson `xml:"author"`
 
 	media
 }
@@ -43,6 +45,22 @@ type atomLink struct {
 
 type atomLinks []atomLink
 
+type atomPerson struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email"`
+}
+
+// The names of the people, the entries without authors inherit those of the feed.
+func atomAuthors(people []atomPerson) string {
+	names := make([]string, 0, len(people))
+	for _, p := range people {
+		if name := strings.TrimSpace(firstNonEmpty(p.Name, p.Email)); name != "" {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
 func (a *atomText) Text() string {
 	if a.Type == "html" {
 		return htmlutil.ExtractText(a.Data)
@@ -97,6 +115,7 @@ func ParseAtom(r io.Reader) (*Feed, error) {
 			Date:       dateParse(firstNonEmpty(srcitem.Published, srcitem.Updated)),
 			URL:        link,
 			Title:      srcitem.Title.Text(),
+			Author:     firstNonEmpty(atomAuthors(srcitem.Authors), atomAuthors(srcfeed.Authors)),
 			Content:    firstNonEmpty(srcitem.Content.String(), srcitem.Summary.String(), srcitem.firstMediaDescription()),
 			MediaLinks: mediaLinks,
 		})
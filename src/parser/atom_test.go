@@ -44,6 +44,7 @@ func TestAtom(t *testing.T) {
 				Date:    time.Unix(1071340202, 0).UTC(),
 				URL:     "http://example.org/2003/12/13/atom03.html",
 				Title:   "Atom-Powered Robots Run Amok",
+				Author:  "John Doe",
 				Content: `<div xmlns="http://www.w3.org/1999/xhtml"><p>This is the entry content.</p></div>`,
 			},
 		},
@@ -234,3 +235,25 @@ func TestAtomDoesntEscapeHTMLTags(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestAtomFeedAuthor(t *testing.T) {
+	feed, _ := Parse(strings.NewReader(`
+		<?xml version="1.0" encoding="utf-8"?>
+		<feed xmlns="http://www.w3.org/2005/Atom">
+			<author><name>Jane Roe</name></author>
+			<entry><id>1</id></entry>
+			<entry>
+				<id>2</id>
+				<author><name>John Doe</name></author>
+				<author><email>jd@example.com</email></author>
+			</entry>
+		</feed>
+	`))
+	have := []string{feed.Items[0].Author, feed.Items[1].Author}
+	want := []string{"Jane Roe", "John Doe, jd@example.com"}
+	if !reflect.DeepEqual(want, have) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.FailNow()
+	}
+}
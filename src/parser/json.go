@@ -4,13 +4,16 @@ package parser
 import (
 	"encoding/json"
 	"io"
+	"strings"
 )
 
 type jsonFeed struct {
-	Version string     `json:"version"`
-	Title   string     `json:"title"`
-	SiteURL string     `json:"home_page_url"`
-	Items   []jsonItem `json:"items"`
+	Version string       `json:"version"`
+	Title   string       `json:"title"`
+	SiteURL string       `json:"home_page_url"`
+	Items   []jsonItem   `json:"items"`
+	Author  *jsonAuthor  `json:"author"`
+	Authors []jsonAuthor `json:"authors"`
 }
 
 type jsonItem struct {
@@ -23,6 +26,12 @@ type jsonItem struct {
 	DatePublished string           `json:"date_published"`
 	DateModified  string           `json:"date_modified"`
 	Attachments   []jsonAttachment `json:"attachments"`
+	Author        *jsonAuthor      `json:"author"`
+	Authors       []jsonAuthor     `json:"authors"`
+}
+
+type jsonAuthor struct {
+	Name string `json:"name"`
 }
 
 type jsonAttachment struct {
@@ -50,8 +59,23 @@ func ParseJSON(data io.Reader) (*Feed, error) {
 			Date:    dateParse(firstNonEmpty(srcitem.DatePublished, srcitem.DateModified)),
 			URL:     srcitem.URL,
 			Title:   srcitem.Title,
+			Author:  firstNonEmpty(jsonAuthors(srcitem.Author, srcitem.Authors), jsonAuthors(srcfeed.Author, srcfeed.Authors)),
 			Content: firstNonEmpty(srcitem.HTML, srcitem.Text, srcitem.Summary),
 		})
 	}
 	return dstfeed, nil
 }
+
+// Version 1.1 lists the authors, 1.0 had a single one.
+func jsonAuthors(author *jsonAuthor, authors []jsonAuthor) string {
+	if len(authors) == 0 && author != nil {
+		authors = []jsonAuthor{*author}
+	}
+	names := make([]string, 0, len(authors))
+	for _, a := range authors {
+		if name := strings.TrimSpace(a.Name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
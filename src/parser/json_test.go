@@ -40,3 +40,23 @@ func TestJSONFeed(t *testing.T) {
 		t.Fatal("invalid json")
 	}
 }
+
+func TestJSONFeedAuthors(t *testing.T) {
+	feed, _ := Parse(strings.NewReader(`{
+		"version": "https://jsonfeed.org/version/1.1",
+		"title": "My Example Feed",
+		"authors": [{"name": "Jane Roe"}],
+		"items": [
+			{"id": "1", "authors": [{"name": "John Doe"}, {"name": "Max Mustermann"}]},
+			{"id": "2", "author": {"name": "Old Style"}},
+			{"id": "3"}
+		]
+	}`))
+	have := []string{feed.Items[0].Author, feed.Items[1].Author, feed.Items[2].Author}
+	want := []string{"John Doe, Max Mustermann", "Old Style", "Jane Roe"}
+	if !reflect.DeepEqual(want, have) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.FailNow()
+	}
+}
@@ -6,6 +6,7 @@ package parser
 import (
 	"encoding/xml"
 	"io"
+	"strings"
 )
 
 type rdfFeed struct {
@@ -20,8 +21,9 @@ type rdfItem struct {
 	Link        string `xml:"link"`
 	Description string `xml:"description"`
 
-	DublinCoreDate string `xml:"http://purl.org/dc/elements/1.1/ date"`
-	ContentEncoded string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	DublinCoreDate    string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	DublinCoreCreator string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	ContentEncoded    string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
 }
 
 func ParseRDF(r io.Reader) (*Feed, error) {
@@ -42,6 +44,7 @@ func ParseRDF(r io.Reader) (*Feed, error) {
 			URL:     srcitem.Link,
 			Date:    dateParse(srcitem.DublinCoreDate),
 			Title:   srcitem.Title,
+			Author:  strings.TrimSpace(srcitem.DublinCoreCreator),
 			Content: firstNonEmpty(srcitem.ContentEncoded, srcitem.Description),
 		})
 	}
@@ -286,3 +286,29 @@ func TestRSSMultipleMedia(t *testing.T) {
 		t.Fatal("invalid rss")
 	}
 }
+
+func TestRSSAuthor(t *testing.T) {
+	feed, _ := Parse(strings.NewReader(`
+		<?xml version="1.0" encoding="UTF-8"?>
+		<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">
+		<channel>
+			<item>
+				<title>one</title>
+				<author>jd@example.com (John Doe)</author>
+			</item>
+			<item>
+				<title>two</title>
+				<itunes:author>Podcaster</itunes:author>
+				<dc:creator> Jane Roe </dc:creator>
+			</item>
+		</channel>
+		</rss>
+	`))
+	have := []string{feed.Items[0].Author, feed.Items[1].Author}
+	want := []string{"jd@example.com (John Doe)", "Jane Roe"}
+	if !reflect.DeepEqual(want, have) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.FailNow()
+	}
+}
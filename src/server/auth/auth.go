@@ -1,52 +1,122 @@
 package auth
 
 import (
-	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"crypto/subtle"
+	"encoding/base64"
 	"encoding/hex"
 	"net/http"
-	"strings"
 	"time"
+
+	"github.com/thang-qt/Readn/src/storage"
 )
 
-func IsAuthenticated(req *http.Request, username, password string) bool {
-	cookie, _ := req.Cookie("auth")
-	if cookie == nil {
-		return false
+const (
+	cookieName = "auth"
+	// sessions expire after a week of inactivity
+	sessionTTL = time.Hour * 24 * 7
+	// how often the activity of a session is recorded
+	sessionTouchInterval = time.Minute
+	maxUserAgentLength   = 256
+)
+
+// Returns a random token suitable for sessions & API keys.
+func NewToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
 	}
-	parts := strings.Split(cookie.Value, ":")
-	if len(parts) != 2 || !StringsEqual(parts[0], username) {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Tokens are only stored hashed, so that a leaked database
+// does not give access to the accounts.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Starts a new session for the user and sets the session cookie.
+func Authenticate(rw http.ResponseWriter, req *http.Request, db *storage.Storage, userId int64, basepath string) bool {
+	db.DeleteExpiredSessions()
+
+	userAgent := req.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	token := NewToken()
+	expires := time.Now().Add(sessionTTL)
+	if db.CreateSession(userId, HashToken(token), userAgent, expires) == nil {
 		return false
 	}
-	return StringsEqual(parts[1], secret(username, password))
+	setCookie(rw, req, token, expires, basepath)
+	return true
+}
+
+// Returns the active session the request was made with.
+func CurrentSession(req *http.Request, db *storage.Storage) *storage.Session {
+	cookie, _ := req.Cookie(cookieName)
+	if cookie == nil || cookie.Value == "" {
+		return nil
+	}
+	return db.GetSession(HashToken(cookie.Value))
 }
 
-func Authenticate(rw http.ResponseWriter, username, password, basepath string) {
+// Revokes the current session only and clears the session cookie.
+func Logout(rw http.ResponseWriter, req *http.Request, db *storage.Storage, basepath string) {
+	if session := CurrentSession(req, db); session != nil {
+		db.DeleteSession(session.UserId, session.Id)
+	}
 	http.SetCookie(rw, &http.Cookie{
-		Name:    "auth",
-		Value:   username + ":" + secret(username, password),
-		Expires: time.Now().Add(time.Hour * 24 * 7), // 1 week,
-		Path:    basepath,
+		Name:     cookieName,
+		Value:    "",
+		MaxAge:   -1,
+		Path:     cookiePath(basepath),
+		Secure:   isSecure(req),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
 	})
 }
 
-func Logout(rw http.ResponseWriter, basepath string) {
+// Extends the expiry of the session (and its cookie) on activity.
+// Done at most once per sessionTouchInterval to spare the writes.
+func touchSession(rw http.ResponseWriter, req *http.Request, db *storage.Storage, session *storage.Session, basepath string) {
+	if time.Since(session.LastSeen) < sessionTouchInterval {
+		return
+	}
+	cookie, _ := req.Cookie(cookieName)
+	expires := time.Now().Add(sessionTTL)
+	if db.TouchSession(session.Id, expires) {
+		setCookie(rw, req, cookie.Value, expires, basepath)
+	}
+}
+
+func setCookie(rw http.ResponseWriter, req *http.Request, token string, expires time.Time, basepath string) {
 	http.SetCookie(rw, &http.Cookie{
-		Name:   "auth",
-		Value:  "",
-		MaxAge: -1,
-		Path:   basepath,
+		Name:     cookieName,
+		Value:    token,
+		Expires:  expires,
+		Path:     cookiePath(basepath),
+		Secure:   isSecure(req),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
 	})
 }
 
-func StringsEqual(p1, p2 string) bool {
-	return subtle.ConstantTimeCompare([]byte(p1), []byte(p2)) == 1
+func cookiePath(basepath string) string {
+	if basepath == "" {
+		return "/"
+	}
+	return basepath
+}
+
+// The cookie is marked as secure when served over https,
+// directly or by a reverse proxy.
+func isSecure(req *http.Request) bool {
+	return req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https"
 }
 
-func secret(msg, key string) string {
-	mac := hmac.New(sha256.New, []byte(key))
-	mac.Write([]byte(msg))
-	src := mac.Sum(nil)
-	return hex.EncodeToString(src)
+func StringsEqual(p1, p2 string) bool {
+	return subtle.ConstantTimeCompare([]byte(p1), []byte(p2)) == 1
 }
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/thang-qt/Readn/src/server/router"
+)
+
+// Cookie carrying the CSRF secret of the visitors without a session
+// (no auth or reverse proxy auth). With a session, the secret is the
+// session token itself.
+const csrfCookieName = "csrf"
+
+const CSRFHeader = "X-CSRF-Token"
+
+// Field of the plain html forms carrying the token instead of the header.
+const CSRFFormField = "csrf_token"
+
+func csrfSeed(req *http.Request) string {
+	for _, name := range []string{cookieName, csrfCookieName} {
+		if cookie, _ := req.Cookie(name); cookie != nil && cookie.Value != "" {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+func csrfToken(seed string) string {
+	return HashToken("csrf:" + seed)
+}
+
+// Returns the token the page has to send back with the unsafe requests,
+// setting up the secret it's derived from if missing.
+func CSRFToken(rw http.ResponseWriter, req *http.Request, basepath string) string {
+	seed := csrfSeed(req)
+	if seed == "" {
+		seed = NewToken()
+		http.SetCookie(rw, &http.Cookie{
+			Name:     csrfCookieName,
+			Value:    seed,
+			Path:     cookiePath(basepath),
+			Secure:   isSecure(req),
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+	return csrfToken(seed)
+}
+
+// Checks that the state-changing request came from the app's own pages:
+// the origin must match the host & the token must match the secret.
+// Responds with 403 otherwise.
+func (m *Middleware) checkCSRF(c *router.Context, requireToken bool) bool {
+	req := c.Req
+	if !UnsafeMethod(req.Method) {
+		return true
+	}
+	valid := m.sameOrigin(req)
+	if valid && requireToken {
+		seed := csrfSeed(req)
+		token := req.Header.Get(CSRFHeader)
+		if token == "" {
+			token = req.PostFormValue(CSRFFormField)
+		}
+		valid = seed != "" && StringsEqual(token, csrfToken(seed))
+	}
+	if !valid {
+		slog.Debug("csrf check failed", "method", req.Method, "path", req.URL.Path, "origin", req.Header.Get("Origin"))
+		c.Out.WriteHeader(http.StatusForbidden)
+	}
+	return valid
+}
+
+// Compares the host of Origin (or Referer, if the former is missing)
+// with the one requested. Requests with neither rely on the token alone.
+func (m *Middleware) sameOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		origin = req.Header.Get("Referer")
+	}
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host := req.Host
+	if forwarded := req.Header.Get("X-Forwarded-Host"); forwarded != "" && m.Proxies.trusts(req) {
+		host, _, _ = strings.Cut(forwarded, ",")
+		host = strings.TrimSpace(host)
+	}
+	return strings.EqualFold(u.Host, host)
+}
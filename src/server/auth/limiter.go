@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// failed attempts allowed before the lockouts kick in
+	freeAttempts = 5
+	// the lockout doubles with every further failed attempt
+	minLockout = time.Second * 30
+	maxLockout = time.Hour
+	// failures are forgotten after this long without any
+	attemptsTTL = time.Hour * 24
+	// addresses & usernames tracked at most, the usernames being up
+	// to the clients; the least recent ones make room for the new
+	maxTracked = 10000
+)
+
+type limiterKey struct {
+	kind  string
+	value string
+}
+
+type attempts struct {
+	failures    int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// Client locked out because of failed login attempts.
+type Lockout struct {
+	// "ip" or "username"
+	Kind     string    `json:"kind"`
+	Value    string    `json:"value"`
+	Failures int       `json:"failures"`
+	Until    time.Time `json:"until"`
+}
+
+// Tracks the failed login attempts per client address & per username.
+// A nil Limiter lets all the attempts through.
+type Limiter struct {
+	mu         sync.Mutex
+	clients    map[limiterKey]*attempts
+	now        func() time.Time
+	maxTracked int
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{
+		clients:    make(map[limiterKey]*attempts),
+		now:        time.Now,
+		maxTracked: maxTracked,
+	}
+}
+
+func limiterKeys(ip, username string) []limiterKey {
+	keys := []limiterKey{{"ip", ip}}
+	if username != "" {
+		keys = append(keys, limiterKey{"username", username})
+	}
+	return keys
+}
+
+// Returns how long the client has to wait before trying again, if locked out.
+func (l *Limiter) Check(ip, username string) (time.Duration, bool) {
+	if l == nil {
+		return 0, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	var wait time.Duration
+	for _, key := range limiterKeys(ip, username) {
+		if a := l.clients[key]; a != nil && a.lockedUntil.After(now) {
+			wait = max(wait, a.lockedUntil.Sub(now))
+		}
+	}
+	return wait, wait == 0
+}
+
+func (l *Limiter) Fail(ip, username string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	for key, a := range l.clients {
+		if now.Sub(a.last) > attemptsTTL {
+			delete(l.clients, key)
+		}
+	}
+	for _, key := range limiterKeys(ip, username) {
+		a := l.clients[key]
+		if a == nil {
+			if len(l.clients) >= l.maxTracked {
+				l.evict(now)
+			}
+			a = &attempts{}
+			l.clients[key] = a
+		}
+		a.failures++
+		a.last = now
+		if excess := a.failures - freeAttempts; excess > 0 {
+			lockout := maxLockout
+			if excess <= 10 {
+				lockout = min(minLockout<<(excess-1), maxLockout)
+			}
+			a.lockedUntil = now.Add(lockout)
+		}
+	}
+}
+
+// Drops the entry failed the longest ago, sparing the lockouts
+// in effect unless there's nothing else to drop.
+func (l *Limiter) evict(now time.Time) {
+	var oldest *limiterKey
+	var oldestLocked bool
+	for key, a := range l.clients {
+		locked := a.lockedUntil.After(now)
+		if oldest == nil || (oldestLocked && !locked) ||
+			(oldestLocked == locked && a.last.Before(l.clients[*oldest].last)) {
+			oldest, oldestLocked = &key, locked
+		}
+	}
+	if oldest != nil {
+		delete(l.clients, *oldest)
+	}
+}
+
+// Logs the failed attempt in a format fit for fail2ban, e.g.:
+//
+//	level=WARN msg="authentication failed" client=192.0.2.1 username=alice via=login locked_out=false
+func LogFailure(ip, username, via string, lockedOut bool) {
+	slog.Warn("authentication failed", "client", ip, "username", username, "via", via, "locked_out", lockedOut)
+}
+
+func (l *Limiter) Succeed(ip, username string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range limiterKeys(ip, username) {
+		delete(l.clients, key)
+	}
+}
+
+// Returns the clients currently locked out.
+func (l *Limiter) Lockouts() []Lockout {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	list := make([]Lockout, 0)
+	for key, a := range l.clients {
+		if a.lockedUntil.After(now) {
+			list = append(list, Lockout{
+				Kind:     key.kind,
+				Value:    key.value,
+				Failures: a.failures,
+				Until:    a.lockedUntil,
+			})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Until.Before(list[j].Until)
+	})
+	return list
+}
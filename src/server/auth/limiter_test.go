@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewLimiter()
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < freeAttempts; i++ {
+		if _, ok := l.Check("192.0.2.1", "alice"); !ok {
+			t.Fatalf("expected attempt %d to be allowed", i+1)
+		}
+		l.Fail("192.0.2.1", "alice")
+	}
+	if _, ok := l.Check("192.0.2.1", "alice"); !ok {
+		t.Fatal("expected the free attempts not to lock out")
+	}
+	l.Fail("192.0.2.1", "alice")
+	if wait, ok := l.Check("192.0.2.2", "alice"); ok || wait != minLockout {
+		t.Fatalf("expected the username to be locked out for %s, got %s", minLockout, wait)
+	}
+	if _, ok := l.Check("192.0.2.1", "bob"); ok {
+		t.Fatal("expected the address to be locked out")
+	}
+	if _, ok := l.Check("192.0.2.2", "bob"); !ok {
+		t.Fatal("expected other clients to be allowed")
+	}
+
+	// the lockout doubles with each failure
+	now = now.Add(minLockout)
+	l.Fail("192.0.2.1", "alice")
+	if wait, _ := l.Check("192.0.2.1", ""); wait != 2*minLockout {
+		t.Fatalf("expected the lockout to double, got %s", wait)
+	}
+	if lockouts := l.Lockouts(); len(lockouts) != 2 || lockouts[0].Failures != 7 {
+		t.Fatalf("unexpected lockouts: %v", lockouts)
+	}
+
+	l.Succeed("192.0.2.1", "alice")
+	if _, ok := l.Check("192.0.2.1", "alice"); !ok {
+		t.Fatal("expected a success to reset the attempts")
+	}
+
+	var none *Limiter
+	none.Fail("192.0.2.1", "alice")
+	if _, ok := none.Check("192.0.2.1", "alice"); !ok {
+		t.Fatal("expected a nil limiter to allow everything")
+	}
+}
+
+func TestLimiterSize(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewLimiter()
+	l.now = func() time.Time { return now }
+	l.maxTracked = 100
+
+	for i := 0; i <= freeAttempts; i++ {
+		l.Fail("192.0.2.1", "alice")
+	}
+	// a flood of made-up usernames from all over
+	for i := 0; i < 1000; i++ {
+		now = now.Add(time.Millisecond)
+		l.Fail(fmt.Sprintf("198.51.%d.%d", i/256, i%256), fmt.Sprintf("user%d", i))
+	}
+	if len(l.clients) > l.maxTracked {
+		t.Errorf("expected at most %d entries, got %d", l.maxTracked, len(l.clients))
+	}
+	if _, ok := l.Check("192.0.2.2", "alice"); ok {
+		t.Error("expected the lockout to outlast the flood")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies := TrustedProxies{Prefixes: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+
+	tests := []struct {
+		remote, forwarded, want string
+	}{
+		{"192.0.2.1:1234", "", "192.0.2.1"},
+		{"192.0.2.1:1234", "198.51.100.1", "192.0.2.1"},
+		{"10.0.0.1:1234", "", "10.0.0.1"},
+		{"10.0.0.1:1234", "198.51.100.1", "198.51.100.1"},
+		{"10.0.0.1:1234", "203.0.113.9, 198.51.100.1, 10.0.0.2", "198.51.100.1"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remote
+		if test.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+		if have := proxies.ClientIP(req); have != test.want {
+			t.Errorf("%s via %q: expected %s, got %s", test.remote, test.forwarded, test.want, have)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/thang-qt/Readn/src/assets"
@@ -10,25 +11,78 @@ import (
 )
 
 type Middleware struct {
-	Username string
-	Password string
+	// reports whether the users have to log in, otherwise
+	// the requests act on behalf of the default user
+	Enabled  func() bool
 	BasePath string
 	Public   []string
 	DB       *storage.Storage
+	// header with the username set by the trusted proxies,
+	// takes precedence over the login form if set
+	AuthHeader string
+	Proxies    TrustedProxies
+	Limiter    *Limiter
+
+	challenges challenges
 }
 
-func unsafeMethod(method string) bool {
+// Reports whether the requests of the method change the state.
+func UnsafeMethod(method string) bool {
 	return method == "POST" || method == "PUT" || method == "DELETE"
 }
 
-func (m *Middleware) Handler(c *router.Context) {
+func (m *Middleware) isPublic(req *http.Request) bool {
 	for _, path := range m.Public {
-		if strings.HasPrefix(c.Req.URL.Path, m.BasePath+path) {
+		if strings.HasPrefix(req.URL.Path, m.BasePath+path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Middleware) Handler(c *router.Context) {
+	if !m.Enabled() {
+		c.UserID = storage.DefaultUserId
+		// the scripts calling the api have no cookies to steal & no token,
+		// nor have the client apis; the other sites' pages are kept off
+		// them by their origin still
+		requireToken := csrfSeed(c.Req) != "" && !m.isPublic(c.Req)
+		if !m.checkCSRF(c, requireToken) {
+			return
+		}
+		c.Next()
+		return
+	}
+	if m.isPublic(c.Req) {
+		c.Next()
+		return
+	}
+	// other schemes may come from a reverse proxy doing its own auth
+	if bearer, ok := strings.CutPrefix(c.Req.Header.Get("Authorization"), "Bearer "); ok {
+		m.handleBearer(c, bearer)
+		return
+	}
+	if m.AuthHeader != "" {
+		if user, ok := m.proxyUser(c.Req); ok {
+			if user == nil || user.Disabled {
+				c.Out.WriteHeader(http.StatusForbidden)
+				return
+			}
+			if !m.checkCSRF(c, true) {
+				return
+			}
+			c.User = user.Username
+			c.UserID = user.Id
 			c.Next()
 			return
 		}
 	}
-	if IsAuthenticated(c.Req, m.Username, m.Password) {
+	if user := m.sessionUser(c); user != nil {
+		if !m.checkCSRF(c, true) {
+			return
+		}
+		c.User = user.Username
+		c.UserID = user.Id
 		c.Next()
 		return
 	}
@@ -40,16 +94,52 @@ func (m *Middleware) Handler(c *router.Context) {
 		return
 	}
 
+	// no session to act on behalf of yet, but the login itself
+	// should not be forged by other sites
+	if c.Req.Method == "POST" && !m.sameOrigin(c.Req) {
+		c.Out.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if c.Req.Method == "POST" && c.Req.FormValue("challenge") != "" {
+		m.handleTOTP(c, rootUrl)
+		return
+	}
 	if c.Req.Method == "POST" {
-		username := c.Req.FormValue("username")
-		password := c.Req.FormValue("password")
-		if StringsEqual(username, m.Username) && StringsEqual(password, m.Password) {
-			Authenticate(c.Out, m.Username, m.Password, m.BasePath)
+		formUsername := c.Req.FormValue("username")
+		formPassword := c.Req.FormValue("password")
+		ip := m.Proxies.ClientIP(c.Req)
+		if wait, ok := m.Limiter.Check(ip, formUsername); !ok {
+			LogFailure(ip, formUsername, "login", true)
+			c.Out.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			c.HTML(http.StatusTooManyRequests, assets.Template("login.html"), map[string]interface{}{
+				"username": formUsername,
+				"error":    "Too many failed attempts, try again later",
+				"settings": m.DB.GetSettings(),
+			})
+			return
+		}
+		user := m.DB.GetUserByName(formUsername)
+		if user != nil && !user.Disabled && CheckPassword(user.Password, formPassword) {
+			if user.TOTPEnabled {
+				// the attempts are reset once the code is right too
+				c.HTML(http.StatusOK, assets.Template("login.html"), map[string]interface{}{
+					"challenge": m.challenges.create(user),
+					"settings":  m.DB.GetSettings(),
+				})
+				return
+			}
+			m.Limiter.Succeed(ip, formUsername)
+			if !Authenticate(c.Out, c.Req, m.DB, user.Id, m.BasePath) {
+				c.Out.WriteHeader(http.StatusInternalServerError)
+				return
+			}
 			c.Redirect(rootUrl)
 			return
 		} else {
+			m.Limiter.Fail(ip, formUsername)
+			LogFailure(ip, formUsername, "login", false)
 			c.HTML(http.StatusOK, assets.Template("login.html"), map[string]interface{}{
-				"username": username,
+				"username": formUsername,
 				"error":    "Invalid username/password",
 				"settings": m.DB.GetSettings(),
 			})
@@ -60,3 +150,40 @@ func (m *Middleware) Handler(c *router.Context) {
 		"settings": m.DB.GetSettings(),
 	})
 }
+
+// Returns the active user the session cookie belongs to.
+func (m *Middleware) sessionUser(c *router.Context) *storage.User {
+	session := CurrentSession(c.Req, m.DB)
+	if session == nil {
+		return nil
+	}
+	user := m.DB.GetUser(session.UserId)
+	if user == nil || user.Disabled || user.Password == "" {
+		return nil
+	}
+	touchSession(c.Out, c.Req, m.DB, session, m.BasePath)
+	return user
+}
+
+// Authenticates the request with the API token, without falling back
+// to the login form: the clients expect a status code instead.
+func (m *Middleware) handleBearer(c *router.Context, bearer string) {
+	token := LookupToken(m.DB, bearer)
+	if token == nil {
+		c.Out.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	user := m.DB.GetUser(token.UserId)
+	if user == nil || user.Disabled {
+		c.Out.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if !ScopeAllows(token.Scope, ScopeWrite) && UnsafeMethod(c.Req.Method) {
+		c.Out.WriteHeader(http.StatusForbidden)
+		return
+	}
+	c.User = user.Username
+	c.UserID = user.Id
+	c.Scope = token.Scope
+	c.Next()
+}
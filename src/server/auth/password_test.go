@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestPBKDF2(t *testing.T) {
+	// HMAC-SHA256 results for the RFC 6070 inputs
+	tests := []struct {
+		iterations int
+		want       string
+	}{
+		{1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+	}
+	for _, test := range tests {
+		have := hex.EncodeToString(pbkdf2([]byte("password"), []byte("salt"), test.iterations, 32))
+		if have != test.want {
+			t.Errorf("iterations=%d: expected %s, got %s", test.iterations, test.want, have)
+		}
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	hash := HashPassword("secret")
+	if !CheckPassword(hash, "secret") {
+		t.Error("expected the password to match")
+	}
+	if CheckPassword(hash, "Secret") {
+		t.Error("expected a different password not to match")
+	}
+	if CheckPassword("secret", "secret") || CheckPassword("", "") {
+		t.Error("expected malformed hashes not to match")
+	}
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/thang-qt/Readn/src/storage"
+)
+
+// Reverse proxies allowed to pass the client's identity & address.
+type TrustedProxies struct {
+	Prefixes []netip.Prefix
+	// the proxy is the only one able to reach a unix socket,
+	// so all the requests coming through it are trusted
+	UnixSocket bool
+}
+
+// Parses a comma-separated list of CIDRs or single addresses.
+func ParseTrustedProxies(value string) ([]netip.Prefix, error) {
+	list := make([]netip.Prefix, 0)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !strings.Contains(part, "/") {
+			addr, err := netip.ParseAddr(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", part)
+			}
+			list = append(list, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", part)
+		}
+		list = append(list, prefix.Masked())
+	}
+	return list, nil
+}
+
+func (t TrustedProxies) contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range t.Prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t TrustedProxies) trusts(req *http.Request) bool {
+	if t.UnixSocket {
+		return true
+	}
+	addr, err := netip.ParseAddrPort(req.RemoteAddr)
+	return err == nil && t.contains(addr.Addr())
+}
+
+// Returns the address of the client. Behind the trusted proxies it's
+// the last address in X-Forwarded-For that is not one of them.
+func (t TrustedProxies) ClientIP(req *http.Request) string {
+	ip := req.RemoteAddr
+	if addr, err := netip.ParseAddrPort(req.RemoteAddr); err == nil {
+		ip = addr.Addr().Unmap().String()
+	}
+	if !t.trusts(req) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		ip = addr.Unmap().String()
+		if !t.contains(addr) {
+			break
+		}
+	}
+	return ip
+}
+
+// Returns the user named in the auth header of a request from a trusted
+// proxy (e.g. oauth2-proxy, Authelia). The users unknown so far get created,
+// without a password.
+func (m *Middleware) proxyUser(req *http.Request) (*storage.User, bool) {
+	username := strings.TrimSpace(req.Header.Get(m.AuthHeader))
+	if username == "" {
+		return nil, false
+	}
+	if !m.Proxies.trusts(req) {
+		slog.Debug("ignoring auth header from untrusted address", "addr", req.RemoteAddr)
+		return nil, false
+	}
+	if !ValidUsername(username) {
+		slog.Warn("invalid username in auth header", "username", username)
+		return nil, true
+	}
+	user := m.DB.GetUserByName(username)
+	if user == nil {
+		if user = m.DB.CreateUser(username, "", false); user == nil {
+			// created by a concurrent request
+			user = m.DB.GetUserByName(username)
+		} else {
+			slog.Info("created user", "user_id", user.Id, "username", username, "by", "proxy")
+		}
+	}
+	return user, true
+}
+
+func ValidUsername(username string) bool {
+	return username != "" && !strings.ContainsAny(username, ": \t\r\n")
+}
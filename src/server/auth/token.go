@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/thang-qt/Readn/src/storage"
+)
+
+// API token scopes, each including the ones before it.
+// The login sessions are not limited by any scope.
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+	ScopeAdmin = "admin"
+)
+
+var scopeRank = map[string]int{
+	ScopeRead:  1,
+	ScopeWrite: 2,
+	ScopeAdmin: 3,
+	"":         4,
+}
+
+func ValidScope(scope string) bool {
+	return scope == ScopeRead || scope == ScopeWrite || scope == ScopeAdmin
+}
+
+// Reports whether a request with the scope `have` can act with the scope `want`.
+func ScopeAllows(have, want string) bool {
+	return scopeRank[have] >= scopeRank[want]
+}
+
+// Returns the token the bearer string belongs to.
+func LookupToken(db *storage.Storage, bearer string) *storage.APIToken {
+	if bearer == "" {
+		return nil
+	}
+	token := db.GetAPIToken(HashToken(bearer))
+	if token == nil {
+		return nil
+	}
+	// same as with the sessions, spare the writes
+	if token.LastUsed == nil || time.Since(*token.LastUsed) >= sessionTouchInterval {
+		db.TouchAPIToken(token.Id)
+	}
+	return token
+}
+
+// Checks the password a client app (Google Reader, Miniflux, ...) logs in with.
+// For the accounts with two-factor auth, the password alone is refused and
+// an API token of the user takes its place. Returns the scope of the token,
+// empty for the password.
+func CheckClientPassword(db *storage.Storage, user *storage.User, password string) (string, bool) {
+	if !user.TOTPEnabled && user.Password != "" && CheckPassword(user.Password, password) {
+		return "", true
+	}
+	token := LookupToken(db, password)
+	if token == nil || token.UserId != user.Id {
+		return "", false
+	}
+	return token.Scope, true
+}
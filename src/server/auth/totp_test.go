@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B (SHA1), truncated to 6 digits.
+func TestTOTPCode(t *testing.T) {
+	secret := base32NoPadding.EncodeToString([]byte("12345678901234567890"))
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, test := range tests {
+		if have := TOTPCode(secret, time.Unix(test.unix, 0)); have != test.want {
+			t.Errorf("T=%d: expected %s, got %s", test.unix, test.want, have)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := NewTOTPSecret()
+	now := time.Unix(1700000000, 0)
+	step := now.Unix() / totpPeriod
+
+	for _, drift := range []time.Duration{-totpPeriod * time.Second, 0, totpPeriod * time.Second} {
+		have, ok := ValidateTOTP(secret, TOTPCode(secret, now.Add(drift)), now)
+		if !ok || have != step+int64(drift/time.Second)/totpPeriod {
+			t.Errorf("expected the code with drift %s to be valid", drift)
+		}
+	}
+	if _, ok := ValidateTOTP(secret, TOTPCode(secret, now.Add(-2*totpPeriod*time.Second)), now); ok {
+		t.Error("expected an old code to be invalid")
+	}
+	if _, ok := ValidateTOTP(secret, "", now); ok {
+		t.Error("expected an empty code to be invalid")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(TOTPURI("Readn", "alice", "ABC"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Readn:alice" {
+		t.Errorf("unexpected uri: %s", uri)
+	}
+	if uri.Query().Get("secret") != "ABC" || uri.Query().Get("issuer") != "Readn" {
+		t.Errorf("unexpected params: %s", uri.RawQuery)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes := NewRecoveryCodes()
+	if len(codes) != recoveryCodeCount || len(codes[0]) != 11 || codes[0][5] != '-' {
+		t.Fatalf("unexpected codes: %v", codes)
+	}
+	if HashRecoveryCode(codes[0]) != HashRecoveryCode(" "+strings.ToUpper(strings.Replace(codes[0], "-", "", 1))) {
+		t.Error("expected the dash & case not to matter")
+	}
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thang-qt/Readn/src/assets"
+	"github.com/thang-qt/Readn/src/server/router"
+	"github.com/thang-qt/Readn/src/storage"
+)
+
+// time to enter the code after the password
+const challengeTTL = time.Minute * 5
+
+type challenge struct {
+	userId   int64
+	username string
+	expires  time.Time
+}
+
+// Logins waiting for the second factor, by random token.
+type challenges struct {
+	mu   sync.Mutex
+	list map[string]challenge
+}
+
+func (c *challenges) create(user *storage.User) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.list == nil {
+		c.list = make(map[string]challenge)
+	}
+	now := time.Now()
+	for token, ch := range c.list {
+		if now.After(ch.expires) {
+			delete(c.list, token)
+		}
+	}
+	token := NewToken()
+	c.list[token] = challenge{userId: user.Id, username: user.Username, expires: now.Add(challengeTTL)}
+	return token
+}
+
+func (c *challenges) get(token string) (challenge, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch, ok := c.list[token]
+	if !ok || time.Now().After(ch.expires) {
+		return challenge{}, false
+	}
+	return ch, true
+}
+
+func (c *challenges) delete(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.list, token)
+}
+
+// Second step of the login for the users with TOTP set up.
+// Accepts either the current code or one of the recovery codes.
+func (m *Middleware) handleTOTP(c *router.Context, rootUrl string) {
+	token := c.Req.FormValue("challenge")
+	ch, ok := m.challenges.get(token)
+	if !ok {
+		c.HTML(http.StatusOK, assets.Template("login.html"), map[string]interface{}{
+			"error":    "Login expired, please try again",
+			"settings": m.DB.GetSettings(),
+		})
+		return
+	}
+	ip := m.Proxies.ClientIP(c.Req)
+	if wait, ok := m.Limiter.Check(ip, ch.username); !ok {
+		LogFailure(ip, ch.username, "totp", true)
+		c.Out.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		c.HTML(http.StatusTooManyRequests, assets.Template("login.html"), map[string]interface{}{
+			"error":    "Too many failed attempts, try again later",
+			"settings": m.DB.GetSettings(),
+		})
+		return
+	}
+
+	user := m.DB.GetUser(ch.userId)
+	if user == nil || user.Disabled || !user.TOTPEnabled {
+		m.challenges.delete(token)
+		c.Redirect(rootUrl)
+		return
+	}
+	code := strings.TrimSpace(c.Req.FormValue("code"))
+	valid := false
+	if step, ok := ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		valid = m.DB.UseTOTPStep(user.Id, step)
+	} else if len(code) > totpDigits && m.DB.UseRecoveryCode(user.Id, HashRecoveryCode(code)) {
+		slog.Info("recovery code used", "user_id", user.Id, "username", user.Username)
+		valid = true
+	}
+	if !valid {
+		m.Limiter.Fail(ip, ch.username)
+		LogFailure(ip, ch.username, "totp", false)
+		c.HTML(http.StatusOK, assets.Template("login.html"), map[string]interface{}{
+			"challenge": token,
+			"error":     "Invalid code",
+			"settings":  m.DB.GetSettings(),
+		})
+		return
+	}
+
+	m.challenges.delete(token)
+	m.Limiter.Succeed(ip, ch.username)
+	if !Authenticate(c.Out, c.Req, m.DB, user.Id, m.BasePath) {
+		c.Out.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	c.Redirect(rootUrl)
+}
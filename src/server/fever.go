@@ -4,16 +4,20 @@ import (
 	"crypto/md5"
 	"encoding/base64"
 	"fmt"
-	"log"
+	"hash/fnv"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/thang-qt/Readn/src/content/htmlutil"
 	"github.com/thang-qt/Readn/src/server/auth"
 	"github.com/thang-qt/Readn/src/server/router"
 	"github.com/thang-qt/Readn/src/storage"
+	"golang.org/x/net/html"
 )
 
 type FeverGroup struct {
@@ -48,6 +52,19 @@ type FeverItem struct {
 	CreatedAt int64  `json:"created_on_time"`
 }
 
+type FeverLink struct {
+	ID          int64   `json:"id"`
+	FeedID      int64   `json:"feed_id"`
+	ItemID      int64   `json:"item_id"`
+	Temperature float64 `json:"temperature"`
+	IsItem      int     `json:"is_item"`
+	IsLocal     int     `json:"is_local"`
+	IsSaved     int     `json:"is_saved"`
+	Title       string  `json:"title"`
+	Url         string  `json:"url"`
+	ItemIDs     string  `json:"item_ids"`
+}
+
 type FeverFavicon struct {
 	ID   int64  `json:"id"`
 	Data string `json:"data"`
@@ -74,16 +91,32 @@ func getLastRefreshedOnTime(httpStates map[int64]storage.HTTPState) int64 {
 	return lastRefreshed
 }
 
+// The api key of the Fever clients: md5 of `username:password`.
+func feverKey(username, password string) string {
+	md5HashValue := md5.Sum([]byte(fmt.Sprintf("%s:%s", username, password)))
+	return fmt.Sprintf("%x", md5HashValue[:])
+}
+
 func (s *Server) feverAuth(c *router.Context) bool {
-	if s.Username != "" && s.Password != "" {
-		apiKey := c.Req.FormValue("api_key")
-		apiKey = strings.ToLower(apiKey)
-		md5HashValue := md5.Sum([]byte(fmt.Sprintf("%s:%s", s.Username, s.Password)))
-		hexMD5HashValue := fmt.Sprintf("%x", md5HashValue[:])
-		if !auth.StringsEqual(apiKey, hexMD5HashValue) {
-			return false
-		}
+	if !s.authEnabled() {
+		c.UserID = storage.DefaultUserId
+		return true
+	}
+	ip := s.trustedProxies().ClientIP(c.Req)
+	if _, ok := s.limiter.Check(ip, ""); !ok {
+		auth.LogFailure(ip, "", "fever", true)
+		return false
+	}
+	apiKey := strings.ToLower(c.Req.FormValue("api_key"))
+	user := s.db.GetUserByFeverKey(apiKey)
+	if user == nil || user.Disabled || !auth.StringsEqual(apiKey, user.FeverKey) {
+		s.limiter.Fail(ip, "")
+		auth.LogFailure(ip, "", "fever", false)
+		return false
 	}
+	s.limiter.Succeed(ip, "")
+	c.User = user.Username
+	c.UserID = user.Id
 	return true
 }
 
@@ -105,6 +138,11 @@ func (s *Server) handleFever(c *router.Context) {
 		return
 	}
 
+	// a write op sent along with the reads
+	if formHasValue(c.Req.Form, "unread_recently_read") {
+		s.feverUnreadRecentlyRead(c)
+	}
+
 	switch {
 	case formHasValue(c.Req.Form, "groups"):
 		s.feverGroupsHandler(c)
@@ -145,12 +183,17 @@ func joinInts(values []int64) string {
 func feedGroups(db *storage.Storage) []*FeverFeedsGroup {
 	feeds := db.ListFeeds()
 
+	parents := make(map[int64]*int64)
+	for _, folder := range db.ListFolders() {
+		parents[folder.Id] = folder.ParentId
+	}
+
+	// fever groups are flat: a feed belongs to its folder and all the folders above
 	groupFeeds := make(map[int64][]int64)
 	for _, feed := range feeds {
-		if feed.FolderId == nil {
-			continue
+		for folderId := feed.FolderId; folderId != nil; folderId = parents[*folderId] {
+			groupFeeds[*folderId] = append(groupFeeds[*folderId], feed.Id)
 		}
-		groupFeeds[*feed.FolderId] = append(groupFeeds[*feed.FolderId], feed.Id)
 	}
 	result := make([]*FeverFeedsGroup, 0)
 	for groupId, feedIds := range groupFeeds {
@@ -163,19 +206,21 @@ func feedGroups(db *storage.Storage) []*FeverFeedsGroup {
 }
 
 func (s *Server) feverGroupsHandler(c *router.Context) {
-	folders := s.db.ListFolders()
+	db := s.userDB(c)
+	folders := db.ListFolders()
 	groups := make([]*FeverGroup, len(folders))
 	for i, folder := range folders {
 		groups[i] = &FeverGroup{ID: folder.Id, Title: folder.Title}
 	}
 	writeFeverJSON(c, map[string]interface{}{
 		"groups":       groups,
-		"feeds_groups": feedGroups(s.db),
+		"feeds_groups": feedGroups(db),
 	}, getLastRefreshedOnTime(s.db.ListHTTPStates()))
 }
 
 func (s *Server) feverFeedsHandler(c *router.Context) {
-	feeds := s.db.ListFeeds()
+	db := s.userDB(c)
+	feeds := db.ListFeeds()
 	httpStates := s.db.ListHTTPStates()
 
 	feverFeeds := make([]*FeverFeed, len(feeds))
@@ -184,29 +229,34 @@ func (s *Server) feverFeedsHandler(c *router.Context) {
 		if state, ok := httpStates[feed.Id]; ok {
 			lastUpdated = state.LastRefreshed.Unix()
 		}
+		isSpark := 0
+		if feed.IsSpark {
+			isSpark = 1
+		}
 		feverFeeds[i] = &FeverFeed{
 			ID:          feed.Id,
 			FaviconID:   feed.Id,
 			Title:       feed.Title,
 			Url:         feed.FeedLink,
 			SiteUrl:     feed.Link,
-			IsSpark:     0,
+			IsSpark:     isSpark,
 			LastUpdated: lastUpdated,
 		}
 	}
 	writeFeverJSON(c, map[string]interface{}{
 		"feeds":        feverFeeds,
-		"feeds_groups": feedGroups(s.db),
+		"feeds_groups": feedGroups(db),
 	}, getLastRefreshedOnTime(httpStates))
 }
 
 func (s *Server) feverFaviconsHandler(c *router.Context) {
-	feeds := s.db.ListFeeds()
+	db := s.userDB(c)
+	feeds := db.ListFeeds()
 	favicons := make([]*FeverFavicon, len(feeds))
 	for i, feed := range feeds {
 		data := "data:image/gif;base64,R0lGODlhAQABAAAAACw="
 		if feed.HasIcon {
-			icon := s.db.GetFeed(feed.Id).Icon
+			icon := db.GetFeed(feed.Id).Icon
 			data = fmt.Sprintf(
 				"data:%s;base64,%s",
 				http.DetectContentType(*icon),
@@ -226,6 +276,7 @@ func (s *Server) feverFaviconsHandler(c *router.Context) {
 const listLimit = 50
 
 func (s *Server) feverItemsHandler(c *router.Context) {
+	db := s.userDB(c)
 	filter := storage.ItemFilter{}
 	query := c.Req.URL.Query()
 
@@ -250,7 +301,7 @@ func (s *Server) feverItemsHandler(c *router.Context) {
 		}
 	}
 
-	items := s.db.ListItems(filter, listLimit, true, true)
+	items := db.ListItems(filter, listLimit, true, true)
 
 	feverItems := make([]FeverItem, len(items))
 	for i, item := range items {
@@ -269,7 +320,7 @@ func (s *Server) feverItemsHandler(c *router.Context) {
 			ID:        item.Id,
 			FeedID:    item.FeedId,
 			Title:     item.Title,
-			Author:    "",
+			Author:    item.Author,
 			HTML:      item.Content,
 			Url:       item.Link,
 			IsSaved:   isSaved,
@@ -278,7 +329,7 @@ func (s *Server) feverItemsHandler(c *router.Context) {
 		}
 	}
 
-	totalItems := s.db.CountItems(storage.ItemFilter{})
+	totalItems := db.CountItems(storage.ItemFilter{})
 
 	writeFeverJSON(c, map[string]interface{}{
 		"items":       feverItems,
@@ -286,13 +337,145 @@ func (s *Server) feverItemsHandler(c *router.Context) {
 	}, getLastRefreshedOnTime(s.db.ListHTTPStates()))
 }
 
+// Hot links are those shared by the items of at least that many feeds.
+const feverHotLinkFeeds = 2
+
+// The hot links are looked for among the newest items of the range only,
+// going back no further than a year.
+const (
+	feverLinksMaxRange  = 30
+	feverLinksMaxOffset = 365
+	feverLinksMaxItems  = 1000
+)
+
+type feverHotLink struct {
+	title   string
+	itemIds []int64
+	feeds   map[int64]bool
+	// of the newest item linking to it
+	feedId int64
+}
+
+// Links of the item content, absolute and without the fragments.
+func itemLinks(item storage.Item) map[string]string {
+	links := make(map[string]string)
+	doc, err := html.Parse(strings.NewReader(item.Content))
+	if err != nil {
+		return links
+	}
+	for _, a := range htmlutil.Query(doc, "a") {
+		href := htmlutil.AbsoluteUrl(htmlutil.Attr(a, "href"), item.Link)
+		href, _, _ = strings.Cut(href, "#")
+		if !htmlutil.IsAPossibleLink(href) || href == item.Link {
+			continue
+		}
+		if _, ok := links[href]; !ok {
+			links[href] = strings.TrimSpace(htmlutil.Text(a))
+		}
+	}
+	return links
+}
+
+// Fever link ids are plain numbers, a hash of the url small enough for javascript.
+func feverLinkID(link string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(link))
+	return int64(h.Sum64() >> 11)
+}
+
+// The links shared by the items of several feeds within `range` days,
+// ending `offset` days ago, the hottest first.
 func (s *Server) feverLinksHandler(c *router.Context) {
+	db := s.userDB(c)
+	offset, _ := strconv.Atoi(c.Req.Form.Get("offset"))
+	offset = min(max(offset, 0), feverLinksMaxOffset)
+	days, err := strconv.Atoi(c.Req.Form.Get("range"))
+	if err != nil || days <= 0 {
+		days = 7
+	}
+	days = min(days, feverLinksMaxRange)
+	page, err := strconv.Atoi(c.Req.Form.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	until := time.Now().AddDate(0, 0, -offset)
+	since := until.AddDate(0, 0, -days)
+
+	hot := make(map[string]*feverHotLink)
+	items := make(map[string]storage.Item)
+	filter := storage.ItemFilter{Since: &since, Before: &until}
+	for scanned := 0; scanned < feverLinksMaxItems; {
+		batch := db.ListItems(filter, min(listLimit, feverLinksMaxItems-scanned), true, true)
+		if len(batch) == 0 {
+			break
+		}
+		for _, item := range batch {
+			links := itemLinks(item)
+			if _, ok := items[item.Link]; !ok && item.Link != "" {
+				item.Content = ""
+				items[item.Link] = item
+			}
+			for link, title := range links {
+				h, ok := hot[link]
+				if !ok {
+					h = &feverHotLink{title: title, feeds: make(map[int64]bool), feedId: item.FeedId}
+					hot[link] = h
+				}
+				h.itemIds = append(h.itemIds, item.Id)
+				h.feeds[item.FeedId] = true
+			}
+		}
+		scanned += len(batch)
+		filter.After = &batch[len(batch)-1].Id
+	}
+
+	links := make([]*FeverLink, 0)
+	for link, h := range hot {
+		if len(h.feeds) < feverHotLinkFeeds {
+			continue
+		}
+		l := &FeverLink{
+			ID:          feverLinkID(link),
+			Temperature: float64(len(h.itemIds)),
+			Title:       h.title,
+			Url:         link,
+			ItemIDs:     joinInts(h.itemIds),
+		}
+		// the link is an item itself, or else the newest item linking to it stands for it
+		if item, ok := items[link]; ok {
+			l.FeedID = item.FeedId
+			l.ItemID = item.Id
+			l.IsItem = 1
+			l.IsLocal = 1
+			l.Title = item.Title
+			if item.Status == storage.STARRED {
+				l.IsSaved = 1
+			}
+		} else {
+			l.FeedID = h.feedId
+			l.ItemID = h.itemIds[0]
+		}
+		if l.Title == "" {
+			l.Title = link
+		}
+		links = append(links, l)
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].Temperature != links[j].Temperature {
+			return links[i].Temperature > links[j].Temperature
+		}
+		return links[i].Url < links[j].Url
+	})
+	start := min((page-1)*listLimit, len(links))
+	end := min(start+listLimit, len(links))
+
 	writeFeverJSON(c, map[string]interface{}{
-		"links": make([]interface{}, 0),
+		"links": links[start:end],
 	}, getLastRefreshedOnTime(s.db.ListHTTPStates()))
 }
 
 func (s *Server) feverUnreadItemIDsHandler(c *router.Context) {
+	db := s.userDB(c)
 	status := storage.UNREAD
 	itemIds := make([]int64, 0)
 
@@ -300,7 +483,7 @@ func (s *Server) feverUnreadItemIDsHandler(c *router.Context) {
 		Status: &status,
 	}
 	for {
-		items := s.db.ListItems(itemFilter, listLimit, true, false)
+		items := db.ListItems(itemFilter, listLimit, true, false)
 		if len(items) == 0 {
 			break
 		}
@@ -315,6 +498,7 @@ func (s *Server) feverUnreadItemIDsHandler(c *router.Context) {
 }
 
 func (s *Server) feverSavedItemIDsHandler(c *router.Context) {
+	db := s.userDB(c)
 	status := storage.STARRED
 	itemIds := make([]int64, 0)
 
@@ -322,7 +506,7 @@ func (s *Server) feverSavedItemIDsHandler(c *router.Context) {
 		Status: &status,
 	}
 	for {
-		items := s.db.ListItems(itemFilter, listLimit, true, false)
+		items := db.ListItems(itemFilter, listLimit, true, false)
 		if len(items) == 0 {
 			break
 		}
@@ -336,10 +520,45 @@ func (s *Server) feverSavedItemIDsHandler(c *router.Context) {
 	}, getLastRefreshedOnTime(s.db.ListHTTPStates()))
 }
 
+// The items read within this time can be marked unread at once.
+const feverRecentlyRead = time.Hour
+
+func (s *Server) feverUnreadRecentlyRead(c *router.Context) {
+	db := s.userDB(c)
+	status := storage.READ
+	since := time.Now().Add(-feverRecentlyRead)
+	itemIds := make([]int64, 0)
+
+	itemFilter := storage.ItemFilter{
+		Status:        &status,
+		ModifiedSince: &since,
+	}
+	for {
+		items := db.ListItems(itemFilter, listLimit, true, false)
+		if len(items) == 0 {
+			break
+		}
+		for _, item := range items {
+			itemIds = append(itemIds, item.Id)
+		}
+		itemFilter.After = &items[len(items)-1].Id
+	}
+	for _, id := range itemIds {
+		db.UpdateItemStatus(id, storage.UNREAD)
+	}
+}
+
+// Super groups of the Fever clients, besides the folders.
+const (
+	feverKindlingGroup = 0  // all the feeds but the sparks
+	feverSparksGroup   = -1 // the spark feeds
+)
+
 func (s *Server) feverMarkHandler(c *router.Context) {
+	db := s.userDB(c)
 	id, err := strconv.ParseInt(c.Req.Form.Get("id"), 10, 64)
 	if err != nil {
-		log.Print("invalid id:", err)
+		slog.Debug("invalid fever id", "err", err)
 		return
 	}
 
@@ -359,29 +578,33 @@ func (s *Server) feverMarkHandler(c *router.Context) {
 			c.Out.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		s.db.UpdateItemStatus(id, status)
-	case "feed":
+		db.UpdateItemStatus(id, status)
+	case "feed", "group":
 		if c.Req.Form.Get("as") != "read" {
 			c.Out.WriteHeader(http.StatusBadRequest)
+			return
 		}
-		markFilter := storage.MarkFilter{FeedID: &id}
-		x, _ := strconv.ParseInt(c.Req.Form.Get("before"), 10, 64)
-		if x > 0 {
-			before := time.Unix(x, 0)
-			markFilter.Before = &before
-		}
-		s.db.MarkItemsRead(markFilter)
-	case "group":
-		if c.Req.Form.Get("as") != "read" {
-			c.Out.WriteHeader(http.StatusBadRequest)
+		markFilter := storage.MarkFilter{}
+		if c.Req.Form.Get("mark") == "feed" {
+			markFilter.FeedID = &id
+		} else {
+			switch id {
+			case feverKindlingGroup:
+				isSpark := false
+				markFilter.Spark = &isSpark
+			case feverSparksGroup:
+				isSpark := true
+				markFilter.Spark = &isSpark
+			default:
+				markFilter.FolderID = &id
+			}
 		}
-		markFilter := storage.MarkFilter{FolderID: &id}
 		x, _ := strconv.ParseInt(c.Req.Form.Get("before"), 10, 64)
 		if x > 0 {
 			before := time.Unix(x, 0)
 			markFilter.Before = &before
 		}
-		s.db.MarkItemsRead(markFilter)
+		db.MarkItemsRead(markFilter)
 	default:
 		c.Out.WriteHeader(http.StatusBadRequest)
 		return
@@ -1,21 +1,80 @@
 package server
 
-import "github.com/thang-qt/Readn/src/storage"
+import (
+	"encoding/json"
+
+	"github.com/thang-qt/Readn/src/storage"
+)
 
 type ItemUpdateForm struct {
 	Status *storage.ItemStatus `json:"status,omitempty"`
 }
 
 type FolderCreateForm struct {
-	Title string `json:"title"`
+	Title    string `json:"title"`
+	ParentID *int64 `json:"parent_id,omitempty"`
 }
 
 type FolderUpdateForm struct {
 	Title      *string `json:"title,omitempty"`
 	IsExpanded *bool   `json:"is_expanded,omitempty"`
+	// raw value to tell apart `null` (move to the top level) from absent field
+	ParentID json.RawMessage `json:"parent_id,omitempty"`
 }
 
 type FeedCreateForm struct {
 	Url      string `json:"url"`
 	FolderID *int64 `json:"folder_id,omitempty"`
 }
+
+type LabelForm struct {
+	Title string `json:"title"`
+}
+
+type ItemLabelsForm struct {
+	LabelIDs []int64 `json:"label_ids"`
+}
+
+type ItemNoteForm struct {
+	Text string `json:"text"`
+}
+
+type HighlightCreateForm struct {
+	Text    string `json:"text"`
+	Prefix  string `json:"prefix"`
+	Suffix  string `json:"suffix"`
+	Comment string `json:"comment"`
+}
+
+type HighlightUpdateForm struct {
+	Comment string `json:"comment"`
+}
+
+type SavedItemCreateForm struct {
+	Url string `json:"url"`
+}
+
+type UserCreateForm struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	IsAdmin  bool   `json:"is_admin"`
+}
+
+type UserUpdateForm struct {
+	Password *string `json:"password,omitempty"`
+	IsAdmin  *bool   `json:"is_admin,omitempty"`
+	Disabled *bool   `json:"disabled,omitempty"`
+}
+
+type FeverPasswordForm struct {
+	Password string `json:"password"`
+}
+
+type APITokenCreateForm struct {
+	Name  string `json:"name"`
+	Scope string `json:"scope"`
+}
+
+type TOTPCodeForm struct {
+	Code string `json:"code"`
+}
@@ -0,0 +1,747 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thang-qt/Readn/src/server/auth"
+	"github.com/thang-qt/Readn/src/server/router"
+	"github.com/thang-qt/Readn/src/storage"
+	"github.com/thang-qt/Readn/src/worker"
+)
+
+// Google Reader API as implemented by FreshRSS & co, used by
+// the native clients (Reeder, NetNewsWire, FocusReader, ...).
+// The folders are exposed as labels, named by their paths.
+
+const (
+	greaderItemPrefix    = "tag:google.com,2005:reader/item/"
+	greaderLabelPrefix   = "user/-/label/"
+	greaderStatePrefix   = "user/-/state/com.google/"
+	greaderReadingList   = greaderStatePrefix + "reading-list"
+	greaderRead          = greaderStatePrefix + "read"
+	greaderStarred       = greaderStatePrefix + "starred"
+	greaderFeedPrefix    = "feed/"
+	greaderDefaultLimit  = 20
+	greaderIDsLimit      = 10000
+	greaderContentsLimit = 1000
+)
+
+type GReaderCategory struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+}
+
+type GReaderSubscription struct {
+	ID         string            `json:"id"`
+	Title      string            `json:"title"`
+	Categories []GReaderCategory `json:"categories"`
+	Url        string            `json:"url"`
+	HtmlUrl    string            `json:"htmlUrl"`
+	IconUrl    string            `json:"iconUrl"`
+}
+
+type GReaderTag struct {
+	ID   string `json:"id"`
+	Type string `json:"type,omitempty"`
+}
+
+type GReaderUnreadCount struct {
+	ID                      string `json:"id"`
+	Count                   int64  `json:"count"`
+	NewestItemTimestampUsec string `json:"newestItemTimestampUsec"`
+}
+
+type GReaderLink struct {
+	Href string `json:"href"`
+	Type string `json:"type,omitempty"`
+}
+
+type GReaderOrigin struct {
+	StreamID string `json:"streamId"`
+	Title    string `json:"title"`
+	HtmlUrl  string `json:"htmlUrl"`
+}
+
+type GReaderContent struct {
+	Direction string `json:"direction"`
+	Content   string `json:"content"`
+}
+
+type GReaderItem struct {
+	ID            string         `json:"id"`
+	CrawlTimeMsec string         `json:"crawlTimeMsec"`
+	TimestampUsec string         `json:"timestampUsec"`
+	Published     int64          `json:"published"`
+	Updated       int64          `json:"updated"`
+	Title         string         `json:"title"`
+	Canonical     []GReaderLink  `json:"canonical"`
+	Alternate     []GReaderLink  `json:"alternate"`
+	Categories    []string       `json:"categories"`
+	Origin        GReaderOrigin  `json:"origin"`
+	Summary       GReaderContent `json:"summary"`
+	Author        string         `json:"author"`
+	Enclosure     []GReaderLink  `json:"enclosure,omitempty"`
+}
+
+type GReaderItemRef struct {
+	ID              string   `json:"id"`
+	DirectStreamIDs []string `json:"directStreamIds"`
+	TimestampUsec   string   `json:"timestampUsec"`
+}
+
+// The tokens issued on login are named after the API & the client,
+// and are dropped once they haven't been used for that long.
+const (
+	greaderTokenName    = "Google Reader"
+	greaderTokenMaxIdle = 30 * 24 * time.Hour
+)
+
+// Names the token by the client, as told by the login form (the
+// `client` parameter of the FreshRSS clients) or the user agent.
+func greaderTokenLabel(req *http.Request) string {
+	client := strings.TrimSpace(req.FormValue("client"))
+	if client == "" {
+		client = strings.TrimSpace(req.UserAgent())
+	}
+	if client == "" {
+		return greaderTokenName
+	}
+	if runes := []rune(client); len(runes) > 64 {
+		client = string(runes[:64])
+	}
+	return greaderTokenName + " (" + client + ")"
+}
+
+// Logs the client in with the username & password, or an API token
+// in place of the password for the accounts with two-factor auth.
+// The issued token is listed among the API tokens of the user.
+func (s *Server) handleGReaderLogin(c *router.Context) {
+	if !s.authEnabled() {
+		fmt.Fprint(c.Out, "SID=readn\nLSID=readn\nAuth=readn\n")
+		return
+	}
+	username := c.Req.FormValue("Email")
+	password := c.Req.FormValue("Passwd")
+	ip := s.trustedProxies().ClientIP(c.Req)
+	if wait, ok := s.limiter.Check(ip, username); !ok {
+		auth.LogFailure(ip, username, "greader", true)
+		c.Out.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		c.Out.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+	user := s.db.GetUserByName(username)
+	scope, valid := "", false
+	if user != nil && !user.Disabled {
+		scope, valid = auth.CheckClientPassword(s.db, user, password)
+	}
+	if !valid {
+		s.limiter.Fail(ip, username)
+		auth.LogFailure(ip, username, "greader", false)
+		c.Out.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(c.Out, "Error=BadAuthentication\n")
+		return
+	}
+	s.limiter.Succeed(ip, username)
+
+	// a read-only token logs in read-only
+	if scope != auth.ScopeRead {
+		scope = auth.ScopeWrite
+	}
+	// every device keeps its own token, the forgotten ones go away
+	s.db.DeleteStaleAPITokens(user.Id, greaderTokenName, time.Now().Add(-greaderTokenMaxIdle))
+	secret := auth.NewToken()
+	if s.db.CreateAPIToken(user.Id, greaderTokenLabel(c.Req), auth.HashToken(secret), scope) == nil {
+		c.Out.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(c.Out, "SID=%s\nLSID=%s\nAuth=%s\n", secret, secret, secret)
+}
+
+// Authenticates the request with the token from ClientLogin,
+// sent as `Authorization: GoogleLogin auth=<token>`.
+func (s *Server) greaderAuth(c *router.Context) {
+	if !s.authEnabled() {
+		c.UserID = storage.DefaultUserId
+		c.Next()
+		return
+	}
+	secret, ok := strings.CutPrefix(c.Req.Header.Get("Authorization"), "GoogleLogin auth=")
+	if !ok {
+		c.Out.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	token := auth.LookupToken(s.db, secret)
+	if token == nil {
+		c.Out.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	user := s.db.GetUser(token.UserId)
+	if user == nil || user.Disabled {
+		c.Out.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if !auth.ScopeAllows(token.Scope, auth.ScopeWrite) && c.Req.Method == http.MethodPost {
+		c.Out.WriteHeader(http.StatusForbidden)
+		return
+	}
+	c.User = user.Username
+	c.UserID = user.Id
+	c.Scope = token.Scope
+	c.Next()
+}
+
+// The clients send it back with the edits. The requests are
+// authenticated by the header already, so any value will do.
+func (s *Server) handleGReaderToken(c *router.Context) {
+	fmt.Fprintf(c.Out, "%s\n", auth.HashToken(c.Req.Header.Get("Authorization"))[:57])
+}
+
+func (s *Server) handleGReaderUserInfo(c *router.Context) {
+	username := c.User
+	if username == "" {
+		username, _ = s.credentials()
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"userId":        strconv.FormatInt(c.UserID, 10),
+		"userName":      username,
+		"userProfileId": strconv.FormatInt(c.UserID, 10),
+		"userEmail":     "",
+	})
+}
+
+func greaderLabel(path string) string {
+	return greaderLabelPrefix + path
+}
+
+func greaderFeed(feedId int64) string {
+	return greaderFeedPrefix + strconv.FormatInt(feedId, 10)
+}
+
+func greaderItemID(itemId int64) string {
+	return fmt.Sprintf("%s%016x", greaderItemPrefix, itemId)
+}
+
+// The item ids come either in the long form (hex) or the short one (decimal).
+func parseGReaderItemID(id string) (int64, bool) {
+	if hex, ok := strings.CutPrefix(id, greaderItemPrefix); ok {
+		num, err := strconv.ParseUint(hex, 16, 64)
+		return int64(num), err == nil
+	}
+	num, err := strconv.ParseInt(id, 10, 64)
+	return num, err == nil
+}
+
+func usec(t time.Time) string {
+	return strconv.FormatInt(t.UnixMicro(), 10)
+}
+
+// Replaces the user id in the stream ids, e.g. `user/1/label/x`, with `-`.
+func normalizeGReaderStream(stream string) string {
+	if rest, ok := strings.CutPrefix(stream, "user/"); ok {
+		if i := strings.Index(rest, "/"); i >= 0 {
+			return "user/-" + rest[i:]
+		}
+	}
+	return stream
+}
+
+func greaderLabelID(db *storage.Storage, title string) *int64 {
+	for _, label := range db.ListLabels() {
+		if label.Title == title {
+			return &label.Id
+		}
+	}
+	return nil
+}
+
+// Fills in the item filter for the stream. Reports false for the unknown streams.
+func greaderStreamFilter(db *storage.Storage, stream string, filter *storage.ItemFilter) bool {
+	stream = normalizeGReaderStream(stream)
+	switch {
+	case stream == "" || stream == greaderReadingList:
+		return true
+	case stream == greaderStarred:
+		status := storage.STARRED
+		filter.Status = &status
+		return true
+	case stream == greaderRead:
+		status := storage.READ
+		filter.Status = &status
+		return true
+	case strings.HasPrefix(stream, greaderFeedPrefix):
+		feedId, err := strconv.ParseInt(strings.TrimPrefix(stream, greaderFeedPrefix), 10, 64)
+		if err != nil {
+			return false
+		}
+		filter.FeedID = &feedId
+		return true
+	case strings.HasPrefix(stream, greaderLabelPrefix):
+		title := strings.TrimPrefix(stream, greaderLabelPrefix)
+		if folderId := folderByPath(db, title, false); folderId != nil {
+			filter.FolderID = folderId
+			return true
+		}
+		if labelId := greaderLabelID(db, title); labelId != nil {
+			filter.LabelID = labelId
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) handleGReaderSubscriptionList(c *router.Context) {
+	db := s.userDB(c)
+	paths := storage.FolderPaths(db.ListFolders())
+	feeds := db.ListFeeds()
+	subscriptions := make([]GReaderSubscription, len(feeds))
+	for i, feed := range feeds {
+		categories := make([]GReaderCategory, 0)
+		if feed.FolderId != nil {
+			path := paths[*feed.FolderId]
+			categories = append(categories, GReaderCategory{ID: greaderLabel(path), Label: path})
+		}
+		subscriptions[i] = GReaderSubscription{
+			ID:         greaderFeed(feed.Id),
+			Title:      feed.Title,
+			Categories: categories,
+			Url:        feed.FeedLink,
+			HtmlUrl:    feed.Link,
+		}
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{"subscriptions": subscriptions})
+}
+
+func (s *Server) handleGReaderTagList(c *router.Context) {
+	db := s.userDB(c)
+	tags := []GReaderTag{{ID: greaderStarred}}
+	for _, path := range storage.FolderPaths(db.ListFolders()) {
+		tags = append(tags, GReaderTag{ID: greaderLabel(path), Type: "folder"})
+	}
+	for _, label := range db.ListLabels() {
+		tags = append(tags, GReaderTag{ID: greaderLabel(label.Title), Type: "tag"})
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{"tags": tags})
+}
+
+func (s *Server) handleGReaderUnreadCount(c *router.Context) {
+	db := s.userDB(c)
+	newest := db.FeedLastItemDates()
+	counts := make([]GReaderUnreadCount, 0)
+
+	var total int64
+	var totalNewest time.Time
+	for _, stat := range db.FeedStats() {
+		counts = append(counts, GReaderUnreadCount{
+			ID:                      greaderFeed(stat.FeedId),
+			Count:                   stat.UnreadCount,
+			NewestItemTimestampUsec: usec(newest[stat.FeedId]),
+		})
+		total += stat.UnreadCount
+		if newest[stat.FeedId].After(totalNewest) {
+			totalNewest = newest[stat.FeedId]
+		}
+	}
+	folders := db.ListFolders()
+	paths := storage.FolderPaths(folders)
+	// the folders count the items of their subfolders as well
+	parents := make(map[int64]*int64, len(folders))
+	for _, folder := range folders {
+		parents[folder.Id] = folder.ParentId
+	}
+	folderNewest := make(map[int64]time.Time)
+	for _, feed := range db.ListFeeds() {
+		folderId := feed.FolderId
+		for depth := 0; folderId != nil && depth < len(folders); depth++ {
+			if newest[feed.Id].After(folderNewest[*folderId]) {
+				folderNewest[*folderId] = newest[feed.Id]
+			}
+			folderId = parents[*folderId]
+		}
+	}
+	for _, stat := range db.FolderStats() {
+		counts = append(counts, GReaderUnreadCount{
+			ID:                      greaderLabel(paths[stat.FolderId]),
+			Count:                   stat.UnreadCount,
+			NewestItemTimestampUsec: usec(folderNewest[stat.FolderId]),
+		})
+	}
+	counts = append(counts, GReaderUnreadCount{
+		ID:                      greaderReadingList,
+		Count:                   total,
+		NewestItemTimestampUsec: usec(totalNewest),
+	})
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"max":          total,
+		"unreadcounts": counts,
+	})
+}
+
+// Parses the common parameters of the stream requests:
+// exclusion of the read items, time range, order & continuation.
+func greaderStreamQuery(c *router.Context, db *storage.Storage, stream string, maxLimit int) (filter storage.ItemFilter, limit int, newestFirst bool, ok bool) {
+	if !greaderStreamFilter(db, stream, &filter) {
+		return filter, 0, false, false
+	}
+	form := c.Req.Form
+	for _, exclude := range form["xt"] {
+		if normalizeGReaderStream(exclude) == greaderRead && filter.Status == nil {
+			status := storage.UNREAD
+			filter.Status = &status
+		}
+	}
+	for _, include := range form["it"] {
+		if normalizeGReaderStream(include) == greaderStarred {
+			status := storage.STARRED
+			filter.Status = &status
+		}
+	}
+	if ot, err := strconv.ParseInt(form.Get("ot"), 10, 64); err == nil && ot > 0 {
+		since := time.Unix(ot, 0)
+		filter.Since = &since
+	}
+	if nt, err := strconv.ParseInt(form.Get("nt"), 10, 64); err == nil && nt > 0 {
+		before := time.Unix(nt, 0)
+		filter.Before = &before
+	}
+	if after, err := strconv.ParseInt(form.Get("c"), 10, 64); err == nil {
+		filter.After = &after
+	}
+	limit = greaderDefaultLimit
+	if n, err := strconv.Atoi(form.Get("n")); err == nil && n > 0 {
+		limit = min(n, maxLimit)
+	}
+	return filter, limit, form.Get("r") != "o", true
+}
+
+func (s *Server) handleGReaderStreamIDs(c *router.Context) {
+	c.Req.ParseForm()
+	db := s.userDB(c)
+	filter, limit, newestFirst, ok := greaderStreamQuery(c, db, c.Req.Form.Get("s"), greaderIDsLimit)
+	if !ok {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	items := db.ListItems(filter, limit, newestFirst, false)
+	refs := make([]GReaderItemRef, len(items))
+	for i, item := range items {
+		refs[i] = GReaderItemRef{
+			ID:              strconv.FormatInt(item.Id, 10),
+			DirectStreamIDs: []string{greaderFeed(item.FeedId)},
+			TimestampUsec:   usec(item.Date),
+		}
+	}
+	result := map[string]interface{}{"itemRefs": refs}
+	if len(items) == limit {
+		result["continuation"] = strconv.FormatInt(items[len(items)-1].Id, 10)
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func (s *Server) handleGReaderStreamContents(c *router.Context) {
+	c.Req.ParseForm()
+	db := s.userDB(c)
+	stream := c.Vars["stream"]
+	if stream == "" {
+		stream = c.Req.Form.Get("s")
+	}
+	filter, limit, newestFirst, ok := greaderStreamQuery(c, db, stream, greaderContentsLimit)
+	if !ok {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	items := db.ListItems(filter, limit, newestFirst, true)
+	result := map[string]interface{}{
+		"id":      stream,
+		"updated": time.Now().Unix(),
+		"items":   s.greaderItems(db, items),
+	}
+	if len(items) == limit {
+		result["continuation"] = strconv.FormatInt(items[len(items)-1].Id, 10)
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// Returns the items by the ids from `i`, in the order asked for.
+func (s *Server) handleGReaderItemContents(c *router.Context) {
+	c.Req.ParseForm()
+	db := s.userDB(c)
+	ids := make([]int64, 0)
+	for _, id := range c.Req.Form["i"] {
+		if num, ok := parseGReaderItemID(id); ok {
+			ids = append(ids, num)
+		}
+	}
+	if len(ids) > greaderContentsLimit {
+		ids = ids[:greaderContentsLimit]
+	}
+	items := make([]storage.Item, 0, len(ids))
+	if len(ids) > 0 {
+		byId := make(map[int64]storage.Item)
+		for _, item := range db.ListItems(storage.ItemFilter{IDs: &ids}, len(ids), true, true) {
+			byId[item.Id] = item
+		}
+		for _, id := range ids {
+			if item, ok := byId[id]; ok {
+				items = append(items, item)
+			}
+		}
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"id":      greaderReadingList,
+		"updated": time.Now().Unix(),
+		"items":   s.greaderItems(db, items),
+	})
+}
+
+func (s *Server) greaderItems(db *storage.Storage, items []storage.Item) []GReaderItem {
+	feeds := make(map[int64]storage.Feed)
+	for _, feed := range db.ListFeeds() {
+		feeds[feed.Id] = feed
+	}
+	paths := storage.FolderPaths(db.ListFolders())
+
+	result := make([]GReaderItem, len(items))
+	for i, item := range items {
+		feed := feeds[item.FeedId]
+		categories := []string{greaderReadingList}
+		if feed.FolderId != nil {
+			categories = append(categories, greaderLabel(paths[*feed.FolderId]))
+		}
+		switch item.Status {
+		case storage.READ:
+			categories = append(categories, greaderRead)
+		case storage.STARRED:
+			categories = append(categories, greaderRead, greaderStarred)
+		}
+		enclosures := make([]GReaderLink, 0)
+		for _, media := range item.MediaLinks {
+			enclosures = append(enclosures, GReaderLink{Href: media.URL, Type: media.Type})
+		}
+		result[i] = GReaderItem{
+			ID:            greaderItemID(item.Id),
+			CrawlTimeMsec: strconv.FormatInt(item.Date.UnixMilli(), 10),
+			TimestampUsec: usec(item.Date),
+			Published:     item.Date.Unix(),
+			Updated:       item.Date.Unix(),
+			Title:         item.Title,
+			Author:        item.Author,
+			Canonical:     []GReaderLink{{Href: item.Link}},
+			Alternate:     []GReaderLink{{Href: item.Link, Type: "text/html"}},
+			Categories:    categories,
+			Origin: GReaderOrigin{
+				StreamID: greaderFeed(item.FeedId),
+				Title:    feed.Title,
+				HtmlUrl:  feed.Link,
+			},
+			Summary:   GReaderContent{Direction: "ltr", Content: item.Content},
+			Enclosure: enclosures,
+		}
+	}
+	return result
+}
+
+func writeGReaderOK(c *router.Context) {
+	c.Out.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(c.Out, "OK")
+}
+
+// Adds (`a`) & removes (`r`) the tags of the items (`i`). Read & starred
+// map onto the item status, the other labels onto the item labels.
+// Removing the star leaves the item read, as there's one status only.
+func (s *Server) handleGReaderEditTag(c *router.Context) {
+	c.Req.ParseForm()
+	db := s.userDB(c)
+	form := c.Req.Form
+	add := make([]string, len(form["a"]))
+	for i, tag := range form["a"] {
+		add[i] = normalizeGReaderStream(tag)
+	}
+	remove := make([]string, len(form["r"]))
+	for i, tag := range form["r"] {
+		remove[i] = normalizeGReaderStream(tag)
+	}
+
+	labelIds := make(map[string]int64)
+	for _, tag := range append(add, remove...) {
+		title, ok := strings.CutPrefix(tag, greaderLabelPrefix)
+		if !ok || folderByPath(db, title, false) != nil {
+			continue
+		}
+		if slices.Contains(add, tag) {
+			if label := db.CreateLabel(title); label != nil {
+				labelIds[tag] = label.Id
+			}
+		} else if labelId := greaderLabelID(db, title); labelId != nil {
+			labelIds[tag] = *labelId
+		}
+	}
+
+	for _, id := range form["i"] {
+		itemId, ok := parseGReaderItemID(id)
+		if !ok {
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		item := db.GetItem(itemId)
+		if item == nil {
+			continue
+		}
+		status := item.Status
+		if slices.Contains(remove, greaderStarred) && status == storage.STARRED {
+			status = storage.READ
+		}
+		if slices.Contains(remove, greaderRead) && status == storage.READ {
+			status = storage.UNREAD
+		}
+		if slices.Contains(add, greaderRead) && status == storage.UNREAD {
+			status = storage.READ
+		}
+		if slices.Contains(add, greaderStarred) {
+			status = storage.STARRED
+		}
+		if status != item.Status {
+			db.UpdateItemStatus(itemId, status)
+		}
+
+		if len(labelIds) == 0 {
+			continue
+		}
+		labels := make([]int64, 0)
+		for _, label := range db.ListItemLabels(itemId) {
+			labels = append(labels, label.Id)
+		}
+		for tag, labelId := range labelIds {
+			if slices.Contains(remove, tag) {
+				labels = slices.DeleteFunc(labels, func(id int64) bool { return id == labelId })
+			}
+			if slices.Contains(add, tag) && !slices.Contains(labels, labelId) {
+				labels = append(labels, labelId)
+			}
+		}
+		db.SetItemLabels(itemId, labels)
+	}
+	writeGReaderOK(c)
+}
+
+// Marks the items of the stream (`s`) older than `ts` (microseconds) read.
+func (s *Server) handleGReaderMarkAllRead(c *router.Context) {
+	c.Req.ParseForm()
+	db := s.userDB(c)
+	var filter storage.ItemFilter
+	stream := c.Req.Form.Get("s")
+	if stream == "" || !greaderStreamFilter(db, stream, &filter) {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if filter.Status != nil {
+		// the starred & read items have nothing unread
+		writeGReaderOK(c)
+		return
+	}
+	markFilter := storage.MarkFilter{
+		FolderID: filter.FolderID,
+		FeedID:   filter.FeedID,
+		LabelID:  filter.LabelID,
+	}
+	if ts, err := strconv.ParseInt(c.Req.Form.Get("ts"), 10, 64); err == nil && ts > 0 {
+		before := time.UnixMicro(ts)
+		markFilter.Before = &before
+	}
+	if !db.MarkItemsRead(markFilter) {
+		c.Out.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeGReaderOK(c)
+}
+
+// Subscribes to (`ac=subscribe`, `s=feed/<url>`), unsubscribes from
+// (`ac=unsubscribe`) or edits (`ac=edit`) the feeds: `t` is the title,
+// `a` the label (folder) to move the feed to, `r` the one to move it out of.
+func (s *Server) handleGReaderSubscriptionEdit(c *router.Context) {
+	c.Req.ParseForm()
+	db := s.userDB(c)
+	form := c.Req.Form
+	title := form.Get("t")
+	addLabel, hasAdd := strings.CutPrefix(normalizeGReaderStream(form.Get("a")), greaderLabelPrefix)
+	removeLabel, hasRemove := strings.CutPrefix(normalizeGReaderStream(form.Get("r")), greaderLabelPrefix)
+
+	for _, stream := range form["s"] {
+		target, ok := strings.CutPrefix(stream, greaderFeedPrefix)
+		if !ok {
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if form.Get("ac") == "subscribe" {
+			if !s.greaderSubscribe(c, target, title, addLabel) {
+				c.Out.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			continue
+		}
+
+		feedId, err := strconv.ParseInt(target, 10, 64)
+		if err != nil || db.GetFeed(feedId) == nil {
+			c.Out.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch form.Get("ac") {
+		case "unsubscribe":
+			db.DeleteFeed(feedId)
+		case "edit":
+			if title != "" {
+				db.RenameFeed(feedId, title)
+			}
+			if hasAdd {
+				db.UpdateFeedFolder(feedId, folderByPath(db, addLabel, true))
+			} else if hasRemove {
+				feed := db.GetFeed(feedId)
+				folderId := folderByPath(db, removeLabel, false)
+				if feed.FolderId != nil && folderId != nil && *feed.FolderId == *folderId {
+					db.UpdateFeedFolder(feedId, nil)
+				}
+			}
+		default:
+			c.Out.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	writeGReaderOK(c)
+}
+
+func (s *Server) greaderSubscribe(c *router.Context, feedUrl, title, folder string) bool {
+	if u, err := url.Parse(feedUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	result, err := worker.DiscoverFeed(feedUrl)
+	if err != nil {
+		slog.Warn("failed to discover feed", "url", feedUrl, "err", err)
+		return false
+	}
+	if result.Feed == nil && len(result.Sources) > 0 {
+		// a page linking to several feeds, the first one is usually the main one
+		result, err = worker.DiscoverFeed(result.Sources[0].Url)
+		if err != nil {
+			slog.Warn("failed to discover feed", "url", feedUrl, "err", err)
+			return false
+		}
+	}
+	if result.Feed == nil {
+		return false
+	}
+	db := s.userDB(c)
+	feed := s.worker.CreateFeed(c.UserID, result, folderByPath(db, folder, true))
+	if feed == nil {
+		return false
+	}
+	if title != "" {
+		db.RenameFeed(feed.Id, title)
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/thang-qt/Readn/src/server/router"
+)
+
+type healthStatus struct {
+	Status        string     `json:"status"`
+	Database      string     `json:"database"`
+	SchemaVersion int64      `json:"schema_version"`
+	SchemaLatest  int64      `json:"schema_latest"`
+	Worker        string     `json:"worker"`
+	FeedsPending  int32      `json:"feeds_pending"`
+	LastRefresh   *time.Time `json:"last_refresh"`
+}
+
+func (s *Server) health(ctx context.Context) healthStatus {
+	status := healthStatus{
+		Status:       "ok",
+		Database:     "ok",
+		Worker:       s.worker.State(),
+		FeedsPending: s.worker.FeedsPending(),
+	}
+	if last := s.worker.LastRefresh(); !last.IsZero() {
+		status.LastRefresh = &last
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := s.db.Ping(ctx); err != nil {
+		status.Status = "error"
+		status.Database = err.Error()
+		return status
+	}
+	current, latest, err := s.db.SchemaVersion()
+	if err != nil {
+		status.Status = "error"
+		status.Database = err.Error()
+	}
+	status.SchemaVersion = current
+	status.SchemaLatest = latest
+	return status
+}
+
+// Liveness: fails only if the database can't be reached.
+func (s *Server) handleHealthz(c *router.Context) {
+	status := s.health(c.Req.Context())
+	code := http.StatusOK
+	if status.Status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, status)
+}
+
+// Readiness: also fails while the schema is outdated or the server is stopping.
+func (s *Server) handleReadyz(c *router.Context) {
+	status := s.health(c.Req.Context())
+	if status.Status == "ok" && (status.SchemaVersion != status.SchemaLatest || status.Worker == "stopped") {
+		status.Status = "unavailable"
+	}
+	code := http.StatusOK
+	if status.Status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, status)
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/thang-qt/Readn/src/server/router"
+	"github.com/thang-qt/Readn/src/storage"
+)
+
+func (s *Server) handleItemHighlights(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.JSON(http.StatusOK, db.ListHighlights(&id))
+}
+
+func (s *Server) handleItemHighlightCreate(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var body HighlightCreateForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+		slog.Debug("invalid request body", "err", err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(body.Text) == "" {
+		c.JSON(http.StatusBadRequest, map[string]string{"error": "Highlighted text missing."})
+		return
+	}
+	if db.GetItem(id) == nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	highlight := db.CreateHighlight(storage.Highlight{
+		ItemId:  id,
+		Text:    body.Text,
+		Prefix:  body.Prefix,
+		Suffix:  body.Suffix,
+		Comment: body.Comment,
+	})
+	if highlight == nil {
+		c.Out.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusCreated, highlight)
+}
+
+func (s *Server) handleHighlightList(c *router.Context) {
+	db := s.userDB(c)
+	c.JSON(http.StatusOK, db.ListHighlights(nil))
+}
+
+func (s *Server) handleHighlightUpdate(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var body HighlightUpdateForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+		slog.Debug("invalid request body", "err", err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	db.UpdateHighlightComment(id, body.Comment)
+	c.Out.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleHighlightDelete(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	db.DeleteHighlight(id)
+	c.Out.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleHighlightExport(c *router.Context) {
+	db := s.userDB(c)
+	highlights := db.ListHighlights(nil)
+
+	ids := make([]int64, 0)
+	byItem := make(map[int64][]storage.Highlight)
+	for _, h := range highlights {
+		if _, ok := byItem[h.ItemId]; !ok {
+			ids = append(ids, h.ItemId)
+		}
+		byItem[h.ItemId] = append(byItem[h.ItemId], h)
+	}
+
+	items := make(map[int64]storage.Item)
+	if len(ids) > 0 {
+		for _, item := range db.ListItems(storage.ItemFilter{IDs: &ids}, len(ids), false, false) {
+			items[item.Id] = item
+		}
+	}
+	feeds := make(map[int64]storage.Feed)
+	for _, feed := range db.ListFeeds() {
+		feeds[feed.Id] = feed
+	}
+
+	c.Out.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	c.Out.Header().Set("Content-Disposition", `attachment; filename="highlights.md"`)
+	c.Out.Write([]byte(highlightsMarkdown(ids, byItem, items, feeds)))
+}
+
+var (
+	markdownTitleEscaper = strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`)
+	markdownLinkEscaper  = strings.NewReplacer(`(`, `%28`, `)`, `%29`, ` `, `%20`)
+)
+
+// Renders highlights grouped by article, in the order the articles were first highlighted.
+func highlightsMarkdown(ids []int64, byItem map[int64][]storage.Highlight, items map[int64]storage.Item, feeds map[int64]storage.Feed) string {
+	builder := strings.Builder{}
+	builder.WriteString("# Highlights\n")
+	for _, id := range ids {
+		item := items[id]
+		title := item.Title
+		if title == "" {
+			title = item.Link
+		}
+		builder.WriteString("\n")
+		if item.Link != "" {
+			fmt.Fprintf(&builder, "## [%s](%s)\n\n", markdownTitleEscaper.Replace(title), markdownLinkEscaper.Replace(item.Link))
+		} else {
+			fmt.Fprintf(&builder, "## %s\n\n", title)
+		}
+
+		source := make([]string, 0, 2)
+		if feed, ok := feeds[item.FeedId]; ok {
+			source = append(source, feed.Title)
+		}
+		if !item.Date.IsZero() {
+			source = append(source, item.Date.Format("2006-01-02"))
+		}
+		if len(source) > 0 {
+			fmt.Fprintf(&builder, "*%s*\n\n", strings.Join(source, ", "))
+		}
+
+		for _, h := range byItem[id] {
+			for _, line := range strings.Split(strings.TrimSpace(h.Text), "\n") {
+				builder.WriteString(strings.TrimRight("> "+line, " ") + "\n")
+			}
+			builder.WriteString("\n")
+			if comment := strings.TrimSpace(h.Comment); comment != "" {
+				builder.WriteString(comment + "\n\n")
+			}
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/thang-qt/Readn/src/metrics"
+	"github.com/thang-qt/Readn/src/server/auth"
+	"github.com/thang-qt/Readn/src/server/router"
+)
+
+var (
+	requestDuration = metrics.NewHistogram(
+		"readn_http_request_duration_seconds",
+		"HTTP request latency by route.",
+		metrics.DefBuckets,
+		"route", "method", "code",
+	)
+	aiRequests = metrics.NewCounter(
+		"readn_ai_requests_total",
+		"Requests made to the AI API.",
+		"kind",
+	)
+	aiErrors = metrics.NewCounter(
+		"readn_ai_request_errors_total",
+		"Failed requests to the AI API.",
+		"kind",
+	)
+	aiDuration = metrics.NewHistogram(
+		"readn_ai_request_duration_seconds",
+		"AI API request latency.",
+		[]float64{0.5, 1, 2.5, 5, 10, 20, 30, 60, 120},
+		"kind",
+	)
+)
+
+func measureRequest(c *router.Context) {
+	start := time.Now()
+	c.Next()
+	requestDuration.Observe(time.Since(start).Seconds(), c.Route, c.Req.Method, strconv.Itoa(c.Status()))
+}
+
+// Sends the request to the AI API and returns the response body.
+func sendAIRequest(kind string, req *http.Request) ([]byte, error) {
+	start := time.Now()
+	aiRequests.Inc(kind)
+	body, err := func() ([]byte, error) {
+		client := &http.Client{}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+		}
+		return body, nil
+	}()
+	aiDuration.Observe(time.Since(start).Seconds(), kind)
+	if err != nil {
+		aiErrors.Inc(kind)
+	}
+	return body, err
+}
+
+func (s *Server) handleMetrics(c *router.Context) {
+	if s.MetricsToken != "" {
+		token := c.Req.Header.Get("Authorization")
+		if !auth.StringsEqual(token, "Bearer "+s.MetricsToken) {
+			c.Out.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	feeds := s.db.ListAllFeeds()
+	feedErrors := s.db.GetAllFeedErrors()
+	dbSize, dbFree, err := s.db.Size()
+	if err != nil {
+		c.Out.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	c.Out.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	metrics.WriteGauge(c.Out, "readn_feeds", "Number of feeds.", float64(len(feeds)))
+	metrics.WriteGauge(c.Out, "readn_feeds_errors", "Number of feeds which failed to refresh.", float64(len(feedErrors)))
+	metrics.WriteGauge(c.Out, "readn_feeds_pending", "Number of feeds waiting to be refreshed.", float64(s.worker.FeedsPending()))
+	metrics.WriteGauge(c.Out, "readn_database_size_bytes", "Size of the database file.", float64(dbSize))
+	metrics.WriteGauge(c.Out, "readn_database_free_bytes", "Unused space in the database file.", float64(dbFree))
+	metrics.WriteTo(c.Out)
+}
@@ -0,0 +1,728 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thang-qt/Readn/src/server/auth"
+	"github.com/thang-qt/Readn/src/server/router"
+	"github.com/thang-qt/Readn/src/storage"
+	"github.com/thang-qt/Readn/src/worker"
+)
+
+// Subset of the Miniflux v1 API. The categories are the folders, titled by
+// their paths; the feeds outside of the folders belong to the category 0.
+
+const (
+	minifluxDefaultLimit = 100
+	minifluxMaxLimit     = 1000
+)
+
+type MinifluxUser struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	IsAdmin  bool   `json:"is_admin"`
+}
+
+type MinifluxCategory struct {
+	ID           int64  `json:"id"`
+	Title        string `json:"title"`
+	UserID       int64  `json:"user_id"`
+	HideGlobally bool   `json:"hide_globally"`
+	FeedCount    *int   `json:"feed_count,omitempty"`
+	TotalUnread  *int64 `json:"total_unread,omitempty"`
+}
+
+type MinifluxFeedIcon struct {
+	FeedID int64 `json:"feed_id"`
+	IconID int64 `json:"icon_id"`
+}
+
+type MinifluxFeed struct {
+	ID                  int64             `json:"id"`
+	UserID              int64             `json:"user_id"`
+	FeedURL             string            `json:"feed_url"`
+	SiteURL             string            `json:"site_url"`
+	Title               string            `json:"title"`
+	CheckedAt           time.Time         `json:"checked_at"`
+	EtagHeader          string            `json:"etag_header"`
+	LastModifiedHeader  string            `json:"last_modified_header"`
+	ParsingErrorMessage string            `json:"parsing_error_message"`
+	ParsingErrorCount   int               `json:"parsing_error_count"`
+	Disabled            bool              `json:"disabled"`
+	HideGlobally        bool              `json:"hide_globally"`
+	Category            MinifluxCategory  `json:"category"`
+	Icon                *MinifluxFeedIcon `json:"icon"`
+}
+
+type MinifluxEnclosure struct {
+	ID       int64  `json:"id"`
+	UserID   int64  `json:"user_id"`
+	EntryID  int64  `json:"entry_id"`
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+	Size     int    `json:"size"`
+}
+
+type MinifluxEntry struct {
+	ID          int64               `json:"id"`
+	UserID      int64               `json:"user_id"`
+	FeedID      int64               `json:"feed_id"`
+	Status      string              `json:"status"`
+	Hash        string              `json:"hash"`
+	Title       string              `json:"title"`
+	URL         string              `json:"url"`
+	CommentsURL string              `json:"comments_url"`
+	PublishedAt time.Time           `json:"published_at"`
+	CreatedAt   time.Time           `json:"created_at"`
+	ChangedAt   time.Time           `json:"changed_at"`
+	Content     string              `json:"content"`
+	Author      string              `json:"author"`
+	ShareCode   string              `json:"share_code"`
+	Starred     bool                `json:"starred"`
+	ReadingTime int                 `json:"reading_time"`
+	Enclosures  []MinifluxEnclosure `json:"enclosures"`
+	Tags        []string            `json:"tags"`
+	Feed        *MinifluxFeed       `json:"feed"`
+}
+
+type MinifluxIcon struct {
+	ID       int64  `json:"id"`
+	Data     string `json:"data"`
+	MimeType string `json:"mime_type"`
+}
+
+type MinifluxFeedCreateForm struct {
+	FeedURL    string `json:"feed_url"`
+	CategoryID int64  `json:"category_id"`
+}
+
+type MinifluxFeedUpdateForm struct {
+	FeedURL    *string `json:"feed_url"`
+	Title      *string `json:"title"`
+	CategoryID *int64  `json:"category_id"`
+}
+
+type MinifluxCategoryForm struct {
+	Title string `json:"title"`
+}
+
+type MinifluxEntriesUpdateForm struct {
+	EntryIDs []int64 `json:"entry_ids"`
+	Status   string  `json:"status"`
+}
+
+func minifluxError(c *router.Context, status int, message string) {
+	c.JSON(status, map[string]string{"error_message": message})
+}
+
+// Authenticates the request with an API token in `X-Auth-Token`,
+// or the username & password (see basicAuth).
+func (s *Server) minifluxAuth(c *router.Context) {
+	if !s.authEnabled() {
+		c.UserID = storage.DefaultUserId
+		c.Next()
+		return
+	}
+	authenticated := false
+	if key := c.Req.Header.Get("X-Auth-Token"); key != "" {
+		if token := auth.LookupToken(s.db, key); token != nil {
+			authenticated = s.setClientUser(c, s.db.GetUser(token.UserId), token.Scope)
+		}
+	} else {
+		authenticated = s.basicAuth(c, "miniflux")
+	}
+	if !authenticated {
+		minifluxError(c, http.StatusUnauthorized, "Access Unauthorized")
+		return
+	}
+	if !auth.ScopeAllows(c.Scope, auth.ScopeWrite) && auth.UnsafeMethod(c.Req.Method) {
+		minifluxError(c, http.StatusForbidden, "Access Forbidden")
+		return
+	}
+	c.Next()
+}
+
+// Authenticates the client APIs with HTTP basic auth. The password
+// is checked with auth.CheckClientPassword & the failed attempts are
+// counted by the login limiter.
+func (s *Server) basicAuth(c *router.Context, via string) bool {
+	username, password, ok := c.Req.BasicAuth()
+	if !ok {
+		return false
+	}
+	ip := s.trustedProxies().ClientIP(c.Req)
+	if _, ok := s.limiter.Check(ip, username); !ok {
+		auth.LogFailure(ip, username, via, true)
+		return false
+	}
+	user := s.db.GetUserByName(username)
+	scope, valid := "", false
+	if user != nil && !user.Disabled {
+		scope, valid = auth.CheckClientPassword(s.db, user, password)
+	}
+	if !valid {
+		s.limiter.Fail(ip, username)
+		auth.LogFailure(ip, username, via, false)
+		return false
+	}
+	s.limiter.Succeed(ip, username)
+	return s.setClientUser(c, user, scope)
+}
+
+func (s *Server) setClientUser(c *router.Context, user *storage.User, scope string) bool {
+	if user == nil || user.Disabled {
+		return false
+	}
+	c.User = user.Username
+	c.UserID = user.Id
+	c.Scope = scope
+	return true
+}
+
+func (s *Server) handleMinifluxMe(c *router.Context) {
+	user := s.db.GetUser(c.UserID)
+	if user == nil {
+		minifluxError(c, http.StatusNotFound, "User not found")
+		return
+	}
+	c.JSON(http.StatusOK, MinifluxUser{ID: user.Id, Username: user.Username, IsAdmin: user.IsAdmin})
+}
+
+// Feeds, categories & the state needed to serialize them.
+type minifluxModel struct {
+	userId     int64
+	feeds      map[int64]storage.Feed
+	categories map[int64]MinifluxCategory
+	httpStates map[int64]storage.HTTPState
+	errors     map[int64]string
+}
+
+func (s *Server) minifluxModel(c *router.Context) *minifluxModel {
+	db := s.userDB(c)
+	m := &minifluxModel{
+		userId:     c.UserID,
+		feeds:      make(map[int64]storage.Feed),
+		categories: make(map[int64]MinifluxCategory),
+		httpStates: s.db.ListHTTPStates(),
+		errors:     db.GetFeedErrors(),
+	}
+	for _, feed := range db.ListFeeds() {
+		m.feeds[feed.Id] = feed
+	}
+	for id, path := range storage.FolderPaths(db.ListFolders()) {
+		m.categories[id] = MinifluxCategory{ID: id, Title: path, UserID: c.UserID}
+	}
+	return m
+}
+
+func (m *minifluxModel) category(folderId *int64) MinifluxCategory {
+	if folderId == nil {
+		return MinifluxCategory{ID: 0, Title: "Uncategorized", UserID: m.userId}
+	}
+	return m.categories[*folderId]
+}
+
+func (m *minifluxModel) feed(feed storage.Feed) MinifluxFeed {
+	result := MinifluxFeed{
+		ID:       feed.Id,
+		UserID:   m.userId,
+		FeedURL:  feed.FeedLink,
+		SiteURL:  feed.Link,
+		Title:    feed.Title,
+		Category: m.category(feed.FolderId),
+	}
+	if state, ok := m.httpStates[feed.Id]; ok {
+		result.CheckedAt = state.LastRefreshed
+		result.EtagHeader = state.Etag
+		result.LastModifiedHeader = state.LastModified
+	}
+	if err, ok := m.errors[feed.Id]; ok {
+		result.ParsingErrorMessage = err
+		result.ParsingErrorCount = 1
+	}
+	if feed.HasIcon {
+		result.Icon = &MinifluxFeedIcon{FeedID: feed.Id, IconID: feed.Id}
+	}
+	return result
+}
+
+func (m *minifluxModel) entry(item storage.Item) MinifluxEntry {
+	status := "unread"
+	if item.Status != storage.UNREAD {
+		status = "read"
+	}
+	enclosures := make([]MinifluxEnclosure, 0)
+	for _, media := range item.MediaLinks {
+		enclosures = append(enclosures, MinifluxEnclosure{
+			UserID:   m.userId,
+			EntryID:  item.Id,
+			URL:      media.URL,
+			MimeType: media.Type,
+		})
+	}
+	feed := m.feed(m.feeds[item.FeedId])
+	return MinifluxEntry{
+		ID:          item.Id,
+		UserID:      m.userId,
+		FeedID:      item.FeedId,
+		Status:      status,
+		Hash:        item.GUID,
+		Title:       item.Title,
+		Author:      item.Author,
+		URL:         item.Link,
+		PublishedAt: item.Date,
+		CreatedAt:   item.Date,
+		ChangedAt:   item.Date,
+		Content:     item.Content,
+		Starred:     item.Status == storage.STARRED,
+		ReadingTime: item.ReadingTime,
+		Enclosures:  enclosures,
+		Tags:        make([]string, 0),
+		Feed:        &feed,
+	}
+}
+
+func (s *Server) handleMinifluxCategoryList(c *router.Context) {
+	db := s.userDB(c)
+	m := s.minifluxModel(c)
+	counts := c.Req.URL.Query().Get("counts") == "true"
+
+	feedCounts := make(map[int64]int)
+	for _, feed := range m.feeds {
+		if feed.FolderId != nil {
+			feedCounts[*feed.FolderId]++
+		} else {
+			feedCounts[0]++
+		}
+	}
+	unread := make(map[int64]int64)
+	for _, stat := range db.FolderStats() {
+		unread[stat.FolderId] = stat.UnreadCount
+	}
+	for _, stat := range db.FeedStats() {
+		if feed, ok := m.feeds[stat.FeedId]; ok && feed.FolderId == nil {
+			unread[0] += stat.UnreadCount
+		}
+	}
+
+	categories := make([]MinifluxCategory, 0)
+	if feedCounts[0] > 0 {
+		categories = append(categories, m.category(nil))
+	}
+	for _, folder := range db.ListFolders() {
+		categories = append(categories, m.categories[folder.Id])
+	}
+	if counts {
+		for i := range categories {
+			feedCount, unreadCount := feedCounts[categories[i].ID], unread[categories[i].ID]
+			categories[i].FeedCount = &feedCount
+			categories[i].TotalUnread = &unreadCount
+		}
+	}
+	c.JSON(http.StatusOK, categories)
+}
+
+func (s *Server) handleMinifluxCategoryCreate(c *router.Context) {
+	db := s.userDB(c)
+	var form MinifluxCategoryForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&form); err != nil || strings.Trim(form.Title, "/ ") == "" {
+		minifluxError(c, http.StatusBadRequest, "The title is mandatory")
+		return
+	}
+	if folderByPath(db, form.Title, false) != nil {
+		minifluxError(c, http.StatusBadRequest, "This category already exists")
+		return
+	}
+	folderId := folderByPath(db, form.Title, true)
+	if folderId == nil {
+		minifluxError(c, http.StatusInternalServerError, "Unable to create the category")
+		return
+	}
+	c.JSON(http.StatusCreated, s.minifluxModel(c).categories[*folderId])
+}
+
+// Renames the folder. The title is the new path of the folder,
+// only its last part is taken as the folder doesn't move.
+func (s *Server) handleMinifluxCategoryUpdate(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil || db.GetFolder(id) == nil {
+		minifluxError(c, http.StatusNotFound, "Category not found")
+		return
+	}
+	var form MinifluxCategoryForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&form); err != nil {
+		minifluxError(c, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	parts := strings.Split(strings.Trim(form.Title, "/"), "/")
+	title := strings.TrimSpace(parts[len(parts)-1])
+	if title == "" {
+		minifluxError(c, http.StatusBadRequest, "The title is mandatory")
+		return
+	}
+	db.RenameFolder(id, title)
+	c.JSON(http.StatusCreated, s.minifluxModel(c).categories[id])
+}
+
+func (s *Server) handleMinifluxCategoryDelete(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil || db.GetFolder(id) == nil {
+		minifluxError(c, http.StatusNotFound, "Category not found")
+		return
+	}
+	db.DeleteFolder(id)
+	c.Out.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleMinifluxFeedList(c *router.Context) {
+	m := s.minifluxModel(c)
+	var categoryId *int64
+	if c.Vars["id"] != "" {
+		id, err := c.VarInt64("id")
+		if _, ok := m.categories[id]; err != nil || (!ok && id != 0) {
+			minifluxError(c, http.StatusNotFound, "Category not found")
+			return
+		}
+		categoryId = &id
+	}
+	feeds := make([]MinifluxFeed, 0)
+	for _, feed := range s.userDB(c).ListFeeds() {
+		if categoryId != nil && m.category(feed.FolderId).ID != *categoryId {
+			continue
+		}
+		feeds = append(feeds, m.feed(feed))
+	}
+	c.JSON(http.StatusOK, feeds)
+}
+
+func (s *Server) handleMinifluxFeed(c *router.Context) {
+	id, err := c.VarInt64("id")
+	m := s.minifluxModel(c)
+	feed, ok := m.feeds[id]
+	if err != nil || !ok {
+		minifluxError(c, http.StatusNotFound, "Feed not found")
+		return
+	}
+	c.JSON(http.StatusOK, m.feed(feed))
+}
+
+func (s *Server) handleMinifluxFeedCreate(c *router.Context) {
+	db := s.userDB(c)
+	var form MinifluxFeedCreateForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&form); err != nil || form.FeedURL == "" {
+		minifluxError(c, http.StatusBadRequest, "The feed URL is mandatory")
+		return
+	}
+	var folderId *int64
+	if form.CategoryID != 0 {
+		if db.GetFolder(form.CategoryID) == nil {
+			minifluxError(c, http.StatusBadRequest, "This category does not exist")
+			return
+		}
+		folderId = &form.CategoryID
+	}
+	result, err := worker.DiscoverFeed(form.FeedURL)
+	if err != nil {
+		slog.Warn("failed to discover feed", "url", form.FeedURL, "err", err)
+		minifluxError(c, http.StatusBadRequest, "Unable to fetch the feed")
+		return
+	}
+	if result.Feed == nil {
+		minifluxError(c, http.StatusBadRequest, "No feed found at this URL")
+		return
+	}
+	feed := s.worker.CreateFeed(c.UserID, result, folderId)
+	if feed == nil {
+		minifluxError(c, http.StatusInternalServerError, "Unable to create the feed")
+		return
+	}
+	c.JSON(http.StatusCreated, map[string]int64{"feed_id": feed.Id})
+}
+
+func (s *Server) handleMinifluxFeedUpdate(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil || db.GetFeed(id) == nil {
+		minifluxError(c, http.StatusNotFound, "Feed not found")
+		return
+	}
+	var form MinifluxFeedUpdateForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&form); err != nil {
+		minifluxError(c, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if form.CategoryID != nil && *form.CategoryID != 0 && db.GetFolder(*form.CategoryID) == nil {
+		minifluxError(c, http.StatusBadRequest, "This category does not exist")
+		return
+	}
+	if form.Title != nil && *form.Title != "" {
+		db.RenameFeed(id, *form.Title)
+	}
+	if form.FeedURL != nil && *form.FeedURL != "" {
+		db.UpdateFeedLink(id, *form.FeedURL)
+	}
+	if form.CategoryID != nil {
+		if *form.CategoryID == 0 {
+			db.UpdateFeedFolder(id, nil)
+		} else {
+			db.UpdateFeedFolder(id, form.CategoryID)
+		}
+	}
+	m := s.minifluxModel(c)
+	c.JSON(http.StatusCreated, m.feed(m.feeds[id]))
+}
+
+func (s *Server) handleMinifluxFeedDelete(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil || db.GetFeed(id) == nil {
+		minifluxError(c, http.StatusNotFound, "Feed not found")
+		return
+	}
+	db.DeleteFeed(id)
+	c.Out.WriteHeader(http.StatusNoContent)
+}
+
+// The feeds are refreshed all together, be it one feed, a category or all of them.
+func (s *Server) handleMinifluxRefresh(c *router.Context) {
+	s.worker.RefreshFeeds()
+	c.Out.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleMinifluxCounters(c *router.Context) {
+	db := s.userDB(c)
+	read := make(map[string]int)
+	unread := make(map[string]int64)
+	readStatuses := []storage.ItemStatus{storage.READ, storage.STARRED}
+	for _, stat := range db.FeedStats() {
+		feedId := stat.FeedId
+		key := strconv.FormatInt(feedId, 10)
+		unread[key] = stat.UnreadCount
+		read[key] = db.CountItems(storage.ItemFilter{FeedID: &feedId, Statuses: &readStatuses})
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{"reads": read, "unreads": unread})
+}
+
+// The icon ids are the ids of the feeds.
+func (s *Server) handleMinifluxIcon(c *router.Context) {
+	id, err := c.VarInt64("id")
+	if err != nil {
+		minifluxError(c, http.StatusNotFound, "Icon not found")
+		return
+	}
+	feed := s.userDB(c).GetFeed(id)
+	if feed == nil || feed.Icon == nil {
+		minifluxError(c, http.StatusNotFound, "Icon not found")
+		return
+	}
+	mimeType := http.DetectContentType(*feed.Icon)
+	c.JSON(http.StatusOK, MinifluxIcon{
+		ID:       feed.Id,
+		MimeType: mimeType,
+		Data:     fmt.Sprintf("%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(*feed.Icon)),
+	})
+}
+
+// Builds the item filter from the query of the entry listing.
+// Reports false if the query is invalid.
+func minifluxEntryFilter(c *router.Context, filter *storage.ItemFilter) bool {
+	query := c.Req.URL.Query()
+	statuses := make([]storage.ItemStatus, 0)
+	for _, status := range query["status"] {
+		switch status {
+		case "unread":
+			statuses = append(statuses, storage.UNREAD)
+		case "read":
+			statuses = append(statuses, storage.READ, storage.STARRED)
+		case "removed":
+		default:
+			return false
+		}
+	}
+	if len(query["status"]) > 0 {
+		filter.Statuses = &statuses
+	}
+	if starred := query.Get("starred"); starred == "true" || starred == "1" {
+		status := storage.STARRED
+		filter.Status = &status
+	}
+	if search := query.Get("search"); search != "" {
+		filter.Search = &search
+	}
+	params := map[string]**int64{
+		"feed_id":         &filter.FeedID,
+		"category_id":     &filter.FolderID,
+		"after_entry_id":  &filter.SinceID,
+		"before_entry_id": &filter.MaxID,
+	}
+	for param, field := range params {
+		if value := query.Get(param); value != "" {
+			num, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return false
+			}
+			if num > 0 {
+				*field = &num
+			}
+		}
+	}
+	for _, param := range []string{"before", "published_before"} {
+		if unix, err := strconv.ParseInt(query.Get(param), 10, 64); err == nil && unix > 0 {
+			before := time.Unix(unix, 0)
+			filter.Before = &before
+		}
+	}
+	for _, param := range []string{"after", "published_after"} {
+		if unix, err := strconv.ParseInt(query.Get(param), 10, 64); err == nil && unix > 0 {
+			since := time.Unix(unix+1, 0)
+			filter.Since = &since
+		}
+	}
+	return true
+}
+
+func (s *Server) handleMinifluxEntryList(c *router.Context) {
+	db := s.userDB(c)
+	var filter storage.ItemFilter
+	if !minifluxEntryFilter(c, &filter) {
+		minifluxError(c, http.StatusBadRequest, "Invalid filter")
+		return
+	}
+	// the entries of a category or a feed
+	switch {
+	case strings.HasPrefix(c.Route, "/v1/categories/"):
+		id, err := c.VarInt64("id")
+		if err != nil || db.GetFolder(id) == nil {
+			minifluxError(c, http.StatusNotFound, "Category not found")
+			return
+		}
+		filter.FolderID = &id
+	case strings.HasPrefix(c.Route, "/v1/feeds/"):
+		id, err := c.VarInt64("id")
+		if err != nil || db.GetFeed(id) == nil {
+			minifluxError(c, http.StatusNotFound, "Feed not found")
+			return
+		}
+		filter.FeedID = &id
+	}
+
+	query := c.Req.URL.Query()
+	limit := minifluxDefaultLimit
+	if n, err := strconv.Atoi(query.Get("limit")); err == nil && n > 0 {
+		limit = min(n, minifluxMaxLimit)
+	}
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	newestFirst := query.Get("direction") == "desc"
+
+	m := s.minifluxModel(c)
+	entries := make([]MinifluxEntry, 0)
+	for _, item := range db.ListItemsPage(filter, limit, max(offset, 0), newestFirst, true) {
+		entries = append(entries, m.entry(item))
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"total":   db.CountItems(filter),
+		"entries": entries,
+	})
+}
+
+func (s *Server) handleMinifluxEntry(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("entry")
+	if err != nil {
+		minifluxError(c, http.StatusNotFound, "Entry not found")
+		return
+	}
+	item := db.GetItem(id)
+	if item == nil || (c.Vars["id"] != "" && c.Vars["id"] != strconv.FormatInt(item.FeedId, 10)) {
+		minifluxError(c, http.StatusNotFound, "Entry not found")
+		return
+	}
+	c.JSON(http.StatusOK, s.minifluxModel(c).entry(*item))
+}
+
+// Marks the entries read or unread. The starred entries stay starred.
+func (s *Server) handleMinifluxEntriesUpdate(c *router.Context) {
+	db := s.userDB(c)
+	var form MinifluxEntriesUpdateForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&form); err != nil || len(form.EntryIDs) == 0 {
+		minifluxError(c, http.StatusBadRequest, "The list of entries is mandatory")
+		return
+	}
+	var status storage.ItemStatus
+	switch form.Status {
+	case "read":
+		status = storage.READ
+	case "unread":
+		status = storage.UNREAD
+	default:
+		minifluxError(c, http.StatusBadRequest, "Invalid status")
+		return
+	}
+	for _, item := range db.ListItems(storage.ItemFilter{IDs: &form.EntryIDs}, len(form.EntryIDs), false, false) {
+		if item.Status != storage.STARRED {
+			db.UpdateItemStatus(item.Id, status)
+		}
+	}
+	c.Out.WriteHeader(http.StatusNoContent)
+}
+
+// Stars the entry or, if starred already, unstars it leaving it read.
+func (s *Server) handleMinifluxBookmark(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("entry")
+	if err != nil {
+		minifluxError(c, http.StatusNotFound, "Entry not found")
+		return
+	}
+	item := db.GetItem(id)
+	if item == nil {
+		minifluxError(c, http.StatusNotFound, "Entry not found")
+		return
+	}
+	status := storage.STARRED
+	if item.Status == storage.STARRED {
+		status = storage.READ
+	}
+	db.UpdateItemStatus(id, status)
+	c.Out.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleMinifluxMarkAllRead(c *router.Context) {
+	db := s.userDB(c)
+	var filter storage.MarkFilter
+	id, err := c.VarInt64("id")
+	switch {
+	case strings.HasPrefix(c.Route, "/v1/users/"):
+		// the users mark their own entries only
+		if err != nil || id != c.UserID {
+			minifluxError(c, http.StatusForbidden, "Access Forbidden")
+			return
+		}
+	case strings.HasPrefix(c.Route, "/v1/categories/"):
+		if err != nil || db.GetFolder(id) == nil {
+			minifluxError(c, http.StatusNotFound, "Category not found")
+			return
+		}
+		filter.FolderID = &id
+	case strings.HasPrefix(c.Route, "/v1/feeds/"):
+		if err != nil || db.GetFeed(id) == nil {
+			minifluxError(c, http.StatusNotFound, "Feed not found")
+			return
+		}
+		filter.FeedID = &id
+	}
+	if !db.MarkItemsRead(filter) {
+		minifluxError(c, http.StatusInternalServerError, "Unable to update the entries")
+		return
+	}
+	c.Out.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,562 @@
+package server
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thang-qt/Readn/src/server/auth"
+	"github.com/thang-qt/Readn/src/server/router"
+	"github.com/thang-qt/Readn/src/storage"
+	"github.com/thang-qt/Readn/src/worker"
+)
+
+// Nextcloud News API v1.3, see https://nextcloud.github.io/news/api/api-v1-3/.
+// The folders are flat there, so they're named by their paths. The items
+// are ordered & paged by their ids.
+
+const nextcloudVersion = "25.0.0"
+
+// Item types of the queries.
+const (
+	nextcloudFeed    = 0
+	nextcloudFolder  = 1
+	nextcloudStarred = 2
+	nextcloudAll     = 3
+)
+
+var nextcloudActions = []string{"read", "unread", "star", "unstar"}
+
+type NextcloudFolder struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+type NextcloudFeed struct {
+	ID               int64   `json:"id"`
+	Url              string  `json:"url"`
+	Title            string  `json:"title"`
+	FaviconLink      *string `json:"faviconLink"`
+	Added            int64   `json:"added"`
+	NextUpdateTime   *int64  `json:"nextUpdateTime"`
+	FolderID         *int64  `json:"folderId"`
+	UnreadCount      int64   `json:"unreadCount"`
+	Ordering         int     `json:"ordering"`
+	Link             string  `json:"link"`
+	Pinned           bool    `json:"pinned"`
+	UpdateErrorCount int     `json:"updateErrorCount"`
+	LastUpdateError  *string `json:"lastUpdateError"`
+}
+
+type NextcloudItem struct {
+	ID               int64   `json:"id"`
+	GUID             string  `json:"guid"`
+	GUIDHash         string  `json:"guidHash"`
+	Url              string  `json:"url"`
+	Title            string  `json:"title"`
+	Author           string  `json:"author"`
+	PubDate          int64   `json:"pubDate"`
+	UpdatedDate      int64   `json:"updatedDate"`
+	Body             string  `json:"body"`
+	EnclosureMime    *string `json:"enclosureMime"`
+	EnclosureLink    *string `json:"enclosureLink"`
+	MediaThumbnail   *string `json:"mediaThumbnail"`
+	MediaDescription *string `json:"mediaDescription"`
+	FeedID           int64   `json:"feedId"`
+	Unread           bool    `json:"unread"`
+	Starred          bool    `json:"starred"`
+	Rtl              bool    `json:"rtl"`
+	LastModified     int64   `json:"lastModified"`
+	Fingerprint      string  `json:"fingerprint"`
+	ContentHash      string  `json:"contentHash"`
+}
+
+type NextcloudFolderForm struct {
+	Name string `json:"name"`
+}
+
+type NextcloudFeedCreateForm struct {
+	Url      string `json:"url"`
+	FolderID *int64 `json:"folderId"`
+}
+
+type NextcloudFeedMoveForm struct {
+	FolderID *int64 `json:"folderId"`
+}
+
+type NextcloudFeedRenameForm struct {
+	FeedTitle string `json:"feedTitle"`
+}
+
+type NextcloudReadForm struct {
+	NewestItemID int64 `json:"newestItemId"`
+}
+
+type NextcloudItemsForm struct {
+	ItemIDs []int64 `json:"itemIds"`
+}
+
+func nextcloudError(c *router.Context, status int, message string) {
+	c.JSON(status, map[string]string{"message": message})
+}
+
+// Authenticates the request with HTTP basic auth, see basicAuth.
+func (s *Server) nextcloudAuth(c *router.Context) {
+	if !s.authEnabled() {
+		c.UserID = storage.DefaultUserId
+		c.Next()
+		return
+	}
+	if !s.basicAuth(c, "nextcloud") {
+		c.Out.Header().Set("WWW-Authenticate", `Basic realm="readn"`)
+		nextcloudError(c, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if !auth.ScopeAllows(c.Scope, auth.ScopeWrite) && auth.UnsafeMethod(c.Req.Method) {
+		nextcloudError(c, http.StatusForbidden, "Forbidden")
+		return
+	}
+	c.Next()
+}
+
+func (s *Server) handleNextcloudVersion(c *router.Context) {
+	c.JSON(http.StatusOK, map[string]string{"version": nextcloudVersion})
+}
+
+func (s *Server) handleNextcloudStatus(c *router.Context) {
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"version": nextcloudVersion,
+		"warnings": map[string]bool{
+			"improperlyConfiguredCron": false,
+			"incorrectDbCharset":       false,
+		},
+	})
+}
+
+func (s *Server) handleNextcloudUser(c *router.Context) {
+	user := s.db.GetUser(c.UserID)
+	if user == nil {
+		nextcloudError(c, http.StatusNotFound, "User not found")
+		return
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"userId":             user.Username,
+		"displayName":        user.Username,
+		"lastLoginTimestamp": 0,
+		"avatar":             nil,
+	})
+}
+
+func (s *Server) handleNextcloudFolderList(c *router.Context) {
+	db := s.userDB(c)
+	folders := db.ListFolders()
+	paths := storage.FolderPaths(folders)
+	result := make([]NextcloudFolder, len(folders))
+	for i, folder := range folders {
+		result[i] = NextcloudFolder{ID: folder.Id, Name: paths[folder.Id]}
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{"folders": result})
+}
+
+func (s *Server) handleNextcloudFolderCreate(c *router.Context) {
+	db := s.userDB(c)
+	var form NextcloudFolderForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&form); err != nil || strings.Trim(form.Name, "/ ") == "" {
+		nextcloudError(c, http.StatusUnprocessableEntity, "The folder name is invalid")
+		return
+	}
+	if folderByPath(db, form.Name, false) != nil {
+		nextcloudError(c, http.StatusConflict, "The folder exists already")
+		return
+	}
+	folderId := folderByPath(db, form.Name, true)
+	if folderId == nil {
+		c.Out.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	paths := storage.FolderPaths(db.ListFolders())
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"folders": []NextcloudFolder{{ID: *folderId, Name: paths[*folderId]}},
+	})
+}
+
+// Renames the folder, keeping it where it is: only the last part of the path is used.
+func (s *Server) handleNextcloudFolderRename(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil || db.GetFolder(id) == nil {
+		nextcloudError(c, http.StatusNotFound, "Folder not found")
+		return
+	}
+	var form NextcloudFolderForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&form); err != nil {
+		nextcloudError(c, http.StatusUnprocessableEntity, "The folder name is invalid")
+		return
+	}
+	parts := strings.Split(strings.Trim(form.Name, "/"), "/")
+	name := strings.TrimSpace(parts[len(parts)-1])
+	if name == "" {
+		nextcloudError(c, http.StatusUnprocessableEntity, "The folder name is invalid")
+		return
+	}
+	if !db.RenameFolder(id, name) {
+		nextcloudError(c, http.StatusConflict, "The folder exists already")
+		return
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{})
+}
+
+func (s *Server) handleNextcloudFolderDelete(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil || db.GetFolder(id) == nil {
+		nextcloudError(c, http.StatusNotFound, "Folder not found")
+		return
+	}
+	db.DeleteFolder(id)
+	c.JSON(http.StatusOK, map[string]interface{}{})
+}
+
+// Returns the id of the newest item, ordering by the ids.
+func nextcloudNewestItemID(db *storage.Storage) *int64 {
+	maxId := int64(math.MaxInt64)
+	items := db.ListItems(storage.ItemFilter{MaxID: &maxId}, 1, true, false)
+	if len(items) == 0 {
+		return nil
+	}
+	return &items[0].Id
+}
+
+func (s *Server) nextcloudFeeds(db *storage.Storage, feeds []storage.Feed) []NextcloudFeed {
+	unread := make(map[int64]int64)
+	for _, stat := range db.FeedStats() {
+		unread[stat.FeedId] = stat.UnreadCount
+	}
+	errors := db.GetFeedErrors()
+	result := make([]NextcloudFeed, len(feeds))
+	for i, feed := range feeds {
+		result[i] = NextcloudFeed{
+			ID:          feed.Id,
+			Url:         feed.FeedLink,
+			Title:       feed.Title,
+			FolderID:    feed.FolderId,
+			UnreadCount: unread[feed.Id],
+			Link:        feed.Link,
+		}
+		if err, ok := errors[feed.Id]; ok {
+			result[i].UpdateErrorCount = 1
+			result[i].LastUpdateError = &err
+		}
+	}
+	return result
+}
+
+func (s *Server) handleNextcloudFeedList(c *router.Context) {
+	db := s.userDB(c)
+	starred := storage.STARRED
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"feeds":        s.nextcloudFeeds(db, db.ListFeeds()),
+		"starredCount": db.CountItems(storage.ItemFilter{Status: &starred}),
+		"newestItemId": nextcloudNewestItemID(db),
+	})
+}
+
+func (s *Server) handleNextcloudFeedCreate(c *router.Context) {
+	db := s.userDB(c)
+	var form NextcloudFeedCreateForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&form); err != nil || form.Url == "" {
+		nextcloudError(c, http.StatusUnprocessableEntity, "The feed url is invalid")
+		return
+	}
+	for _, feed := range db.ListFeeds() {
+		if feed.FeedLink == form.Url {
+			nextcloudError(c, http.StatusConflict, "The feed exists already")
+			return
+		}
+	}
+	folderId := form.FolderID
+	if folderId != nil && *folderId == 0 {
+		folderId = nil
+	}
+	if folderId != nil && db.GetFolder(*folderId) == nil {
+		nextcloudError(c, http.StatusUnprocessableEntity, "The folder does not exist")
+		return
+	}
+	result, err := worker.DiscoverFeed(form.Url)
+	if err != nil || result.Feed == nil {
+		slog.Warn("failed to discover feed", "url", form.Url, "err", err)
+		nextcloudError(c, http.StatusUnprocessableEntity, "No feed found at the url")
+		return
+	}
+	feed := s.worker.CreateFeed(c.UserID, result, folderId)
+	if feed == nil {
+		c.Out.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"feeds":        s.nextcloudFeeds(db, []storage.Feed{*feed}),
+		"newestItemId": nextcloudNewestItemID(db),
+	})
+}
+
+func (s *Server) handleNextcloudFeedDelete(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil || db.GetFeed(id) == nil {
+		nextcloudError(c, http.StatusNotFound, "Feed not found")
+		return
+	}
+	db.DeleteFeed(id)
+	c.JSON(http.StatusOK, map[string]interface{}{})
+}
+
+func (s *Server) handleNextcloudFeedMove(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil || db.GetFeed(id) == nil {
+		nextcloudError(c, http.StatusNotFound, "Feed not found")
+		return
+	}
+	var form NextcloudFeedMoveForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&form); err != nil {
+		nextcloudError(c, http.StatusUnprocessableEntity, "Invalid request body")
+		return
+	}
+	folderId := form.FolderID
+	if folderId != nil && *folderId == 0 {
+		folderId = nil
+	}
+	if folderId != nil && db.GetFolder(*folderId) == nil {
+		nextcloudError(c, http.StatusNotFound, "Folder not found")
+		return
+	}
+	db.UpdateFeedFolder(id, folderId)
+	c.JSON(http.StatusOK, map[string]interface{}{})
+}
+
+func (s *Server) handleNextcloudFeedRename(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil || db.GetFeed(id) == nil {
+		nextcloudError(c, http.StatusNotFound, "Feed not found")
+		return
+	}
+	var form NextcloudFeedRenameForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&form); err != nil || form.FeedTitle == "" {
+		nextcloudError(c, http.StatusUnprocessableEntity, "The feed title is invalid")
+		return
+	}
+	db.RenameFeed(id, form.FeedTitle)
+	c.JSON(http.StatusOK, map[string]interface{}{})
+}
+
+// Marks the items of the feed, the folder or all of them read,
+// up to the newest item the client knows of.
+func (s *Server) handleNextcloudMarkRead(c *router.Context) {
+	db := s.userDB(c)
+	var form NextcloudReadForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&form); err != nil || form.NewestItemID <= 0 {
+		nextcloudError(c, http.StatusUnprocessableEntity, "The newest item id is invalid")
+		return
+	}
+	maxId := form.NewestItemID + 1
+	filter := storage.MarkFilter{MaxID: &maxId}
+	id, err := c.VarInt64("id")
+	switch {
+	case strings.Contains(c.Route, "/folders/"):
+		if err != nil || db.GetFolder(id) == nil {
+			nextcloudError(c, http.StatusNotFound, "Folder not found")
+			return
+		}
+		filter.FolderID = &id
+	case strings.Contains(c.Route, "/feeds/"):
+		if err != nil || db.GetFeed(id) == nil {
+			nextcloudError(c, http.StatusNotFound, "Feed not found")
+			return
+		}
+		filter.FeedID = &id
+	}
+	if !db.MarkItemsRead(filter) {
+		c.Out.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{})
+}
+
+func nextcloudItems(items []storage.Item) []NextcloudItem {
+	result := make([]NextcloudItem, len(items))
+	for i, item := range items {
+		guidHash := fmt.Sprintf("%x", md5.Sum([]byte(item.GUID)))
+		result[i] = NextcloudItem{
+			ID:           item.Id,
+			GUID:         item.GUID,
+			GUIDHash:     guidHash,
+			Url:          item.Link,
+			Title:        item.Title,
+			Author:       item.Author,
+			PubDate:      item.Date.Unix(),
+			UpdatedDate:  item.Date.Unix(),
+			Body:         item.Content,
+			FeedID:       item.FeedId,
+			Unread:       item.Status == storage.UNREAD,
+			Starred:      item.Status == storage.STARRED,
+			LastModified: item.LastModified.Unix(),
+			Fingerprint:  guidHash,
+			ContentHash:  fmt.Sprintf("%x", md5.Sum([]byte(item.Title+item.Link+item.Content))),
+		}
+		if len(item.MediaLinks) > 0 {
+			media := item.MediaLinks[0]
+			result[i].EnclosureLink = &media.URL
+			result[i].EnclosureMime = &media.Type
+		}
+	}
+	return result
+}
+
+// Fills in the item filter for the `type` & `id` of the query.
+// Reports false if there's no such feed or folder.
+func nextcloudItemFilter(c *router.Context, db *storage.Storage, filter *storage.ItemFilter) bool {
+	query := c.Req.URL.Query()
+	itemType := nextcloudAll
+	if t, err := strconv.Atoi(query.Get("type")); err == nil {
+		itemType = t
+	}
+	id, _ := strconv.ParseInt(query.Get("id"), 10, 64)
+	switch itemType {
+	case nextcloudFeed:
+		if db.GetFeed(id) == nil {
+			return false
+		}
+		filter.FeedID = &id
+	case nextcloudFolder:
+		if db.GetFolder(id) == nil {
+			return false
+		}
+		filter.FolderID = &id
+	case nextcloudStarred:
+		status := storage.STARRED
+		filter.Status = &status
+	}
+	return true
+}
+
+func (s *Server) handleNextcloudItemList(c *router.Context) {
+	db := s.userDB(c)
+	var filter storage.ItemFilter
+	if !nextcloudItemFilter(c, db, &filter) {
+		nextcloudError(c, http.StatusNotFound, "Feed or folder not found")
+		return
+	}
+	query := c.Req.URL.Query()
+	if query.Get("getRead") == "false" && filter.Status == nil {
+		status := storage.UNREAD
+		filter.Status = &status
+	}
+	limit := math.MaxInt32
+	if n, err := strconv.Atoi(query.Get("batchSize")); err == nil && n > 0 {
+		limit = n
+	}
+	// the items are paged by the id of the last one the client got,
+	// the id filters order the items by their ids as well
+	offset, _ := strconv.ParseInt(query.Get("offset"), 10, 64)
+	oldestFirst := query.Get("oldestFirst") == "true"
+	switch {
+	case oldestFirst:
+		filter.SinceID = &offset
+	case offset > 0:
+		filter.MaxID = &offset
+	default:
+		maxId := int64(math.MaxInt64)
+		filter.MaxID = &maxId
+	}
+	items := db.ListItems(filter, limit, !oldestFirst, true)
+	c.JSON(http.StatusOK, map[string]interface{}{"items": nextcloudItems(items)})
+}
+
+// Returns the items that arrived or changed their status since `lastModified`,
+// given in seconds or microseconds.
+func (s *Server) handleNextcloudUpdatedItems(c *router.Context) {
+	db := s.userDB(c)
+	var filter storage.ItemFilter
+	if !nextcloudItemFilter(c, db, &filter) {
+		nextcloudError(c, http.StatusNotFound, "Feed or folder not found")
+		return
+	}
+	lastModified, err := strconv.ParseInt(c.Req.URL.Query().Get("lastModified"), 10, 64)
+	if err != nil {
+		nextcloudError(c, http.StatusUnprocessableEntity, "The last modification time is invalid")
+		return
+	}
+	since := time.Unix(lastModified, 0)
+	if len(strconv.FormatInt(lastModified, 10)) > 10 {
+		since = time.UnixMicro(lastModified)
+	}
+	filter.ModifiedSince = &since
+	sinceId := int64(0)
+	filter.SinceID = &sinceId
+	items := db.ListItems(filter, math.MaxInt32, false, true)
+	c.JSON(http.StatusOK, map[string]interface{}{"items": nextcloudItems(items)})
+}
+
+// Sets the status of the items. The starred items stay starred
+// when marked read or unread, unstarring them leaves them read.
+func (s *Server) nextcloudUpdateItems(db *storage.Storage, ids []int64, action string) {
+	if len(ids) == 0 {
+		return
+	}
+	for _, item := range db.ListItems(storage.ItemFilter{IDs: &ids}, len(ids), false, false) {
+		status := item.Status
+		switch action {
+		case "read":
+			if status == storage.UNREAD {
+				status = storage.READ
+			}
+		case "unread":
+			if status == storage.READ {
+				status = storage.UNREAD
+			}
+		case "star":
+			status = storage.STARRED
+		case "unstar":
+			if status == storage.STARRED {
+				status = storage.READ
+			}
+		}
+		if status != item.Status {
+			db.UpdateItemStatus(item.Id, status)
+		}
+	}
+}
+
+func (s *Server) handleNextcloudItemUpdate(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil || db.GetItem(id) == nil || !slices.Contains(nextcloudActions, c.Vars["action"]) {
+		nextcloudError(c, http.StatusNotFound, "Item not found")
+		return
+	}
+	s.nextcloudUpdateItems(db, []int64{id}, c.Vars["action"])
+	c.JSON(http.StatusOK, map[string]interface{}{})
+}
+
+func (s *Server) handleNextcloudItemsUpdate(c *router.Context) {
+	db := s.userDB(c)
+	if !slices.Contains(nextcloudActions, c.Vars["action"]) {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	var form NextcloudItemsForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&form); err != nil {
+		nextcloudError(c, http.StatusUnprocessableEntity, "Invalid request body")
+		return
+	}
+	s.nextcloudUpdateItems(db, form.ItemIDs, c.Vars["action"])
+	c.JSON(http.StatusOK, map[string]interface{}{})
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"github.com/thang-qt/Readn/src/server/opml"
+	"github.com/thang-qt/Readn/src/storage"
+)
+
+// Creates the folders & feeds listed in the document.
+// Existing folders & feeds are reused.
+func ImportOPML(db *storage.Storage, doc opml.Folder) {
+	for _, f := range doc.Feeds {
+		db.CreateFeed(f.Title, "", f.SiteUrl, f.FeedUrl, nil)
+	}
+	for _, f := range doc.Folders {
+		importOPMLFolder(db, f, nil)
+	}
+}
+
+func importOPMLFolder(db *storage.Storage, f opml.Folder, parentId *int64) {
+	folder := db.CreateFolder(f.Title, parentId)
+	if folder == nil {
+		return
+	}
+	for _, ff := range f.Feeds {
+		db.CreateFeed(ff.Title, "", ff.SiteUrl, ff.FeedUrl, &folder.Id)
+	}
+	for _, subfolder := range f.Folders {
+		importOPMLFolder(db, subfolder, &folder.Id)
+	}
+}
+
+// Lists all subscriptions, including empty folders.
+func ExportOPML(db *storage.Storage) opml.Folder {
+	doc := opml.Folder{}
+
+	feedsByFolderID := make(map[int64][]storage.Feed)
+	for _, feed := range db.ListFeeds() {
+		if feed.IsSaved() {
+			continue
+		}
+		if feed.FolderId == nil {
+			doc.Feeds = append(doc.Feeds, opmlFeed(feed))
+		} else {
+			id := *feed.FolderId
+			feedsByFolderID[id] = append(feedsByFolderID[id], feed)
+		}
+	}
+
+	roots := make([]storage.Folder, 0)
+	foldersByParentID := make(map[int64][]storage.Folder)
+	for _, folder := range db.ListFolders() {
+		if folder.ParentId == nil {
+			roots = append(roots, folder)
+		} else {
+			id := *folder.ParentId
+			foldersByParentID[id] = append(foldersByParentID[id], folder)
+		}
+	}
+	for _, folder := range roots {
+		doc.Folders = append(doc.Folders, exportOPMLFolder(folder, foldersByParentID, feedsByFolderID))
+	}
+	return doc
+}
+
+func opmlFeed(feed storage.Feed) opml.Feed {
+	return opml.Feed{
+		Title:   feed.Title,
+		FeedUrl: feed.FeedLink,
+		SiteUrl: feed.Link,
+	}
+}
+
+func exportOPMLFolder(folder storage.Folder, foldersByParentID map[int64][]storage.Folder, feedsByFolderID map[int64][]storage.Feed) opml.Folder {
+	result := opml.Folder{Title: folder.Title}
+	for _, subfolder := range foldersByParentID[folder.Id] {
+		result.Folders = append(result.Folders, exportOPMLFolder(subfolder, foldersByParentID, feedsByFolderID))
+	}
+	for _, feed := range feedsByFolderID[folder.Id] {
+		result.Feeds = append(result.Feeds, opmlFeed(feed))
+	}
+	return result
+}
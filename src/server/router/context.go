@@ -14,6 +14,15 @@ type Context struct {
 	Out http.ResponseWriter
 
 	Vars map[string]string
+	// pattern of the matched route, e.g. `/api/feeds/:id`
+	Route string
+	// set by the auth middleware
+	User   string
+	UserID int64
+	// scope of the API token, empty for the login sessions
+	Scope string
+
+	writer *statusWriter
 
 	chain []Handler
 	index int
@@ -24,6 +33,14 @@ func (c *Context) Next() {
 	c.chain[c.index](c)
 }
 
+// Status code of the response written so far (200 if none).
+func (c *Context) Status() int {
+	if c.writer == nil || c.writer.status == 0 {
+		return http.StatusOK
+	}
+	return c.writer.status
+}
+
 func (c *Context) JSON(status int, data interface{}) {
 	body, err := json.Marshal(data)
 	if err != nil {
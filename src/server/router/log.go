@@ -0,0 +1,46 @@
+package router
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// Records the status code of the response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Logs method, path, status, duration & user of the request.
+func Logger(c *Context) {
+	start := time.Now()
+	c.Next()
+	slog.LogAttrs(c.Req.Context(), slog.LevelInfo, "request",
+		slog.String("method", c.Req.Method),
+		slog.String("path", c.Req.URL.Path),
+		slog.Int("status", c.Status()),
+		slog.Duration("duration", time.Since(start)),
+		slog.String("user", c.User),
+	)
+}
@@ -3,52 +3,133 @@ package router
 import (
 	"net/http"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
 )
 
 type Handler func(*Context)
 
 type Router struct {
-	middle []Handler
+	RouteGroup
 	routes []Route
 	base   string
 }
 
 type Route struct {
-	regex *regexp.Regexp
-	chain []Handler
+	path   string
+	method string // empty for any method
+	regex  *regexp.Regexp
+	chain  []Handler
+}
+
+// Routes sharing a path prefix & middleware. Middleware applies
+// to the routes registered after it, including those of the subgroups.
+type RouteGroup struct {
+	router *Router
+	prefix string
+	middle []Handler
 }
 
 func NewRouter(base string) *Router {
 	router := &Router{}
-	router.middle = make([]Handler, 0)
+	router.RouteGroup = RouteGroup{router: router, middle: make([]Handler, 0)}
 	router.routes = make([]Route, 0)
 	router.base = base
 	return router
 }
 
-func (r *Router) Use(h Handler) {
-	r.middle = append(r.middle, h)
+func (g *RouteGroup) Group(prefix string) *RouteGroup {
+	middle := make([]Handler, len(g.middle))
+	copy(middle, g.middle)
+	return &RouteGroup{router: g.router, prefix: g.prefix + prefix, middle: middle}
+}
+
+func (g *RouteGroup) Use(h Handler) {
+	g.middle = append(g.middle, h)
+}
+
+// Registers the handler for all methods.
+func (g *RouteGroup) For(path string, handler Handler) {
+	g.Handle("", path, handler)
+}
+
+func (g *RouteGroup) Get(path string, handler Handler) {
+	g.Handle(http.MethodGet, path, handler)
+}
+
+func (g *RouteGroup) Post(path string, handler Handler) {
+	g.Handle(http.MethodPost, path, handler)
+}
+
+func (g *RouteGroup) Put(path string, handler Handler) {
+	g.Handle(http.MethodPut, path, handler)
+}
+
+func (g *RouteGroup) Patch(path string, handler Handler) {
+	g.Handle(http.MethodPatch, path, handler)
+}
+
+func (g *RouteGroup) Delete(path string, handler Handler) {
+	g.Handle(http.MethodDelete, path, handler)
 }
 
-func (r *Router) For(path string, handler Handler) {
+func (g *RouteGroup) Handle(method, path string, handler Handler) {
 	chain := make([]Handler, 0)
-	chain = append(chain, r.middle...)
+	chain = append(chain, g.middle...)
 	chain = append(chain, handler)
 
 	x := Route{}
-	x.regex = routeRegexp(path)
+	x.path = g.prefix + path
+	x.method = method
+	x.regex = routeRegexp(x.path)
 	x.chain = chain
-	r.routes = append(r.routes, x)
+	g.router.routes = append(g.router.routes, x)
+}
+
+func (route *Route) allows(method string) bool {
+	return route.method == "" || route.method == method ||
+		(method == http.MethodHead && route.method == http.MethodGet)
 }
 
-func (r *Router) resolve(path string) *Route {
+// The first route matching the path determines the pattern,
+// the routes registered for it are then matched by method.
+// If none matches the method, the first route is returned
+// together with the allowed methods.
+func (r *Router) resolve(method, path string) (*Route, []string) {
+	var first *Route
+	for i := range r.routes {
+		route := &r.routes[i]
+		if first == nil && route.regex.MatchString(path) {
+			first = route
+		}
+		if first != nil && route.path == first.path && route.allows(method) {
+			return route, nil
+		}
+	}
+	if first == nil {
+		return nil, nil
+	}
+	allowed := make([]string, 0)
+	for _, route := range r.routes {
+		if route.path == first.path && !slices.Contains(allowed, route.method) {
+			allowed = append(allowed, route.method)
+			if route.method == http.MethodGet {
+				allowed = append(allowed, http.MethodHead)
+			}
+		}
+	}
+	sort.Strings(allowed)
+	return first, allowed
+}
+
+func (r *Router) matches(path string) bool {
 	for _, route := range r.routes {
 		if route.regex.MatchString(path) {
-			return &route
+			return true
 		}
 	}
-	return nil
+	return false
 }
 
 func (r *Router) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
@@ -66,17 +147,43 @@ func (r *Router) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 
 	path := strings.TrimPrefix(req.URL.Path, r.base)
 
-	route := r.resolve(path)
+	route, allowed := r.resolve(req.Method, path)
 	if route == nil {
+		// redirect to the same path with (or without) the trailing slash
+		alt := path + "/"
+		if strings.HasSuffix(path, "/") {
+			alt = strings.TrimSuffix(path, "/")
+		}
+		if alt != "" && r.matches(alt) {
+			url := *req.URL
+			url.Path = r.base + alt
+			status := http.StatusMovedPermanently
+			if req.Method != http.MethodGet && req.Method != http.MethodHead {
+				status = http.StatusPermanentRedirect
+			}
+			http.Redirect(rw, req, url.String(), status)
+			return
+		}
 		rw.WriteHeader(http.StatusNotFound)
 		return
 	}
 
+	chain := route.chain
+	if allowed != nil {
+		// keep the middleware (auth, logging) of the route
+		chain = append(chain[:len(chain)-1:len(chain)-1], func(c *Context) {
+			c.Out.Header().Set("Allow", strings.Join(allowed, ", "))
+			c.Out.WriteHeader(http.StatusMethodNotAllowed)
+		})
+	}
+
 	context := &Context{}
 	context.Req = req
-	context.Out = rw
+	context.writer = &statusWriter{ResponseWriter: rw}
+	context.Out = context.writer
 	context.Vars = regexGroups(path, route.regex)
+	context.Route = route.path
 	context.index = -1
-	context.chain = route.chain
+	context.chain = chain
 	context.Next()
 }
@@ -3,6 +3,7 @@ package router
 import (
 	"io"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -158,3 +159,146 @@ func TestRouterBaseRedirect(t *testing.T) {
 		t.Errorf("expected 302, got %d", recorder.Result().StatusCode)
 	}
 }
+
+func TestRouterStatus(t *testing.T) {
+	status := 0
+	router := NewRouter("")
+	router.Use(func(c *Context) {
+		c.Next()
+		status = c.Status()
+	})
+	router.For("/missing", func(c *Context) {
+		c.Out.WriteHeader(404)
+	})
+	router.For("/ok", func(c *Context) {
+		c.Out.Write([]byte("ok"))
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+	if status != 404 {
+		t.Errorf("expected 404, got %d", status)
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/ok", nil))
+	if status != 200 {
+		t.Errorf("expected 200, got %d", status)
+	}
+}
+
+func TestRouterMethods(t *testing.T) {
+	router := NewRouter("")
+	router.Get("/items/:id", func(c *Context) {
+		c.Out.Write([]byte("get " + c.Vars["id"]))
+	})
+	router.Put("/items/:id", func(c *Context) {
+		c.Out.Write([]byte("put " + c.Vars["id"]))
+	})
+	router.For("/any", func(c *Context) {
+		c.Out.Write([]byte(c.Req.Method))
+	})
+
+	for _, test := range []struct {
+		method, path string
+		status       int
+		body         string
+	}{
+		{"GET", "/items/1", 200, "get 1"},
+		{"HEAD", "/items/1", 200, ""},
+		{"PUT", "/items/1", 200, "put 1"},
+		{"DELETE", "/items/1", 405, ""},
+		{"DELETE", "/any", 200, "DELETE"},
+	} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(test.method, test.path, nil))
+		if recorder.Code != test.status {
+			t.Errorf("%s %s: expected %d, got %d", test.method, test.path, test.status, recorder.Code)
+		}
+		if test.method != "HEAD" && recorder.Body.String() != test.body {
+			t.Errorf("%s %s: expected %q, got %q", test.method, test.path, test.body, recorder.Body.String())
+		}
+		if test.status == 405 && recorder.Header().Get("Allow") != "GET, HEAD, PUT" {
+			t.Errorf("invalid Allow header: %q", recorder.Header().Get("Allow"))
+		}
+	}
+}
+
+func TestRouterMethodNotAllowedMiddleware(t *testing.T) {
+	router := NewRouter("")
+	router.Use(func(c *Context) {
+		c.Out.WriteHeader(401)
+	})
+	router.Get("/secret", func(c *Context) {
+		c.Out.Write([]byte("secret"))
+	})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("POST", "/secret", nil))
+	if recorder.Code != 401 {
+		t.Errorf("expected middleware to run before 405, got %d", recorder.Code)
+	}
+}
+
+func TestRouterFirstPatternWins(t *testing.T) {
+	router := NewRouter("")
+	router.Post("/feeds/refresh", func(c *Context) {
+		c.Out.Write([]byte("refresh"))
+	})
+	router.Get("/feeds/:id", func(c *Context) {
+		c.Out.Write([]byte("feed"))
+	})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/feeds/refresh", nil))
+	if recorder.Code != 405 || recorder.Header().Get("Allow") != "POST" {
+		t.Errorf("expected 405 allowing POST, got %d %q", recorder.Code, recorder.Header().Get("Allow"))
+	}
+}
+
+func TestRouterGroup(t *testing.T) {
+	calls := make([]string, 0)
+	router := NewRouter("")
+	router.Use(func(c *Context) {
+		calls = append(calls, "root")
+		c.Next()
+	})
+	api := router.Group("/api")
+	api.Use(func(c *Context) {
+		calls = append(calls, "api")
+		c.Next()
+	})
+	api.Get("/items", func(c *Context) {
+		c.Out.Write([]byte(c.Route))
+	})
+	router.Get("/page", func(c *Context) {})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/api/items", nil))
+	if recorder.Body.String() != "/api/items" {
+		t.Errorf("invalid body, got %q", recorder.Body.String())
+	}
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/page", nil))
+	if strings.Join(calls, " ") != "root api root" {
+		t.Errorf("invalid middleware calls: %v", calls)
+	}
+}
+
+func TestRouterTrailingSlash(t *testing.T) {
+	router := NewRouter("/base")
+	router.Get("/items", func(c *Context) {})
+	router.For("/fever/", func(c *Context) {})
+
+	for _, test := range []struct {
+		method, url, location string
+		status                int
+	}{
+		{"GET", "/base/items/?page=2", "/base/items?page=2", 301},
+		{"POST", "/base/fever?api", "/base/fever/?api", 308},
+	} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(test.method, test.url, nil))
+		if recorder.Code != test.status || recorder.Header().Get("Location") != test.location {
+			t.Errorf("%s %s: expected %d to %s, got %d to %s",
+				test.method, test.url, test.status, test.location,
+				recorder.Code, recorder.Header().Get("Location"))
+		}
+	}
+}
@@ -5,14 +5,16 @@ import (
 	"crypto/md5"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/thang-qt/Readn/src/assets"
 	"github.com/thang-qt/Readn/src/content/discussion"
@@ -20,6 +22,7 @@ import (
 	"github.com/thang-qt/Readn/src/content/htmlutil"
 	"github.com/thang-qt/Readn/src/content/readability"
 	"github.com/thang-qt/Readn/src/content/sanitizer"
+	"github.com/thang-qt/Readn/src/content/scraper"
 	"github.com/thang-qt/Readn/src/content/silo"
 	"github.com/thang-qt/Readn/src/server/auth"
 	"github.com/thang-qt/Readn/src/server/gzip"
@@ -33,50 +36,202 @@ func (s *Server) handler() http.Handler {
 	r := router.NewRouter(s.BasePath)
 
 	r.Use(gzip.Middleware)
-
-	if s.Username != "" && s.Password != "" {
-		a := &auth.Middleware{
-			BasePath: s.BasePath,
-			Username: s.Username,
-			Password: s.Password,
-			Public:   []string{"/static", "/fever"},
-			DB:       s.db,
-		}
-		r.Use(a.Handler)
-	}
-
-	r.For("/", s.handleIndex)
-	r.For("/manifest.json", s.handleManifest)
-	r.For("/static/*path", s.handleStatic)
-	r.For("/api/status", s.handleStatus)
-	r.For("/api/folders", s.handleFolderList)
-	r.For("/api/folders/:id", s.handleFolder)
-	r.For("/api/feeds", s.handleFeedList)
-	r.For("/api/feeds/refresh", s.handleFeedRefresh)
-	r.For("/api/feeds/errors", s.handleFeedErrors)
-	r.For("/api/feeds/:id/icon", s.handleFeedIcon)
-	r.For("/api/feeds/:id", s.handleFeed)
-	r.For("/api/items", s.handleItemList)
-	r.For("/api/items/:id", s.handleItem)
-	r.For("/api/settings", s.handleSettings)
-	r.For("/opml/import", s.handleOPMLImport)
-	r.For("/opml/export", s.handleOPMLExport)
-	r.For("/page", s.handlePageCrawl)
-	r.For("/api/summarize", s.handleSummarize)
-	r.For("/api/summarize-feed", s.handleFeedSummarize)
-	r.For("/api/chat", s.handleChat)
-	r.For("/api/hackernews", s.handleHackerNews)
-	r.For("/api/lobsters", s.handleLobsters)
-	r.For("/logout", s.handleLogout)
-	r.For("/fever/", s.handleFever)
+	r.Use(router.Logger)
+	r.Use(measureRequest)
+
+	// the client APIs authenticate on their own
+	public := []string{"/static", "/fever", "/accounts/ClientLogin", "/reader/", "/v1/", "/index.php/apps/news/", "/healthz", "/readyz"}
+	if s.MetricsToken != "" {
+		public = append(public, "/metrics")
+	}
+	a := &auth.Middleware{
+		BasePath:   s.BasePath,
+		Enabled:    s.authEnabled,
+		Public:     public,
+		DB:         s.db,
+		AuthHeader: s.AuthHeader,
+		Proxies:    s.trustedProxies(),
+		Limiter:    s.limiter,
+	}
+	r.Use(a.Handler)
+
+	r.Get("/", s.handleIndex)
+	r.Get("/manifest.json", s.handleManifest)
+	r.Get("/static/*path", s.handleStatic)
+	r.Get("/page", s.handlePageCrawl)
+	r.Get("/save", s.handleSaveTarget)
+	r.Post("/save", s.handleSaveTargetConfirm)
+	r.Post("/logout", s.handleLogout)
+	r.Post("/opml/import", s.handleOPMLImport)
+	r.Get("/opml/export", s.handleOPMLExport)
+	r.Get("/fever/", s.handleFever)
+	r.Post("/fever/", s.handleFever)
+	r.Post("/accounts/ClientLogin", s.handleGReaderLogin)
+	r.Get("/metrics", s.handleMetrics)
+	r.Get("/healthz", s.handleHealthz)
+	r.Get("/readyz", s.handleReadyz)
+
+	api := r.Group("/api")
+	api.Get("/status", s.handleStatus)
+	api.Get("/folders", s.handleFolderList)
+	api.Post("/folders", s.handleFolderCreate)
+	api.Put("/folders/:id", s.handleFolderUpdate)
+	api.Delete("/folders/:id", s.handleFolderDelete)
+	api.Get("/feeds", s.handleFeedList)
+	api.Post("/feeds", s.handleFeedCreate)
+	api.Post("/feeds/refresh", s.handleFeedRefresh)
+	api.Get("/feeds/errors", s.handleFeedErrors)
+	api.Get("/feeds/:id/icon", s.handleFeedIcon)
+	api.Put("/feeds/:id", s.handleFeedUpdate)
+	api.Delete("/feeds/:id", s.handleFeedDelete)
+	api.Get("/items", s.handleItemList)
+	api.Put("/items", s.handleItemListUpdate)
+	api.Get("/items/:id/labels", s.handleItemLabels)
+	api.Put("/items/:id/labels", s.handleItemLabelsUpdate)
+	api.Get("/items/:id/notes", s.handleItemNote)
+	api.Put("/items/:id/notes", s.handleItemNoteUpdate)
+	api.Delete("/items/:id/notes", s.handleItemNoteDelete)
+	api.Get("/items/:id/highlights", s.handleItemHighlights)
+	api.Post("/items/:id/highlights", s.handleItemHighlightCreate)
+	api.Get("/items/:id", s.handleItem)
+	api.Put("/items/:id", s.handleItemUpdate)
+	api.Get("/labels", s.handleLabelList)
+	api.Post("/labels", s.handleLabelCreate)
+	api.Put("/labels/:id", s.handleLabelUpdate)
+	api.Delete("/labels/:id", s.handleLabelDelete)
+	api.Get("/highlights", s.handleHighlightList)
+	api.Get("/highlights/export", s.handleHighlightExport)
+	api.Put("/highlights/:id", s.handleHighlightUpdate)
+	api.Delete("/highlights/:id", s.handleHighlightDelete)
+	api.Get("/settings", s.handleSettings)
+	api.Put("/settings", s.handleSettingsUpdate)
+	api.Get("/account", s.handleAccount)
+	api.Post("/saved", s.handleSavedItemCreate)
+	api.Post("/summarize", s.handleSummarize)
+	api.Post("/summarize-feed", s.handleFeedSummarize)
+	api.Post("/chat", s.handleChat)
+	api.Post("/hackernews", s.handleHackerNews)
+	api.Post("/lobsters", s.handleLobsters)
+
+	greader := r.Group("/reader/api/0")
+	greader.Use(s.greaderAuth)
+	greader.Get("/token", s.handleGReaderToken)
+	greader.Get("/user-info", s.handleGReaderUserInfo)
+	greader.Get("/subscription/list", s.handleGReaderSubscriptionList)
+	greader.Post("/subscription/edit", s.handleGReaderSubscriptionEdit)
+	greader.Get("/tag/list", s.handleGReaderTagList)
+	greader.Get("/unread-count", s.handleGReaderUnreadCount)
+	greader.Get("/stream/items/ids", s.handleGReaderStreamIDs)
+	greader.Get("/stream/items/contents", s.handleGReaderItemContents)
+	greader.Post("/stream/items/contents", s.handleGReaderItemContents)
+	greader.Get("/stream/contents", s.handleGReaderStreamContents)
+	greader.Get("/stream/contents/*stream", s.handleGReaderStreamContents)
+	greader.Post("/edit-tag", s.handleGReaderEditTag)
+	greader.Post("/mark-all-as-read", s.handleGReaderMarkAllRead)
+
+	miniflux := r.Group("/v1")
+	miniflux.Use(s.minifluxAuth)
+	miniflux.Get("/me", s.handleMinifluxMe)
+	miniflux.Put("/users/:id/mark-all-as-read", s.handleMinifluxMarkAllRead)
+	miniflux.Get("/categories", s.handleMinifluxCategoryList)
+	miniflux.Post("/categories", s.handleMinifluxCategoryCreate)
+	miniflux.Put("/categories/:id", s.handleMinifluxCategoryUpdate)
+	miniflux.Delete("/categories/:id", s.handleMinifluxCategoryDelete)
+	miniflux.Get("/categories/:id/feeds", s.handleMinifluxFeedList)
+	miniflux.Get("/categories/:id/entries", s.handleMinifluxEntryList)
+	miniflux.Put("/categories/:id/mark-all-as-read", s.handleMinifluxMarkAllRead)
+	miniflux.Put("/categories/:id/refresh", s.handleMinifluxRefresh)
+	miniflux.Get("/feeds", s.handleMinifluxFeedList)
+	miniflux.Post("/feeds", s.handleMinifluxFeedCreate)
+	miniflux.Get("/feeds/counters", s.handleMinifluxCounters)
+	miniflux.Put("/feeds/refresh", s.handleMinifluxRefresh)
+	miniflux.Get("/feeds/:id", s.handleMinifluxFeed)
+	miniflux.Put("/feeds/:id", s.handleMinifluxFeedUpdate)
+	miniflux.Delete("/feeds/:id", s.handleMinifluxFeedDelete)
+	miniflux.Get("/feeds/:id/icon", s.handleMinifluxIcon)
+	miniflux.Get("/feeds/:id/entries", s.handleMinifluxEntryList)
+	miniflux.Get("/feeds/:id/entries/:entry", s.handleMinifluxEntry)
+	miniflux.Put("/feeds/:id/mark-all-as-read", s.handleMinifluxMarkAllRead)
+	miniflux.Put("/feeds/:id/refresh", s.handleMinifluxRefresh)
+	miniflux.Get("/icons/:id", s.handleMinifluxIcon)
+	miniflux.Get("/entries", s.handleMinifluxEntryList)
+	miniflux.Put("/entries", s.handleMinifluxEntriesUpdate)
+	miniflux.Get("/entries/:entry", s.handleMinifluxEntry)
+	miniflux.Put("/entries/:entry/bookmark", s.handleMinifluxBookmark)
+	miniflux.Put("/entries/:entry/star", s.handleMinifluxBookmark)
+
+	nextcloud := r.Group("/index.php/apps/news/api/v1-3")
+	nextcloud.Use(s.nextcloudAuth)
+	nextcloud.Get("/version", s.handleNextcloudVersion)
+	nextcloud.Get("/status", s.handleNextcloudStatus)
+	nextcloud.Get("/user", s.handleNextcloudUser)
+	nextcloud.Get("/folders", s.handleNextcloudFolderList)
+	nextcloud.Post("/folders", s.handleNextcloudFolderCreate)
+	nextcloud.Put("/folders/:id", s.handleNextcloudFolderRename)
+	nextcloud.Delete("/folders/:id", s.handleNextcloudFolderDelete)
+	nextcloud.Get("/feeds", s.handleNextcloudFeedList)
+	nextcloud.Post("/feeds", s.handleNextcloudFeedCreate)
+	nextcloud.Delete("/feeds/:id", s.handleNextcloudFeedDelete)
+	nextcloud.Get("/items", s.handleNextcloudItemList)
+	nextcloud.Get("/items/updated", s.handleNextcloudUpdatedItems)
+	// the clients use either method for the updates
+	for _, method := range []string{http.MethodPost, http.MethodPut} {
+		nextcloud.Handle(method, "/folders/:id/read", s.handleNextcloudMarkRead)
+		nextcloud.Handle(method, "/feeds/:id/move", s.handleNextcloudFeedMove)
+		nextcloud.Handle(method, "/feeds/:id/rename", s.handleNextcloudFeedRename)
+		nextcloud.Handle(method, "/feeds/:id/read", s.handleNextcloudMarkRead)
+		nextcloud.Handle(method, "/items/read", s.handleNextcloudMarkRead)
+		nextcloud.Handle(method, "/items/:action/multiple", s.handleNextcloudItemsUpdate)
+		nextcloud.Handle(method, "/items/:id/:action", s.handleNextcloudItemUpdate)
+	}
+
+	// the credentials are out of reach of the read & write tokens
+	account := api.Group("/account")
+	account.Use(s.requireAccountScope)
+	account.Put("/fever", s.handleAccountFeverUpdate)
+	account.Post("/totp", s.handleTOTPSetup)
+	account.Post("/totp/confirm", s.handleTOTPConfirm)
+	account.Delete("/totp", s.handleTOTPDisable)
+	account.Get("/sessions", s.handleSessionList)
+	account.Delete("/sessions", s.handleSessionListDelete)
+	account.Delete("/sessions/:id", s.handleSessionDelete)
+	account.Get("/tokens", s.handleAPITokenList)
+	account.Post("/tokens", s.handleAPITokenCreate)
+	account.Delete("/tokens/:id", s.handleAPITokenDelete)
+
+	admin := api.Group("")
+	admin.Use(s.requireAdmin)
+	admin.Get("/feeds/:id/retention", s.handleFeedRetention)
+	admin.Put("/feeds/:id/retention", s.handleFeedRetentionUpdate)
+	admin.Get("/retention", s.handleRetentionReport)
+	admin.Get("/backup", s.handleBackup)
+	admin.Get("/users", s.handleUserList)
+	admin.Post("/users", s.handleUserCreate)
+	admin.Put("/users/:id", s.handleUserUpdate)
+	admin.Get("/lockouts", s.handleLockoutList)
 
 	return r
 }
 
 func (s *Server) handleIndex(c *router.Context) {
+	db := s.userDB(c)
+	settings := db.GetSettings()
+	isAdmin := s.isAdmin(c)
+	lockedSettings := db.LockedSettings()
+	if !isAdmin {
+		// the instance-wide settings are up to the admins
+		for key := range settings {
+			if storage.IsGlobalSetting(key) && !slices.Contains(lockedSettings, key) {
+				lockedSettings = append(lockedSettings, key)
+			}
+		}
+	}
 	c.HTML(http.StatusOK, assets.Template("index.html"), map[string]interface{}{
-		"settings":      s.db.GetSettings(),
-		"authenticated": s.Username != "" && s.Password != "",
+		"settings":        settings,
+		"authenticated":   s.authEnabled(),
+		"is_admin":        isAdmin,
+		"csrf_token":      auth.CSRFToken(c.Out, c.Req, s.BasePath),
+		"locked_settings": lockedSettings,
 	})
 }
 
@@ -98,6 +253,15 @@ func (s *Server) handleManifest(c *router.Context) {
 		"description": "ReadN - A minimal, yet featureful feed reader",
 		"display":     "standalone",
 		"start_url":   "/" + strings.TrimPrefix(s.BasePath, "/"),
+		"share_target": map[string]interface{}{
+			"action": s.BasePath + "/save",
+			"method": "GET",
+			"params": map[string]string{
+				"title": "title",
+				"text":  "text",
+				"url":   "url",
+			},
+		},
 		"icons": []map[string]interface{}{
 			{
 				"src":   s.BasePath + "/static/graphicarts/favicon.png",
@@ -109,71 +273,91 @@ func (s *Server) handleManifest(c *router.Context) {
 }
 
 func (s *Server) handleStatus(c *router.Context) {
+	db := s.userDB(c)
 	c.JSON(http.StatusOK, map[string]interface{}{
-		"running": s.worker.FeedsPending(),
-		"stats":   s.db.FeedStats(),
+		"running":      s.worker.FeedsPending(),
+		"stats":        db.FeedStats(),
+		"folder_stats": db.FolderStats(),
 	})
 }
 
 func (s *Server) handleFolderList(c *router.Context) {
-	if c.Req.Method == "GET" {
-		list := s.db.ListFolders()
-		c.JSON(http.StatusOK, list)
-	} else if c.Req.Method == "POST" {
-		var body FolderCreateForm
-		if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
-			log.Print(err)
-			c.Out.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		if len(body.Title) == 0 {
-			c.JSON(http.StatusBadRequest, map[string]string{"error": "Folder title missing."})
-			return
-		}
-		folder := s.db.CreateFolder(body.Title)
-		c.JSON(http.StatusCreated, folder)
-	} else {
-		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+	db := s.userDB(c)
+	list := db.ListFolders()
+	c.JSON(http.StatusOK, list)
+}
+
+func (s *Server) handleFolderCreate(c *router.Context) {
+	db := s.userDB(c)
+	var body FolderCreateForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+		slog.Debug("invalid request body", "err", err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if len(body.Title) == 0 {
+		c.JSON(http.StatusBadRequest, map[string]string{"error": "Folder title missing."})
+		return
+	}
+	folder := db.CreateFolder(body.Title, body.ParentID)
+	if folder == nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
 	}
+	c.JSON(http.StatusCreated, folder)
 }
 
-func (s *Server) handleFolder(c *router.Context) {
+func (s *Server) handleFolderUpdate(c *router.Context) {
+	db := s.userDB(c)
 	id, err := c.VarInt64("id")
 	if err != nil {
 		c.Out.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	if c.Req.Method == "PUT" {
-		var body FolderUpdateForm
-		if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
-			log.Print(err)
+	var body FolderUpdateForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+		slog.Debug("invalid request body", "err", err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if body.Title != nil {
+		db.RenameFolder(id, *body.Title)
+	}
+	if body.IsExpanded != nil {
+		db.ToggleFolderExpanded(id, *body.IsExpanded)
+	}
+	if len(body.ParentID) > 0 {
+		var parentId *int64
+		if err := json.Unmarshal(body.ParentID, &parentId); err != nil {
 			c.Out.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		if body.Title != nil {
-			s.db.RenameFolder(id, *body.Title)
-		}
-		if body.IsExpanded != nil {
-			s.db.ToggleFolderExpanded(id, *body.IsExpanded)
+		if !db.UpdateFolderParent(id, parentId) {
+			c.JSON(http.StatusBadRequest, map[string]string{"error": "Folder cannot be moved there."})
+			return
 		}
-		c.Out.WriteHeader(http.StatusOK)
-	} else if c.Req.Method == "DELETE" {
-		s.db.DeleteFolder(id)
-		c.Out.WriteHeader(http.StatusNoContent)
 	}
+	c.Out.WriteHeader(http.StatusOK)
 }
 
-func (s *Server) handleFeedRefresh(c *router.Context) {
-	if c.Req.Method == "POST" {
-		s.worker.RefreshFeeds()
-		c.Out.WriteHeader(http.StatusOK)
-	} else {
-		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+func (s *Server) handleFolderDelete(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
 	}
+	db.DeleteFolder(id)
+	c.Out.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleFeedRefresh(c *router.Context) {
+	s.worker.RefreshFeeds()
+	c.Out.WriteHeader(http.StatusOK)
 }
 
 func (s *Server) handleFeedErrors(c *router.Context) {
-	errors := s.db.GetFeedErrors()
+	errors := s.userDB(c).GetFeedErrors()
 	c.JSON(http.StatusOK, errors)
 }
 
@@ -184,18 +368,25 @@ type feedicon struct {
 }
 
 func (s *Server) handleFeedIcon(c *router.Context) {
+	db := s.userDB(c)
 	id, err := c.VarInt64("id")
 	if err != nil {
 		c.Out.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
+	// the cache is shared by the users, the feed isn't
+	if !db.HasFeed(id) {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+
 	cachekey := "icon:" + strconv.FormatInt(id, 10)
 	s.cache_mutex.Lock()
 	cachedat := s.cache[cachekey]
 	s.cache_mutex.Unlock()
 	if cachedat == nil {
-		feed := s.db.GetFeed(id)
+		feed := db.GetFeed(id)
 		if feed == nil || feed.Icon == nil {
 			c.Out.WriteHeader(http.StatusNotFound)
 			return
@@ -228,287 +419,490 @@ func (s *Server) handleFeedIcon(c *router.Context) {
 	c.Out.Write(icon.bytes)
 }
 
-func (s *Server) handleFeedList(c *router.Context) {
-	if c.Req.Method == "GET" {
-		list := s.db.ListFeeds()
-		c.JSON(http.StatusOK, list)
-	} else if c.Req.Method == "POST" {
-		var form FeedCreateForm
-		if err := json.NewDecoder(c.Req.Body).Decode(&form); err != nil {
-			log.Print(err)
-			c.Out.WriteHeader(http.StatusBadRequest)
-			return
+// Returns the id of the folder with the path, creating the missing folders if asked to.
+func folderByPath(db *storage.Storage, path string, create bool) *int64 {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return nil
+	}
+	folders := db.ListFolders()
+	for id, folderPath := range storage.FolderPaths(folders) {
+		if folderPath == path {
+			return &id
 		}
-
-		result, err := worker.DiscoverFeed(form.Url)
-		switch {
-		case err != nil:
-			log.Printf("Faild to discover feed for %s: %s", form.Url, err)
-			c.JSON(http.StatusOK, map[string]string{"status": "notfound"})
-		case len(result.Sources) > 0:
-			c.JSON(http.StatusOK, map[string]interface{}{"status": "multiple", "choice": result.Sources})
-		case result.Feed != nil:
-			feed := s.db.CreateFeed(
-				result.Feed.Title,
-				"",
-				result.Feed.SiteURL,
-				result.FeedLink,
-				form.FolderID,
-			)
-			items := worker.ConvertItems(result.Feed.Items, *feed)
-			if len(items) > 0 {
-				s.db.CreateItems(items)
-				s.db.SetFeedSize(feed.Id, len(items))
-				s.db.SyncSearch()
-			}
-			s.worker.FindFeedFavicon(*feed)
-
-			c.JSON(http.StatusOK, map[string]interface{}{
-				"status": "success",
-				"feed":   feed,
-			})
-		default:
-			c.JSON(http.StatusOK, map[string]string{"status": "notfound"})
+	}
+	if !create {
+		return nil
+	}
+	var parentId *int64
+	prefix := ""
+	for _, title := range strings.Split(path, "/") {
+		prefix = strings.TrimPrefix(prefix+"/"+title, "/")
+		if folderId := folderByPath(db, prefix, false); folderId != nil {
+			parentId = folderId
+			continue
 		}
+		folder := db.CreateFolder(title, parentId)
+		if folder == nil {
+			return nil
+		}
+		parentId = &folder.Id
+	}
+	return parentId
+}
+
+func (s *Server) handleFeedList(c *router.Context) {
+	db := s.userDB(c)
+	list := db.ListFeeds()
+	c.JSON(http.StatusOK, list)
+}
+
+func (s *Server) handleFeedCreate(c *router.Context) {
+	var form FeedCreateForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&form); err != nil {
+		slog.Debug("invalid request body", "err", err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	result, err := worker.DiscoverFeed(form.Url)
+	switch {
+	case err != nil:
+		slog.Warn("failed to discover feed", "url", form.Url, "err", err)
+		c.JSON(http.StatusOK, map[string]string{"status": "notfound"})
+	case len(result.Sources) > 0:
+		c.JSON(http.StatusOK, map[string]interface{}{"status": "multiple", "choice": result.Sources})
+	case result.Feed != nil:
+		feed := s.worker.CreateFeed(c.UserID, result, form.FolderID)
+
+		c.JSON(http.StatusOK, map[string]interface{}{
+			"status": "success",
+			"feed":   feed,
+		})
+	default:
+		c.JSON(http.StatusOK, map[string]string{"status": "notfound"})
 	}
 }
 
-func (s *Server) handleFeed(c *router.Context) {
+func (s *Server) handleFeedUpdate(c *router.Context) {
+	db := s.userDB(c)
 	id, err := c.VarInt64("id")
 	if err != nil {
 		c.Out.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	if c.Req.Method == "PUT" {
-		feed := s.db.GetFeed(id)
-		if feed == nil {
-			c.Out.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		body := make(map[string]interface{})
-		if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
-			log.Print(err)
-			c.Out.WriteHeader(http.StatusBadRequest)
-			return
+	feed := db.GetFeed(id)
+	if feed == nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	body := make(map[string]interface{})
+	if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+		slog.Debug("invalid request body", "err", err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if title, ok := body["title"]; ok {
+		if reflect.TypeOf(title).Kind() == reflect.String {
+			db.RenameFeed(id, title.(string))
 		}
-		if title, ok := body["title"]; ok {
-			if reflect.TypeOf(title).Kind() == reflect.String {
-				s.db.RenameFeed(id, title.(string))
-			}
+	}
+	if f_id, ok := body["folder_id"]; ok {
+		if f_id == nil {
+			db.UpdateFeedFolder(id, nil)
+		} else if reflect.TypeOf(f_id).Kind() == reflect.Float64 {
+			folderId := int64(f_id.(float64))
+			db.UpdateFeedFolder(id, &folderId)
 		}
-		if f_id, ok := body["folder_id"]; ok {
-			if f_id == nil {
-				s.db.UpdateFeedFolder(id, nil)
-			} else if reflect.TypeOf(f_id).Kind() == reflect.Float64 {
-				folderId := int64(f_id.(float64))
-				s.db.UpdateFeedFolder(id, &folderId)
-			}
+	}
+	if link, ok := body["feed_link"]; ok {
+		if reflect.TypeOf(link).Kind() == reflect.String {
+			db.UpdateFeedLink(id, link.(string))
 		}
-		if link, ok := body["feed_link"]; ok {
-			if reflect.TypeOf(link).Kind() == reflect.String {
-				s.db.UpdateFeedLink(id, link.(string))
-			}
+	}
+	if isSpark, ok := body["is_spark"]; ok {
+		if reflect.TypeOf(isSpark).Kind() == reflect.Bool {
+			db.UpdateFeedSpark(id, isSpark.(bool))
 		}
-		c.Out.WriteHeader(http.StatusOK)
-	} else if c.Req.Method == "DELETE" {
-		s.db.DeleteFeed(id)
-		c.Out.WriteHeader(http.StatusNoContent)
-	} else {
-		c.Out.WriteHeader(http.StatusMethodNotAllowed)
 	}
+	c.Out.WriteHeader(http.StatusOK)
 }
 
-func (s *Server) handleItem(c *router.Context) {
+func (s *Server) handleFeedDelete(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	db.DeleteFeed(id)
+	c.Out.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleFeedRetention(c *router.Context) {
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.JSON(http.StatusOK, s.db.GetFeedRetention(id))
+}
+
+func (s *Server) handleFeedRetentionUpdate(c *router.Context) {
 	id, err := c.VarInt64("id")
 	if err != nil {
 		c.Out.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	if c.Req.Method == "GET" {
-		item := s.db.GetItem(id)
-		if item == nil {
+	var body storage.RetentionPolicy
+	if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+		slog.Debug("invalid request body", "err", err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	for _, val := range []*int{body.KeepDays, body.KeepSize, body.ContentDays} {
+		if val != nil && *val < 0 {
 			c.Out.WriteHeader(http.StatusBadRequest)
 			return
 		}
+	}
+	// the policy applies to the feed of all the users, not the admin's only
+	if !s.db.FeedExists(id) || !s.db.SetFeedRetention(id, body) {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.Out.WriteHeader(http.StatusOK)
+}
 
-		// runtime fix for relative links
-		if !htmlutil.IsAPossibleLink(item.Link) {
-			if feed := s.db.GetFeed(item.FeedId); feed != nil {
-				item.Link = htmlutil.AbsoluteUrl(item.Link, feed.Link)
-			}
-		}
+// Dry run of the cleanup: what each feed would lose.
+func (s *Server) handleRetentionReport(c *router.Context) {
+	c.JSON(http.StatusOK, s.db.RetentionReport())
+}
 
-		item.Content = sanitizer.Sanitize(item.Link, item.Content)
-		for i, link := range item.MediaLinks {
-			item.MediaLinks[i].Description = sanitizer.Sanitize(item.Link, link.Description)
-		}
+func (s *Server) handleItem(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	item := db.GetItem(id)
+	if item == nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
 
-		c.JSON(http.StatusOK, item)
-	} else if c.Req.Method == "PUT" {
-		var body ItemUpdateForm
-		if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
-			log.Print(err)
-			c.Out.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		if body.Status != nil {
-			s.db.UpdateItemStatus(id, *body.Status)
+	// runtime fix for relative links
+	if !htmlutil.IsAPossibleLink(item.Link) {
+		if feed := db.GetFeed(item.FeedId); feed != nil {
+			item.Link = htmlutil.AbsoluteUrl(item.Link, feed.Link)
 		}
-		c.Out.WriteHeader(http.StatusOK)
-	} else {
-		c.Out.WriteHeader(http.StatusMethodNotAllowed)
 	}
+
+	item.Content = sanitizer.Sanitize(item.Link, item.Content)
+	for i, link := range item.MediaLinks {
+		item.MediaLinks[i].Description = sanitizer.Sanitize(item.Link, link.Description)
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+func (s *Server) handleItemUpdate(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var body ItemUpdateForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+		slog.Debug("invalid request body", "err", err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if body.Status != nil {
+		db.UpdateItemStatus(id, *body.Status)
+	}
+	c.Out.WriteHeader(http.StatusOK)
 }
 
 func (s *Server) handleItemList(c *router.Context) {
-	if c.Req.Method == "GET" {
-		perPage := 20
-		query := c.Req.URL.Query()
+	db := s.userDB(c)
+	perPage := 20
+	query := c.Req.URL.Query()
 
-		filter := storage.ItemFilter{}
-		if folderID, err := c.QueryInt64("folder_id"); err == nil {
-			filter.FolderID = &folderID
-		}
-		if feedID, err := c.QueryInt64("feed_id"); err == nil {
-			filter.FeedID = &feedID
-		}
-		if after, err := c.QueryInt64("after"); err == nil {
-			filter.After = &after
-		}
-		if status := query.Get("status"); len(status) != 0 {
-			statusValue := storage.StatusValues[status]
-			filter.Status = &statusValue
-		}
-		if search := query.Get("search"); len(search) != 0 {
-			filter.Search = &search
-		}
-		newestFirst := query.Get("oldest_first") != "true"
+	filter := storage.ItemFilter{}
+	if folderID, err := c.QueryInt64("folder_id"); err == nil {
+		filter.FolderID = &folderID
+	}
+	if feedID, err := c.QueryInt64("feed_id"); err == nil {
+		filter.FeedID = &feedID
+	}
+	if labelID, err := c.QueryInt64("label_id"); err == nil {
+		filter.LabelID = &labelID
+	}
+	if after, err := c.QueryInt64("after"); err == nil {
+		filter.After = &after
+	}
+	if status := query.Get("status"); len(status) != 0 {
+		statusValue := storage.StatusValues[status]
+		filter.Status = &statusValue
+	}
+	if search := query.Get("search"); len(search) != 0 {
+		filter.Search = &search
+	}
+	newestFirst := query.Get("oldest_first") != "true"
 
-		items := s.db.ListItems(filter, perPage+1, newestFirst, true)
-		hasMore := false
-		if len(items) == perPage+1 {
-			hasMore = true
-			items = items[:perPage]
-		}
+	items := db.ListItems(filter, perPage+1, newestFirst, true)
+	hasMore := false
+	if len(items) == perPage+1 {
+		hasMore = true
+		items = items[:perPage]
+	}
 
-		for i, item := range items {
-			if item.Title == "" {
-				text := htmlutil.ExtractText(item.Content)
-				items[i].Title = htmlutil.TruncateText(text, 140)
-			}
+	for i, item := range items {
+		if item.Title == "" {
+			text := htmlutil.ExtractText(item.Content)
+			items[i].Title = htmlutil.TruncateText(text, 140)
 		}
-		c.JSON(http.StatusOK, map[string]interface{}{
-			"list":     items,
-			"has_more": hasMore,
-		})
-	} else if c.Req.Method == "PUT" {
-		filter := storage.MarkFilter{}
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"list":     items,
+		"has_more": hasMore,
+	})
+}
 
-		if folderID, err := c.QueryInt64("folder_id"); err == nil {
-			filter.FolderID = &folderID
-		}
-		if feedID, err := c.QueryInt64("feed_id"); err == nil {
-			filter.FeedID = &feedID
-		}
-		s.db.MarkItemsRead(filter)
-		c.Out.WriteHeader(http.StatusOK)
-	} else {
-		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+func (s *Server) handleItemListUpdate(c *router.Context) {
+	db := s.userDB(c)
+	filter := storage.MarkFilter{}
+
+	if folderID, err := c.QueryInt64("folder_id"); err == nil {
+		filter.FolderID = &folderID
+	}
+	if feedID, err := c.QueryInt64("feed_id"); err == nil {
+		filter.FeedID = &feedID
+	}
+	db.MarkItemsRead(filter)
+	c.Out.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleLabelList(c *router.Context) {
+	db := s.userDB(c)
+	c.JSON(http.StatusOK, db.ListLabels())
+}
+
+func (s *Server) handleLabelCreate(c *router.Context) {
+	db := s.userDB(c)
+	var body LabelForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+		slog.Debug("invalid request body", "err", err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if len(body.Title) == 0 {
+		c.JSON(http.StatusBadRequest, map[string]string{"error": "Label title missing."})
+		return
+	}
+	label := db.CreateLabel(body.Title)
+	if label == nil {
+		c.Out.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusCreated, label)
+}
+
+func (s *Server) handleLabelUpdate(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
 	}
+	var body LabelForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+		slog.Debug("invalid request body", "err", err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if len(body.Title) == 0 || !db.RenameLabel(id, body.Title) {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.Out.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleLabelDelete(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	db.DeleteLabel(id)
+	c.Out.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleItemLabels(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.JSON(http.StatusOK, db.ListItemLabels(id))
+}
+
+func (s *Server) handleItemLabelsUpdate(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var body ItemLabelsForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+		slog.Debug("invalid request body", "err", err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if db.GetItem(id) == nil || !db.SetItemLabels(id, body.LabelIDs) {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.JSON(http.StatusOK, db.ListItemLabels(id))
+}
+
+func (s *Server) handleItemNote(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	note := db.GetItemNote(id)
+	if note == nil {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, note)
+}
+
+func (s *Server) handleItemNoteUpdate(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var body ItemNoteForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+		slog.Debug("invalid request body", "err", err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if db.GetItem(id) == nil || !db.UpdateItemNote(id, body.Text) {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.Out.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleItemNoteDelete(c *router.Context) {
+	db := s.userDB(c)
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	db.UpdateItemNote(id, "")
+	c.Out.WriteHeader(http.StatusNoContent)
 }
 
 func (s *Server) handleSettings(c *router.Context) {
-	if c.Req.Method == "GET" {
-		c.JSON(http.StatusOK, s.db.GetSettings())
-	} else if c.Req.Method == "PUT" {
-		settings := make(map[string]interface{})
-		if err := json.NewDecoder(c.Req.Body).Decode(&settings); err != nil {
-			c.Out.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		if s.db.UpdateSettings(settings) {
-			if _, ok := settings["refresh_rate"]; ok {
-				s.worker.SetRefreshRate(s.db.GetSettingsValueInt64("refresh_rate"))
+	db := s.userDB(c)
+	c.JSON(http.StatusOK, db.GetSettings())
+}
+
+func (s *Server) handleSettingsUpdate(c *router.Context) {
+	db := s.userDB(c)
+	settings := make(map[string]interface{})
+	if err := json.NewDecoder(c.Req.Body).Decode(&settings); err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !s.isAdmin(c) {
+		for key := range settings {
+			if storage.IsGlobalSetting(key) {
+				delete(settings, key)
 			}
-			c.Out.WriteHeader(http.StatusOK)
-		} else {
-			c.Out.WriteHeader(http.StatusBadRequest)
 		}
 	}
+	if db.UpdateSettings(settings) {
+		if _, ok := settings["refresh_rate"]; ok {
+			s.worker.SetRefreshRate(db.GetSettingsValueInt64("refresh_rate"))
+		}
+		c.Out.WriteHeader(http.StatusOK)
+	} else {
+		c.Out.WriteHeader(http.StatusBadRequest)
+	}
 }
 
 func (s *Server) handleOPMLImport(c *router.Context) {
-	if c.Req.Method == "POST" {
-		file, _, err := c.Req.FormFile("opml")
-		if err != nil {
-			log.Print(err)
-			return
-		}
-		doc, err := opml.Parse(file)
-		if err != nil {
-			log.Print(err)
-			c.Out.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		for _, f := range doc.Feeds {
-			s.db.CreateFeed(f.Title, "", f.SiteUrl, f.FeedUrl, nil)
-		}
-		for _, f := range doc.Folders {
-			folder := s.db.CreateFolder(f.Title)
-			for _, ff := range f.AllFeeds() {
-				s.db.CreateFeed(ff.Title, "", ff.SiteUrl, ff.FeedUrl, &folder.Id)
-			}
-		}
+	file, _, err := c.Req.FormFile("opml")
+	if err != nil {
+		slog.Debug("invalid opml upload", "err", err)
+		return
+	}
+	doc, err := opml.Parse(file)
+	if err != nil {
+		slog.Warn("failed to parse opml", "err", err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	ImportOPML(s.userDB(c), doc)
 
-		s.worker.FindFavicons()
-		s.worker.RefreshFeeds()
+	s.worker.FindFavicons()
+	s.worker.RefreshFeeds()
 
-		c.Out.WriteHeader(http.StatusOK)
-	} else {
-		c.Out.WriteHeader(http.StatusMethodNotAllowed)
-	}
+	c.Out.WriteHeader(http.StatusOK)
 }
 
 func (s *Server) handleOPMLExport(c *router.Context) {
-	if c.Req.Method == "GET" {
-		c.Out.Header().Set("Content-Type", "application/xml; charset=utf-8")
-		c.Out.Header().Set("Content-Disposition", `attachment; filename="subscriptions.opml"`)
-
-		doc := opml.Folder{}
-
-		feedsByFolderID := make(map[int64][]*storage.Feed)
-		for _, feed := range s.db.ListFeeds() {
-			feed := feed
-			if feed.FolderId == nil {
-				doc.Feeds = append(doc.Feeds, opml.Feed{
-					Title:   feed.Title,
-					FeedUrl: feed.FeedLink,
-					SiteUrl: feed.Link,
-				})
-			} else {
-				id := *feed.FolderId
-				feedsByFolderID[id] = append(feedsByFolderID[id], &feed)
-			}
-		}
+	c.Out.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	c.Out.Header().Set("Content-Disposition", `attachment; filename="subscriptions.opml"`)
 
-		for _, folder := range s.db.ListFolders() {
-			folderFeeds := feedsByFolderID[folder.Id]
-			if len(folderFeeds) == 0 {
-				continue
-			}
-			opmlfolder := opml.Folder{Title: folder.Title}
-			for _, feed := range folderFeeds {
-				opmlfolder.Feeds = append(opmlfolder.Feeds, opml.Feed{
-					Title:   feed.Title,
-					FeedUrl: feed.FeedLink,
-					SiteUrl: feed.Link,
-				})
-			}
-			doc.Folders = append(doc.Folders, opmlfolder)
-		}
+	doc := ExportOPML(s.userDB(c))
+	c.Out.Write([]byte(doc.OPML()))
+}
+
+// Streams a consistent snapshot of the database.
+func (s *Server) handleBackup(c *router.Context) {
+	dir, err := os.MkdirTemp("", "readn-backup")
+	if err != nil {
+		slog.Error("failed to backup database", "err", err)
+		c.Out.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(dir)
 
-		c.Out.Write([]byte(doc.OPML()))
+	path := filepath.Join(dir, "backup.db")
+	if err := s.db.Backup(path); err != nil {
+		slog.Error("failed to backup database", "err", err)
+		c.Out.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		slog.Error("failed to backup database", "err", err)
+		c.Out.WriteHeader(http.StatusInternalServerError)
+		return
 	}
+	defer file.Close()
+
+	filename := "readn-" + time.Now().UTC().Format("20060102-150405") + ".db"
+	c.Out.Header().Set("Content-Type", "application/vnd.sqlite3")
+	c.Out.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	http.ServeContent(c.Out, c.Req, filename, time.Time{}, file)
 }
 
 func (s *Server) handlePageCrawl(c *router.Context) {
@@ -526,7 +920,7 @@ func (s *Server) handlePageCrawl(c *router.Context) {
 
 	body, err := worker.GetBody(url)
 	if err != nil {
-		log.Print(err)
+		slog.Warn("failed to fetch page", "url", url, "err", err)
 		c.Out.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -543,14 +937,119 @@ func (s *Server) handlePageCrawl(c *router.Context) {
 	})
 }
 
-func (s *Server) handleSummarize(c *router.Context) {
-	if c.Req.Method != http.MethodPost {
-		c.Out.WriteHeader(http.StatusMethodNotAllowed)
+// Fetches the page at the url and stores its readable content
+// in the saved articles pseudo-feed.
+func (s *Server) saveURL(db *storage.Storage, url string) (*storage.Item, error) {
+	if newUrl := silo.RedirectURL(url); newUrl != "" {
+		url = newUrl
+	}
+
+	body, err := worker.GetBody(url)
+	if err != nil {
+		return nil, err
+	}
+
+	content := silo.VideoIFrame(url)
+	if content == "" {
+		content, err = readability.ExtractContent(strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+	}
+	content = sanitizer.Sanitize(url, content)
+
+	title := scraper.FindTitle(body)
+	if title == "" {
+		title = url
+	}
+	mediaLinks := make(storage.MediaLinks, 0)
+	if image := scraper.FindImage(body, url); image != "" {
+		mediaLinks = append(mediaLinks, storage.MediaLink{URL: image, Type: "image"})
+	}
+
+	item := db.CreateSavedItem(storage.Item{
+		GUID:        url,
+		Title:       title,
+		Link:        url,
+		Content:     content,
+		Date:        time.Now().UTC(),
+		MediaLinks:  mediaLinks,
+		ReadingTime: htmlutil.ReadingTime(content),
+	})
+	if item == nil {
+		return nil, fmt.Errorf("failed to store %s", url)
+	}
+	db.SyncSearch()
+	return item, nil
+}
+
+func (s *Server) handleSavedItemCreate(c *router.Context) {
+	var form SavedItemCreateForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&form); err != nil {
+		slog.Debug("invalid request body", "err", err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !htmlutil.IsAPossibleLink(form.Url) {
+		c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid url."})
+		return
+	}
+	item, err := s.saveURL(s.userDB(c), form.Url)
+	if err != nil {
+		slog.Warn("failed to save page", "url", form.Url, "err", err)
+		c.JSON(http.StatusOK, map[string]string{"status": "error", "error": err.Error()})
 		return
 	}
+	c.JSON(http.StatusOK, map[string]interface{}{"status": "success", "item": item})
+}
+
+var urlRegex = regexp.MustCompile(`https?://\S+`)
+
+// Target of the bookmarklet & the web app share target.
+// Shared urls are often passed along with the text, hence the lookup.
+// Asks to confirm the page shared to the app, as other sites can link here too.
+func (s *Server) handleSaveTarget(c *router.Context) {
+	query := c.Req.URL.Query()
+	url := query.Get("url")
+	if url == "" {
+		url = urlRegex.FindString(query.Get("text"))
+	}
+	if !htmlutil.IsAPossibleLink(url) {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.HTML(http.StatusOK, assets.Template("save.html"), map[string]interface{}{
+		"url":        url,
+		"csrf_token": auth.CSRFToken(c.Out, c.Req, s.BasePath),
+		"settings":   s.userDB(c).GetSettings(),
+	})
+}
+
+func (s *Server) handleSaveTargetConfirm(c *router.Context) {
+	db := s.userDB(c)
+	url := c.Req.PostFormValue("url")
+	if !htmlutil.IsAPossibleLink(url) {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	item, err := s.saveURL(db, url)
+	if err != nil {
+		slog.Warn("failed to save page", "url", url, "err", err)
+		c.Out.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	// open the app with the saved articles selected
+	db.UpdateSettings(map[string]interface{}{
+		"feed":   fmt.Sprintf("feed:%d", item.FeedId),
+		"filter": "",
+	})
+	c.Redirect(s.BasePath + "/")
+}
 
+func (s *Server) handleSummarize(c *router.Context) {
+	db := s.userDB(c)
 	// Check if article summarization is enabled
-	if !s.db.IsAIArticleSummaryEnabled() {
+	if !db.IsAIArticleSummaryEnabled() {
 		c.Out.WriteHeader(http.StatusServiceUnavailable)
 		c.Out.Write([]byte(`{"error": "Article summarization is disabled"}`))
 		return
@@ -562,7 +1061,7 @@ func (s *Server) handleSummarize(c *router.Context) {
 	}
 
 	if err := json.NewDecoder(c.Req.Body).Decode(&requestBody); err != nil {
-		log.Print("Error decoding request body:", err)
+		slog.Debug("invalid request body", "err", err)
 		c.Out.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -573,9 +1072,9 @@ func (s *Server) handleSummarize(c *router.Context) {
 	}
 
 	// Call OpenAI API for summarization
-	summary, err := s.callOpenAISummarize(requestBody.Content, requestBody.Title)
+	summary, err := s.callOpenAISummarize(db, requestBody.Content, requestBody.Title)
 	if err != nil {
-		log.Print("Error calling OpenAI API:", err)
+		slog.Error("failed to summarize article", "err", err)
 		c.JSON(http.StatusOK, map[string]interface{}{
 			"error": "Failed to generate summary: " + err.Error(),
 		})
@@ -587,15 +1086,15 @@ func (s *Server) handleSummarize(c *router.Context) {
 	})
 }
 
-func (s *Server) callOpenAISummarize(content, title string) (string, error) {
-	apiKey := s.db.GetAIAPIKey()
+func (s *Server) callOpenAISummarize(db *storage.Storage, content, title string) (string, error) {
+	apiKey := db.GetAIAPIKey()
 	if apiKey == "" {
 		return "", fmt.Errorf("API key not configured")
 	}
 
-	apiURL := s.db.GetAIAPIURL()
-	model := s.db.GetAIModel()
-	aiPrompt := s.db.GetAIPrompt()
+	apiURL := db.GetAIAPIURL()
+	model := db.GetAIModel()
+	aiPrompt := db.GetAIPrompt()
 
 	prompt := fmt.Sprintf("%s\n\nTitle: %s\n\nContent: %s", aiPrompt, title, content)
 	systemMessage := "You are a helpful assistant that summarizes articles based on user instructions. Return only the summary content itself, without any preamble, headers, or additional text."
@@ -630,22 +1129,11 @@ func (s *Server) callOpenAISummarize(content, title string) (string, error) {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+apiKey)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
+	body, err := sendAIRequest("summarize", req)
 	if err != nil {
 		return "", err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
 	var response struct {
 		Choices []struct {
 			Message struct {
@@ -666,8 +1154,9 @@ func (s *Server) callOpenAISummarize(content, title string) (string, error) {
 }
 
 func (s *Server) handleChat(c *router.Context) {
+	db := s.userDB(c)
 	// Check if AI chat is enabled
-	if !s.db.IsAIChatEnabled() {
+	if !db.IsAIChatEnabled() {
 		c.JSON(http.StatusServiceUnavailable, map[string]interface{}{
 			"error": "AI chat is disabled",
 		})
@@ -699,7 +1188,7 @@ func (s *Server) handleChat(c *router.Context) {
 		return
 	}
 
-	response, err := s.callOpenAIChat(req.Messages, req.Context.Title, req.Context.Content)
+	response, err := s.callOpenAIChat(db, req.Messages, req.Context.Title, req.Context.Content)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, map[string]interface{}{
 			"error": err.Error(),
@@ -712,20 +1201,20 @@ func (s *Server) handleChat(c *router.Context) {
 	})
 }
 
-func (s *Server) callOpenAIChat(messages []struct {
+func (s *Server) callOpenAIChat(db *storage.Storage, messages []struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
 }, title, content string) (string, error) {
-	apiKey := s.db.GetAIAPIKey()
+	apiKey := db.GetAIAPIKey()
 	if apiKey == "" {
 		return "", fmt.Errorf("API key not configured")
 	}
 
-	apiURL := s.db.GetAIAPIURL()
-	model := s.db.GetAIModel()
+	apiURL := db.GetAIAPIURL()
+	model := db.GetAIModel()
 
 	// Get AI personality and prepare context system message
-	personality := s.db.GetAIPersonality()
+	personality := db.GetAIPersonality()
 	systemMessage := "You are a helpful assistant discussing an article. Use the following article as context for the conversation.\n\n"
 	if title != "" {
 		systemMessage += fmt.Sprintf("Title: %s\n\n", title)
@@ -774,22 +1263,11 @@ func (s *Server) callOpenAIChat(messages []struct {
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+apiKey)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
+	body, err := sendAIRequest("chat", req)
 	if err != nil {
 		return "", err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
-	}
-
 	var response struct {
 		Choices []struct {
 			Message struct {
@@ -810,13 +1288,9 @@ func (s *Server) callOpenAIChat(messages []struct {
 }
 
 func (s *Server) handleFeedSummarize(c *router.Context) {
-	if c.Req.Method != http.MethodPost {
-		c.Out.WriteHeader(http.StatusMethodNotAllowed)
-		return
-	}
-
+	db := s.userDB(c)
 	// Check if feed summarization is enabled
-	if !s.db.IsAIFeedSummaryEnabled() {
+	if !db.IsAIFeedSummaryEnabled() {
 		c.Out.WriteHeader(http.StatusServiceUnavailable)
 		c.Out.Write([]byte(`{"error": "Feed summarization is disabled"}`))
 		return
@@ -830,7 +1304,7 @@ func (s *Server) handleFeedSummarize(c *router.Context) {
 	}
 
 	if err := json.NewDecoder(c.Req.Body).Decode(&requestBody); err != nil {
-		log.Print("Error decoding request body:", err)
+		slog.Debug("invalid request body", "err", err)
 		c.Out.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -852,7 +1326,7 @@ func (s *Server) handleFeedSummarize(c *router.Context) {
 	}
 
 	// Get up to 75 newest articles with content
-	articles := s.db.ListItems(filter, 75, true, true)
+	articles := db.ListItems(filter, 75, true, true)
 	
 	if len(articles) == 0 {
 		c.JSON(http.StatusOK, map[string]interface{}{
@@ -867,11 +1341,11 @@ func (s *Server) handleFeedSummarize(c *router.Context) {
 	
 	// Get feed name for context
 	if requestBody.FeedID != nil {
-		if feed := s.db.GetFeed(*requestBody.FeedID); feed != nil {
+		if feed := db.GetFeed(*requestBody.FeedID); feed != nil {
 			feedTitle = feed.Title
 		}
 	} else if requestBody.FolderID != nil {
-		if folder := s.db.GetFolder(*requestBody.FolderID); folder != nil {
+		if folder := db.GetFolder(*requestBody.FolderID); folder != nil {
 			feedTitle = folder.Title + " (folder)"
 		}
 	} else if requestBody.Status == "unread" {
@@ -888,7 +1362,7 @@ func (s *Server) handleFeedSummarize(c *router.Context) {
 		}
 		
 		// Generate summary for this article
-		summary, err := s.callOpenAISummarize(article.Content, article.Title)
+		summary, err := s.callOpenAISummarize(db, article.Content, article.Title)
 		if err != nil {
 			// If summary fails, use title + truncated content
 			content := article.Content
@@ -901,9 +1375,9 @@ func (s *Server) handleFeedSummarize(c *router.Context) {
 	}
 
 	// Now create meta-summary from all article summaries
-	feedSummary, err := s.callOpenAIFeedSummarize(summaries, feedTitle)
+	feedSummary, err := s.callOpenAIFeedSummarize(db, summaries, feedTitle)
 	if err != nil {
-		log.Print("Error calling OpenAI for feed summary:", err)
+		slog.Error("failed to summarize feed", "err", err)
 		c.JSON(http.StatusOK, map[string]interface{}{
 			"error": "Failed to generate feed summary: " + err.Error(),
 		})
@@ -917,14 +1391,14 @@ func (s *Server) handleFeedSummarize(c *router.Context) {
 	})
 }
 
-func (s *Server) callOpenAIFeedSummarize(summaries []string, feedTitle string) (string, error) {
-	apiKey := s.db.GetAIAPIKey()
+func (s *Server) callOpenAIFeedSummarize(db *storage.Storage, summaries []string, feedTitle string) (string, error) {
+	apiKey := db.GetAIAPIKey()
 	if apiKey == "" {
 		return "", fmt.Errorf("API key not configured")
 	}
 
-	apiURL := s.db.GetAIAPIURL()
-	model := s.db.GetAIModel()
+	apiURL := db.GetAIAPIURL()
+	model := db.GetAIModel()
 
 	// Combine all summaries
 	combinedSummaries := strings.Join(summaries, "\n\n")
@@ -962,21 +1436,10 @@ func (s *Server) callOpenAIFeedSummarize(summaries []string, feedTitle string) (
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+apiKey)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	body, err := sendAIRequest("summarize_feed", req)
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
-	}
 
 	var response struct {
 		Choices []struct {
@@ -998,18 +1461,13 @@ func (s *Server) callOpenAIFeedSummarize(summaries []string, feedTitle string) (
 }
 
 func (s *Server) handleHackerNews(c *router.Context) {
-	if c.Req.Method != "POST" {
-		c.Out.WriteHeader(http.StatusMethodNotAllowed)
-		return
-	}
-	
 	var requestBody struct {
 		Content string `json:"content"`
 		URL     string `json:"url"`
 	}
 	
 	if err := json.NewDecoder(c.Req.Body).Decode(&requestBody); err != nil {
-		log.Print("Error decoding request body:", err)
+		slog.Debug("invalid request body", "err", err)
 		c.Out.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -1035,7 +1493,7 @@ func (s *Server) handleHackerNews(c *router.Context) {
 	
 	thread, err := hackernews.GetHNThread(itemID)
 	if err != nil {
-		log.Printf("Error fetching HN thread %d: %v", itemID, err)
+		slog.Warn("failed to fetch hacker news thread", "id", itemID, "err", err)
 		c.JSON(http.StatusInternalServerError, map[string]string{
 			"error": "Failed to fetch HackerNews thread",
 		})
@@ -1051,18 +1509,13 @@ func (s *Server) handleHackerNews(c *router.Context) {
 }
 
 func (s *Server) handleLobsters(c *router.Context) {
-	if c.Req.Method != "POST" {
-		c.Out.WriteHeader(http.StatusMethodNotAllowed)
-		return
-	}
-	
 	var requestBody struct {
 		Content string `json:"content"`
 		URL     string `json:"url"`
 	}
 	
 	if err := json.NewDecoder(c.Req.Body).Decode(&requestBody); err != nil {
-		log.Print("Error decoding request body:", err)
+		slog.Debug("invalid request body", "err", err)
 		c.Out.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -1093,7 +1546,7 @@ func (s *Server) handleLobsters(c *router.Context) {
 	
 	thread, err := provider.FetchThread(url)
 	if err != nil {
-		log.Printf("Error fetching Lobsters thread %s: %v", url, err)
+		slog.Warn("failed to fetch lobsters thread", "url", url, "err", err)
 		c.JSON(http.StatusInternalServerError, map[string]string{
 			"error": "Failed to fetch Lobste.rs thread",
 		})
@@ -1110,6 +1563,6 @@ func (s *Server) handleLobsters(c *router.Context) {
 }
 
 func (s *Server) handleLogout(c *router.Context) {
-	auth.Logout(c.Out, s.BasePath)
+	auth.Logout(c.Out, c.Req, s.db, s.BasePath)
 	c.Out.WriteHeader(http.StatusNoContent)
 }
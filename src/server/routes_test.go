@@ -1,15 +1,28 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httputil"
+	"net/netip"
+	"net/url"
 	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/thang-qt/Readn/src/server/auth"
 	"github.com/thang-qt/Readn/src/storage"
 )
 
@@ -111,4 +124,1618 @@ func TestFeedIcons(t *testing.T) {
 	if response2.StatusCode != http.StatusNotModified {
 		t.Fatal("got", response2.StatusCode)
 	}
+
+	// the cached icon stays with the feed's subscribers
+	server := NewServer(db, "127.0.0.1:8000")
+	server.SetCredentials("admin", "secret")
+	alice := db.CreateUser("alice", "", false)
+	db.CreateAPIToken(storage.DefaultUserId, "script", auth.HashToken("admin"), auth.ScopeRead)
+	db.CreateAPIToken(alice.Id, "script", auth.HashToken("alice"), auth.ScopeRead)
+	handler = server.handler()
+	for _, check := range []struct {
+		token string
+		want  int
+	}{{"admin", http.StatusOK}, {"alice", http.StatusNotFound}} {
+		request := httptest.NewRequest("GET", url, nil)
+		request.Header.Set("Authorization", "Bearer "+check.token)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != check.want {
+			t.Errorf("expected %d for the icon requested by %s, got %d", check.want, check.token, recorder.Code)
+		}
+	}
+}
+
+func TestFeedRetention(t *testing.T) {
+	log.SetOutput(io.Discard)
+	db, _ := storage.New(":memory:")
+	log.SetOutput(os.Stderr)
+
+	server := NewServer(db, "127.0.0.1:8000")
+	server.SetCredentials("admin", "secret")
+	alice := db.CreateUser("alice", "", false)
+	feed := db.ForUser(alice.Id).CreateFeed("Blog", "", "https://example.com", "https://example.com/feed.xml", nil)
+	db.CreateAPIToken(storage.DefaultUserId, "script", auth.HashToken("token"), auth.ScopeAdmin)
+	handler := server.handler()
+
+	call := func(id int64) int {
+		request := httptest.NewRequest("PUT", fmt.Sprintf("/api/feeds/%d/retention", id), strings.NewReader(`{"keep_days": 7}`))
+		request.Header.Set("Authorization", "Bearer token")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+	// the admin sets the policy of the feeds they don't follow too
+	if code := call(feed.Id); code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if days := db.GetFeedRetention(feed.Id).KeepDays; days == nil || *days != 7 {
+		t.Errorf("expected the policy to be set, got %v", days)
+	}
+	if code := call(feed.Id + 1); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown feed, got %d", code)
+	}
+}
+
+func TestOPMLExportNested(t *testing.T) {
+	log.SetOutput(io.Discard)
+	db, _ := storage.New(":memory:")
+	engineering := db.CreateFolder("Engineering", nil)
+	golang := db.CreateFolder("Go", &engineering.Id)
+	db.CreateFolder("Empty", &engineering.Id)
+	db.CreateFeed("blog", "", "https://go.dev/", "https://go.dev/blog/feed.atom", &golang.Id)
+	log.SetOutput(os.Stderr)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("GET", "/opml/export", nil)
+	NewServer(db, "127.0.0.1:8000").handler().ServeHTTP(recorder, request)
+
+	body, _ := io.ReadAll(recorder.Result().Body)
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="1.1">
+<head><title>subscriptions</title></head>
+<body>
+  <outline text="Engineering">
+    <outline text="Empty">
+    </outline>
+    <outline text="Go">
+      <outline type="rss" text="blog" xmlUrl="https://go.dev/blog/feed.atom" htmlUrl="https://go.dev/"/>
+    </outline>
+  </outline>
+</body>
+</opml>
+`
+	if string(body) != want {
+		t.Logf("want: %s", want)
+		t.Logf("have: %s", body)
+		t.Fatal("invalid opml")
+	}
+}
+
+func TestItemLabelsAndNotes(t *testing.T) {
+	log.SetOutput(io.Discard)
+	db, _ := storage.New(":memory:")
+	feed := db.CreateFeed("Blog", "", "", "https://example.com/feed.xml", nil)
+	db.CreateItems([]storage.Item{{GUID: "1", FeedId: feed.Id, Title: "Article"}})
+	item := db.ListItems(storage.ItemFilter{}, 1, false, false)[0]
+	label := db.CreateLabel("later")
+	other := db.ForUser(db.CreateUser("alice", "", false).Id).CreateLabel("hers")
+	log.SetOutput(os.Stderr)
+
+	handler := NewServer(db, "127.0.0.1:8000").handler()
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(method, path, strings.NewReader(body))
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+	labels := fmt.Sprintf("/api/items/%d/labels", item.Id)
+	notes := fmt.Sprintf("/api/items/%d/notes", item.Id)
+
+	body := fmt.Sprintf(`{"label_ids": [%d, %d]}`, label.Id, other.Id)
+	if recorder := call("PUT", labels, body); recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", recorder.Code)
+	}
+	want := fmt.Sprintf(`[{"id":%d,"title":"later"}]`+"\n", label.Id)
+	if have := call("GET", labels, "").Body.String(); have != want {
+		t.Errorf("expected only the own labels\nwant: %s\nhave: %s", want, have)
+	}
+	if code := call("PUT", "/api/items/999/labels", body).Code; code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a missing item, got %d", code)
+	}
+	if code := call("PUT", labels, "not json").Code; code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid body, got %d", code)
+	}
+
+	if code := call("GET", notes, "").Code; code != http.StatusNotFound {
+		t.Errorf("expected no note, got %d", code)
+	}
+	if code := call("PUT", notes, `{"text": "100% *worth* it"}`).Code; code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	var note storage.ItemNote
+	json.Unmarshal(call("GET", notes, "").Body.Bytes(), &note)
+	if note.ItemId != item.Id || note.Text != "100% *worth* it" {
+		t.Errorf("invalid note: %#v", note)
+	}
+	if code := call("PUT", "/api/items/999/notes", `{"text": "x"}`).Code; code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a missing item, got %d", code)
+	}
+	if code := call("DELETE", notes, "").Code; code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", code)
+	}
+	if code := call("GET", notes, "").Code; code != http.StatusNotFound {
+		t.Errorf("expected the note to be removed, got %d", code)
+	}
+
+	want = fmt.Sprintf(`{"id":%d,"title":"later"}`+"\n", label.Id)
+	if recorder := call("POST", "/api/labels", `{"title": "later"}`); recorder.Code != http.StatusCreated || recorder.Body.String() != want {
+		t.Errorf("expected the existing label, got %d %s", recorder.Code, recorder.Body)
+	}
+	log.SetOutput(io.Discard)
+	db.Close()
+	code := call("POST", "/api/labels", `{"title": "broken"}`).Code
+	log.SetOutput(os.Stderr)
+	if code != http.StatusInternalServerError {
+		t.Errorf("expected 500 when the label isn't stored, got %d", code)
+	}
+}
+
+func TestHighlightExport(t *testing.T) {
+	log.SetOutput(io.Discard)
+	db, _ := storage.New(":memory:")
+	feed := db.CreateFeed("Blog", "", "", "https://example.com/feed.xml", nil)
+	db.CreateItems([]storage.Item{{
+		GUID:   "1",
+		FeedId: feed.Id,
+		Title:  "Article",
+		Link:   "https://example.com/article",
+		Date:   time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+	}})
+	item := db.ListItems(storage.ItemFilter{}, 1, false, false)[0]
+	db.CreateHighlight(storage.Highlight{ItemId: item.Id, Text: "first line\nsecond line"})
+	db.CreateHighlight(storage.Highlight{ItemId: item.Id, Text: "another", Comment: "my thoughts"})
+	log.SetOutput(os.Stderr)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("GET", "/api/highlights/export", nil)
+	NewServer(db, "127.0.0.1:8000").handler().ServeHTTP(recorder, request)
+
+	body, _ := io.ReadAll(recorder.Result().Body)
+	want := `# Highlights
+
+## [Article](https://example.com/article)
+
+*Blog, 2024-05-01*
+
+> first line
+> second line
+
+> another
+
+my thoughts
+
+`
+	if string(body) != want {
+		t.Logf("want: %q", want)
+		t.Logf("have: %q", body)
+		t.Fatal("invalid markdown")
+	}
+}
+
+func TestHighlightExportEscaping(t *testing.T) {
+	item := storage.Item{Id: 1, Title: "[draft] notes", Link: "https://en.wikipedia.org/wiki/Go_(game)"}
+	have := highlightsMarkdown(
+		[]int64{1},
+		map[int64][]storage.Highlight{1: {{ItemId: 1, Text: "text"}}},
+		map[int64]storage.Item{1: item},
+		nil,
+	)
+	want := "# Highlights\n\n## [\\[draft\\] notes](https://en.wikipedia.org/wiki/Go_%28game%29)\n\n> text\n\n"
+	if have != want {
+		t.Logf("want: %q", want)
+		t.Logf("have: %q", have)
+		t.Fatal("invalid markdown")
+	}
+}
+
+func TestSaveURL(t *testing.T) {
+	page := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		rw.Write([]byte(`<html><head>
+			<title>Saved article</title>
+			<meta property="og:image" content="/lead.png">
+			</head><body><article><p>` + strings.Repeat("lorem ipsum dolor sit amet, ", 100) + `</p></article></body></html>`))
+	}))
+	defer page.Close()
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	db, _ := storage.New(":memory:")
+	handler := NewServer(db, "127.0.0.1:8000").handler()
+
+	// other sites may link here, so the page has to be confirmed
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("GET", "/save?text="+url.QueryEscape("look at this "+page.URL+"/article"), nil)
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected the confirmation page, got %d", recorder.Code)
+	}
+	if db.CountItems(storage.ItemFilter{}) != 0 {
+		t.Fatal("expected nothing saved before the confirmation")
+	}
+	match := regexp.MustCompile(`name="csrf_token" type="hidden" value="(\w+)"`).FindStringSubmatch(recorder.Body.String())
+	if match == nil || !strings.Contains(recorder.Body.String(), `value="`+page.URL+`/article"`) {
+		t.Fatalf("invalid confirmation page: %s", recorder.Body.String())
+	}
+	cookies := recorder.Result().Cookies()
+
+	confirm := func(token string) int {
+		form := url.Values{"url": {page.URL + "/article"}, "csrf_token": {token}}
+		request := httptest.NewRequest("POST", "/save", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, cookie := range cookies {
+			request.AddCookie(cookie)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+	if code := confirm("bogus"); code != http.StatusForbidden {
+		t.Fatalf("expected 403 for an invalid token, got %d", code)
+	}
+	if code := confirm(match[1]); code != http.StatusFound {
+		t.Fatalf("expected redirect, got %d", code)
+	}
+
+	feed := db.GetSavedFeed()
+	items := db.ListItems(storage.ItemFilter{FeedID: &feed.Id}, 10, true, true)
+	if len(items) != 1 {
+		t.Fatalf("expected 1 saved item, got %d", len(items))
+	}
+	item := items[0]
+	if item.Title != "Saved article" || item.Link != page.URL+"/article" {
+		t.Errorf("invalid item: %#v", item)
+	}
+	if item.ReadingTime != 3 {
+		t.Errorf("invalid reading time: %d", item.ReadingTime)
+	}
+	if len(item.MediaLinks) != 1 || item.MediaLinks[0].URL != page.URL+"/lead.png" {
+		t.Errorf("invalid lead image: %#v", item.MediaLinks)
+	}
+	if !strings.Contains(item.Content, "lorem ipsum") {
+		t.Errorf("invalid content: %#v", item.Content)
+	}
+}
+
+func TestBackup(t *testing.T) {
+	log.SetOutput(io.Discard)
+	db, _ := storage.New(":memory:")
+	db.CreateFeed("Blog", "", "", "https://example.com/feed.xml", nil)
+	log.SetOutput(os.Stderr)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest("GET", "/api/backup", nil)
+	NewServer(db, "127.0.0.1:8000").handler().ServeHTTP(recorder, request)
+
+	body, _ := io.ReadAll(recorder.Result().Body)
+	if recorder.Code != http.StatusOK || !strings.HasPrefix(string(body), "SQLite format 3") {
+		t.Fatalf("expected database snapshot, got %d %q", recorder.Code, body[:min(len(body), 32)])
+	}
+}
+
+func TestCredentialsReload(t *testing.T) {
+	log.SetOutput(io.Discard)
+	db, _ := storage.New(":memory:")
+	log.SetOutput(os.Stderr)
+
+	server := NewServer(db, "127.0.0.1:8000")
+	handler := server.handler()
+	status := func() int {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/api/status", nil))
+		return recorder.Result().StatusCode
+	}
+
+	if got := status(); got != 200 {
+		t.Fatalf("expected 200 without auth, got %d", got)
+	}
+	server.SetCredentials("user", "pass")
+	if got := status(); got != 401 {
+		t.Fatalf("expected 401 after enabling auth, got %d", got)
+	}
+	server.SetCredentials("", "")
+	if got := status(); got != 200 {
+		t.Fatalf("expected 200 after disabling auth, got %d", got)
+	}
+}
+
+func TestCredentialsRename(t *testing.T) {
+	log.SetOutput(io.Discard)
+	db, _ := storage.New(":memory:")
+	log.SetOutput(os.Stderr)
+
+	server := NewServer(db, "127.0.0.1:8000")
+	server.SetCredentials("admin", "secret")
+	db.CreateAPIToken(storage.DefaultUserId, "script", auth.HashToken("token"), auth.ScopeWrite)
+
+	// the account follows the new username
+	server.SetCredentials("root", "secret")
+	if db.GetUserByName("admin") != nil {
+		t.Error("expected the former username to be gone")
+	}
+	if root := db.GetUserByName("root"); root == nil || root.Id != storage.DefaultUserId || !root.IsAdmin {
+		t.Fatalf("expected the admin to be renamed, got %v", root)
+	}
+	if root := db.GetUser(storage.DefaultUserId); root.FeverKey != feverKey("root", "secret") {
+		t.Error("expected the Fever key of the new username")
+	}
+
+	// handing the credentials over to another user retires the former admin
+	alice := db.CreateUser("alice", "", false)
+	server.SetCredentials("alice", "pass")
+	if root := db.GetUser(storage.DefaultUserId); !root.Disabled || root.IsAdmin {
+		t.Errorf("expected the former admin to be disabled & demoted, got %v", root)
+	}
+	if user := db.GetUser(alice.Id); user.Disabled || !user.IsAdmin {
+		t.Errorf("expected the new admin, got %v", user)
+	}
+	request := httptest.NewRequest("GET", "/api/feeds", nil)
+	request.Header.Set("Authorization", "Bearer token")
+	recorder := httptest.NewRecorder()
+	server.handler().ServeHTTP(recorder, request)
+	if recorder.Code == http.StatusOK {
+		t.Error("expected the former admin's token to stop working")
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	log.SetOutput(io.Discard)
+	db, _ := storage.New(":memory:")
+	log.SetOutput(os.Stderr)
+	db.CreateFeed("feed", "", "", "http://example.com/feed.xml", nil)
+
+	server := NewServer(db, "127.0.0.1:8000")
+	server.SetCredentials("user", "pass")
+	server.MetricsToken = "secret"
+	handler := server.handler()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if recorder.Result().StatusCode != 401 {
+		t.Fatalf("expected 401 without token, got %d", recorder.Result().StatusCode)
+	}
+
+	recorder = httptest.NewRecorder()
+	request := httptest.NewRequest("GET", "/metrics", nil)
+	request.Header.Set("Authorization", "Bearer secret")
+	handler.ServeHTTP(recorder, request)
+	if recorder.Result().StatusCode != 200 {
+		t.Fatalf("expected 200 with token, got %d", recorder.Result().StatusCode)
+	}
+	body := recorder.Body.String()
+	for _, line := range []string{
+		"readn_feeds 1\n",
+		"readn_feeds_pending 0\n",
+		`readn_http_request_duration_seconds_count{route="/metrics",method="GET",code="401"} 1`,
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("missing %q in:\n%s", line, body)
+		}
+	}
+}
+
+func TestHealth(t *testing.T) {
+	log.SetOutput(io.Discard)
+	db, _ := storage.New(":memory:")
+	log.SetOutput(os.Stderr)
+
+	server := NewServer(db, "127.0.0.1:8000")
+	server.SetCredentials("user", "pass")
+	handler := server.handler()
+
+	for _, url := range []string{"/healthz", "/readyz"} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", url, nil))
+		if recorder.Result().StatusCode != 200 {
+			t.Fatalf("%s: expected 200 without login, got %d", url, recorder.Result().StatusCode)
+		}
+		var status healthStatus
+		if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+			t.Fatal(err)
+		}
+		if status.Status != "ok" || status.Worker != "idle" || status.SchemaVersion != status.SchemaLatest || status.LastRefresh != nil {
+			t.Errorf("%s: unexpected status %+v", url, status)
+		}
+	}
+
+	server.Shutdown(context.Background())
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/healthz", nil))
+	if recorder.Result().StatusCode != 503 {
+		t.Fatalf("expected 503 once the database is closed, got %d", recorder.Result().StatusCode)
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	log.SetOutput(io.Discard)
+	db, _ := storage.New(":memory:")
+	log.SetOutput(os.Stderr)
+	handler := NewServer(db, "127.0.0.1:8000").handler()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("POST", "/api/folders/1", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", recorder.Code)
+	}
+	if allow := recorder.Header().Get("Allow"); allow != "DELETE, PUT" {
+		t.Errorf("invalid Allow header: %q", allow)
+	}
+}
+
+// Returns the CSRF token the index page gets for the cookie.
+func csrfToken(handler http.Handler, cookie *http.Cookie) string {
+	request := httptest.NewRequest("GET", "/", nil)
+	request.AddCookie(cookie)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	match := regexp.MustCompile(`csrf_token = "([^"]+)"`).FindStringSubmatch(recorder.Body.String())
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+func TestUsers(t *testing.T) {
+	log.SetOutput(io.Discard)
+	db, _ := storage.New(":memory:")
+	log.SetOutput(os.Stderr)
+	db.CreateFeed("feed", "", "", "http://example.com/feed.xml", nil)
+
+	server := NewServer(db, "127.0.0.1:8000")
+	server.SetCredentials("admin", "secret")
+	handler := server.handler()
+
+	login := func(username, password string) *http.Cookie {
+		form := url.Values{"username": {username}, "password": {password}}
+		request := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		for _, cookie := range recorder.Result().Cookies() {
+			if cookie.Name == "auth" {
+				return cookie
+			}
+		}
+		return nil
+	}
+	call := func(cookie *http.Cookie, method, url, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, url, strings.NewReader(body))
+		if cookie != nil {
+			request.AddCookie(cookie)
+			request.Header.Set("X-CSRF-Token", csrfToken(handler, cookie))
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	admin := login("admin", "secret")
+	if admin == nil {
+		t.Fatal("expected the admin to log in")
+	}
+	// the admin takes over the data of the single-user install
+	if body := call(admin, "GET", "/api/feeds", "").Body.String(); !strings.Contains(body, "example.com") {
+		t.Errorf("expected the existing feeds, got %s", body)
+	}
+
+	recorder := call(admin, "POST", "/api/users", `{"username": "alice", "password": "pass"}`)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", recorder.Code)
+	}
+	var alice storage.User
+	json.Unmarshal(recorder.Body.Bytes(), &alice)
+	if code := call(admin, "POST", "/api/users", `{"username": "alice", "password": "pass"}`).Code; code != http.StatusConflict {
+		t.Errorf("expected 409 for a taken username, got %d", code)
+	}
+
+	user := login("alice", "pass")
+	if user == nil {
+		t.Fatal("expected the new user to log in")
+	}
+	if body := call(user, "GET", "/api/feeds", "").Body.String(); body != "[]\n" {
+		t.Errorf("expected no feeds, got %s", body)
+	}
+	if code := call(user, "GET", "/api/users", "").Code; code != http.StatusForbidden {
+		t.Errorf("expected 403 for a regular user, got %d", code)
+	}
+
+	call(user, "PUT", "/api/account/fever", `{"password": "fever"}`)
+	form := url.Values{"api_key": {feverKey("alice", "fever")}}
+	request := httptest.NewRequest("POST", "/fever/?api", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if !strings.Contains(recorder.Body.String(), `"auth":1`) {
+		t.Errorf("expected fever login, got %s", recorder.Body.String())
+	}
+
+	path := fmt.Sprintf("/api/users/%d", alice.Id)
+	if code := call(admin, "PUT", path, `{"disabled": true}`).Code; code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if code := call(user, "GET", "/api/feeds", "").Code; code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a disabled user, got %d", code)
+	}
+	if login("alice", "pass") != nil {
+		t.Error("expected a disabled user not to log in")
+	}
+	if code := call(admin, "PUT", "/api/users/1", `{"disabled": true}`).Code; code != http.StatusBadRequest {
+		t.Errorf("expected the admin not to disable themselves, got %d", code)
+	}
+
+	// reloading the credentials keeps the Fever password of the admin
+	call(admin, "PUT", "/api/account/fever", `{"password": ""}`)
+	server.SetCredentials("admin", "secret")
+	if key := db.GetUser(storage.DefaultUserId).FeverKey; key != "" {
+		t.Errorf("expected the Fever API to stay off, got %q", key)
+	}
+	server.SetCredentials("admin", "changed")
+	if key := db.GetUser(storage.DefaultUserId).FeverKey; key != feverKey("admin", "changed") {
+		t.Errorf("expected a new password to reset the Fever password, got %q", key)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	log.SetOutput(io.Discard)
+	db, _ := storage.New(":memory:")
+	log.SetOutput(os.Stderr)
+
+	server := NewServer(db, "127.0.0.1:8000")
+	server.SetCredentials("admin", "secret")
+	handler := server.handler()
+
+	login := func(userAgent string) *http.Cookie {
+		form := url.Values{"username": {"admin"}, "password": {"secret"}}
+		request := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("User-Agent", userAgent)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		for _, cookie := range recorder.Result().Cookies() {
+			if cookie.Name == "auth" {
+				return cookie
+			}
+		}
+		t.Fatal("expected a session cookie")
+		return nil
+	}
+	call := func(cookie *http.Cookie, method, url string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, url, nil)
+		request.AddCookie(cookie)
+		request.Header.Set("X-CSRF-Token", csrfToken(handler, cookie))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	laptop := login("laptop")
+	if !laptop.HttpOnly || laptop.SameSite != http.SameSiteLaxMode {
+		t.Errorf("expected an HttpOnly & SameSite cookie, got %v", laptop)
+	}
+	phone := login("phone")
+	tablet := login("tablet")
+
+	var sessions []struct {
+		Id        int64  `json:"id"`
+		UserAgent string `json:"user_agent"`
+		Current   bool   `json:"current"`
+	}
+	json.Unmarshal(call(laptop, "GET", "/api/account/sessions").Body.Bytes(), &sessions)
+	if len(sessions) != 3 {
+		t.Fatalf("expected 3 sessions, got %v", sessions)
+	}
+	for _, session := range sessions {
+		if session.Current != (session.UserAgent == "laptop") {
+			t.Errorf("unexpected current session: %v", session)
+		}
+	}
+
+	// logging out revokes the current session only
+	call(tablet, "POST", "/logout")
+	if code := call(tablet, "GET", "/api/feeds").Code; code != http.StatusUnauthorized {
+		t.Errorf("expected the session to be revoked, got %d", code)
+	}
+	if code := call(phone, "GET", "/api/feeds").Code; code != http.StatusOK {
+		t.Errorf("expected other sessions to stay, got %d", code)
+	}
+
+	call(laptop, "DELETE", "/api/account/sessions")
+	if code := call(phone, "GET", "/api/feeds").Code; code != http.StatusUnauthorized {
+		t.Errorf("expected other sessions to be signed out, got %d", code)
+	}
+	if code := call(laptop, "GET", "/api/feeds").Code; code != http.StatusOK {
+		t.Errorf("expected the current session to stay, got %d", code)
+	}
+
+	// a new password signs out everywhere
+	server.SetCredentials("admin", "changed")
+	if code := call(laptop, "GET", "/api/feeds").Code; code != http.StatusUnauthorized {
+		t.Errorf("expected sessions to end on password change, got %d", code)
+	}
+}
+
+func TestAPITokens(t *testing.T) {
+	log.SetOutput(io.Discard)
+	db, _ := storage.New(":memory:")
+	log.SetOutput(os.Stderr)
+
+	server := NewServer(db, "127.0.0.1:8000")
+	server.SetCredentials("admin", "secret")
+	handler := server.handler()
+
+	form := url.Values{"username": {"admin"}, "password": {"secret"}}
+	request := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	session := recorder.Result().Cookies()[0]
+
+	call := func(token, method, url, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, url, strings.NewReader(body))
+		if token == "" {
+			request.AddCookie(session)
+			request.Header.Set("X-CSRF-Token", csrfToken(handler, session))
+		} else {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+	create := func(token, scope string) (int, string) {
+		recorder := call(token, "POST", "/api/account/tokens", `{"name": "script", "scope": "`+scope+`"}`)
+		var body struct {
+			Token string `json:"token"`
+		}
+		json.Unmarshal(recorder.Body.Bytes(), &body)
+		return recorder.Code, body.Token
+	}
+
+	_, read := create("", "read")
+	_, write := create("", "write")
+	if read == "" || write == "" {
+		t.Fatal("expected the tokens to be returned")
+	}
+
+	if code := call(read, "GET", "/api/feeds", "").Code; code != http.StatusOK {
+		t.Errorf("expected a read token to list feeds, got %d", code)
+	}
+	if code := call(read, "POST", "/api/folders", `{"title": "test"}`).Code; code != http.StatusForbidden {
+		t.Errorf("expected a read token not to write, got %d", code)
+	}
+	if code := call(write, "POST", "/api/folders", `{"title": "test"}`).Code; code != http.StatusCreated {
+		t.Errorf("expected a write token to write, got %d", code)
+	}
+	if code := call(write, "GET", "/api/users", "").Code; code != http.StatusForbidden {
+		t.Errorf("expected a write token not to reach the admin api, got %d", code)
+	}
+	if code, _ := create(write, "admin"); code != http.StatusForbidden {
+		t.Errorf("expected a token not to create a wider one, got %d", code)
+	}
+	code, admin := create("", "admin")
+	if code != http.StatusCreated {
+		t.Fatalf("expected an admin to create an admin token, got %d", code)
+	}
+	if code := call(admin, "GET", "/api/users", "").Code; code != http.StatusOK {
+		t.Errorf("expected an admin token to reach the admin api, got %d", code)
+	}
+	call(write, "PUT", "/api/settings", `{"refresh_rate": 7}`)
+	if rate := db.GetSettingsValueInt64("refresh_rate"); rate == 7 {
+		t.Error("expected a write token not to change the global settings")
+	}
+	call(admin, "PUT", "/api/settings", `{"refresh_rate": 7}`)
+	if rate := db.GetSettingsValueInt64("refresh_rate"); rate != 7 {
+		t.Errorf("expected an admin token to change the global settings, got %d", rate)
+	}
+	if code := call("bogus", "GET", "/api/feeds", "").Code; code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an unknown token, got %d", code)
+	}
+	// the read & write tokens can't take over the account
+	for _, token := range []string{read, write} {
+		for _, req := range [][3]string{
+			{"PUT", "/api/account/fever", `{"password": "fever"}`},
+			{"POST", "/api/account/totp", ""},
+			{"DELETE", "/api/account/sessions", ""},
+			{"GET", "/api/account/tokens", ""},
+			{"POST", "/api/account/tokens", `{"name": "script", "scope": "read"}`},
+		} {
+			if code := call(token, req[0], req[1], req[2]).Code; code != http.StatusForbidden {
+				t.Errorf("expected a token not to reach %s %s, got %d", req[0], req[1], code)
+			}
+		}
+	}
+	if code := call(write, "GET", "/api/account", "").Code; code != http.StatusOK {
+		t.Errorf("expected a token to read the account, got %d", code)
+	}
+	if code := call(admin, "GET", "/api/account/tokens", "").Code; code != http.StatusOK {
+		t.Errorf("expected an admin token to manage the account, got %d", code)
+	}
+
+	var tokens []storage.APIToken
+	json.Unmarshal(call("", "GET", "/api/account/tokens", "").Body.Bytes(), &tokens)
+	if len(tokens) != 3 || tokens[0].LastUsed == nil || tokens[1].Scope != "write" {
+		t.Fatalf("unexpected tokens: %v", tokens)
+	}
+	call("", "DELETE", fmt.Sprintf("/api/account/tokens/%d", tokens[0].Id), "")
+	if code := call(read, "GET", "/api/feeds", "").Code; code != http.StatusUnauthorized {
+		t.Errorf("expected a deleted token to stop working, got %d", code)
+	}
+}
+
+func TestProxyAuth(t *testing.T) {
+	log.SetOutput(io.Discard)
+	db, _ := storage.New(":memory:")
+	log.SetOutput(os.Stderr)
+
+	server := NewServer(db, "127.0.0.1:8000")
+	server.BasePath = "/reader"
+	server.AuthHeader = "Remote-User"
+	server.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}
+	backend := httptest.NewServer(server.handler())
+	defer backend.Close()
+
+	// fake SSO proxy passing the username along
+	target, _ := url.Parse(backend.URL)
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		req.Header.Set("Remote-User", req.URL.Query().Get("as"))
+	}
+	frontend := httptest.NewServer(proxy)
+	defer frontend.Close()
+
+	res, err := http.Get(frontend.URL + "/reader/api/account?as=alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var user storage.User
+	json.NewDecoder(res.Body).Decode(&user)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || user.Username != "alice" || user.IsAdmin {
+		t.Fatalf("expected a new regular user, got %d %v", res.StatusCode, user)
+	}
+
+	res, _ = http.Get(frontend.URL + "/reader/api/users?as=admin")
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected the admin to be recognized, got %d", res.StatusCode)
+	}
+
+	// the header is ignored from other addresses
+	request := httptest.NewRequest("GET", "/reader/api/account", nil)
+	request.RemoteAddr = "192.0.2.1:1234"
+	request.Header.Set("Remote-User", "alice")
+	recorder := httptest.NewRecorder()
+	server.handler().ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an untrusted address, got %d", recorder.Code)
+	}
+
+	// requests over a unix socket are trusted
+	socket := filepath.Join(t.TempDir(), "readn.sock")
+	server.Addr = "unix:" + socket
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go http.Serve(ln, server.handler())
+	defer ln.Close()
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return net.Dial("unix", socket)
+		},
+	}}
+	request, _ = http.NewRequest("GET", "http://readn/reader/api/account", nil)
+	request.Header.Set("Remote-User", "bob")
+	res, err = client.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.NewDecoder(res.Body).Decode(&user)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || user.Username != "bob" {
+		t.Errorf("expected the unix socket to be trusted, got %d %v", res.StatusCode, user)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	log.SetOutput(io.Discard)
+	db, _ := storage.New(":memory:")
+	log.SetOutput(os.Stderr)
+
+	server := NewServer(db, "127.0.0.1:8000")
+	server.SetCredentials("admin", "secret")
+	handler := server.handler()
+
+	login := func(password, remote string) *httptest.ResponseRecorder {
+		form := url.Values{"username": {"admin"}, "password": {password}}
+		request := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.RemoteAddr = remote
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	for i := 0; i < 6; i++ {
+		login("wrong", "192.0.2.1:1234")
+	}
+	recorder := login("secret", "192.0.2.1:1234")
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected the client to be locked out, got %d", recorder.Code)
+	}
+	// the username is locked out for everyone
+	if code := login("secret", "198.51.100.1:1234").Code; code != http.StatusTooManyRequests {
+		t.Fatalf("expected the username to be locked out, got %d", code)
+	}
+
+	// the locked out admin can still check with a token
+	db.CreateAPIToken(storage.DefaultUserId, "script", auth.HashToken("token"), auth.ScopeAdmin)
+	request := httptest.NewRequest("GET", "/api/lockouts", nil)
+	request.Header.Set("Authorization", "Bearer token")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	var lockouts []auth.Lockout
+	json.Unmarshal(recorder.Body.Bytes(), &lockouts)
+	if len(lockouts) != 2 || lockouts[0].Failures != 6 {
+		t.Fatalf("expected the address & username to be locked out, got %v", lockouts)
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	log.SetOutput(io.Discard)
+	db, _ := storage.New(":memory:")
+	log.SetOutput(os.Stderr)
+
+	server := NewServer(db, "127.0.0.1:8000")
+	server.SetCredentials("admin", "secret")
+	handler := server.handler()
+
+	post := func(form url.Values) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+	credentials := url.Values{"username": {"admin"}, "password": {"secret"}}
+	session := post(credentials).Result().Cookies()[0]
+	call := func(method, url, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, url, strings.NewReader(body))
+		request.AddCookie(session)
+		request.Header.Set("X-CSRF-Token", csrfToken(handler, session))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	var setup struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+	}
+	json.Unmarshal(call("POST", "/api/account/totp", "").Body.Bytes(), &setup)
+	if setup.Secret == "" || !strings.HasPrefix(setup.URI, "otpauth://totp/Readn:admin?") {
+		t.Fatalf("unexpected setup: %v", setup)
+	}
+	if code := call("POST", "/api/account/totp/confirm", `{"code": "000000"}`).Code; code != http.StatusBadRequest {
+		t.Errorf("expected a wrong code to be refused, got %d", code)
+	}
+	var confirm struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	body := fmt.Sprintf(`{"code": "%s"}`, auth.TOTPCode(setup.Secret, time.Now()))
+	json.Unmarshal(call("POST", "/api/account/totp/confirm", body).Body.Bytes(), &confirm)
+	if len(confirm.RecoveryCodes) == 0 {
+		t.Fatal("expected the recovery codes")
+	}
+
+	// the password alone is not enough anymore
+	recorder := post(credentials)
+	if len(recorder.Result().Cookies()) != 0 {
+		t.Fatal("expected no session before the code")
+	}
+	match := regexp.MustCompile(`name="challenge" type="hidden" value="([^"]+)"`).FindStringSubmatch(recorder.Body.String())
+	if match == nil {
+		t.Fatal("expected the code form")
+	}
+	challenge := match[1]
+	recorder = post(url.Values{"challenge": {challenge}, "code": {"000000"}})
+	if !strings.Contains(recorder.Body.String(), "Invalid code") {
+		t.Error("expected a wrong code to be refused")
+	}
+	recorder = post(url.Values{"challenge": {challenge}, "code": {confirm.RecoveryCodes[0]}})
+	if recorder.Code != http.StatusFound || len(recorder.Result().Cookies()) == 0 {
+		t.Fatalf("expected the recovery code to log in, got %d", recorder.Code)
+	}
+	// recovery codes work once
+	recorder = post(credentials)
+	challenge = regexp.MustCompile(`name="challenge" type="hidden" value="([^"]+)"`).FindStringSubmatch(recorder.Body.String())[1]
+	recorder = post(url.Values{"challenge": {challenge}, "code": {confirm.RecoveryCodes[0]}})
+	if len(recorder.Result().Cookies()) != 0 {
+		t.Error("expected a used recovery code to be refused")
+	}
+
+	// the API tokens & Fever don't take a second factor
+	db.CreateAPIToken(storage.DefaultUserId, "script", auth.HashToken("token"), auth.ScopeRead)
+	request := httptest.NewRequest("GET", "/api/feeds", nil)
+	request.Header.Set("Authorization", "Bearer token")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected the token to work, got %d", recorder.Code)
+	}
+
+	body = fmt.Sprintf(`{"code": "%s"}`, confirm.RecoveryCodes[1])
+	if code := call("DELETE", "/api/account/totp", body).Code; code != http.StatusOK {
+		t.Fatalf("expected 2fa to be turned off, got %d", code)
+	}
+	if recorder := post(credentials); len(recorder.Result().Cookies()) == 0 {
+		t.Error("expected the password to be enough again")
+	}
+}
+
+func TestCSRF(t *testing.T) {
+	log.SetOutput(io.Discard)
+	db, _ := storage.New(":memory:")
+	log.SetOutput(os.Stderr)
+
+	server := NewServer(db, "127.0.0.1:8000")
+	handler := server.handler()
+
+	call := func(cookie *http.Cookie, token, origin string) int {
+		request := httptest.NewRequest("POST", "/api/folders", strings.NewReader(`{"title": "test"}`))
+		if cookie != nil {
+			request.AddCookie(cookie)
+		}
+		if token != "" {
+			request.Header.Set("X-CSRF-Token", token)
+		}
+		if origin != "" {
+			request.Header.Set("Origin", origin)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	// without auth, the scripts (no cookies) keep working
+	if code := call(nil, "", ""); code != http.StatusCreated {
+		t.Errorf("expected a cookieless request to pass, got %d", code)
+	}
+	if code := call(nil, "", "http://evil.example"); code != http.StatusForbidden {
+		t.Errorf("expected a cross-site request to fail, got %d", code)
+	}
+	// so do the client apps, but not the other sites' forms
+	for _, path := range []string{"/v1/categories", "/reader/api/0/mark-all-as-read", "/index.php/apps/news/api/v1-3/folders", "/fever/?api"} {
+		for _, origin := range []string{"", "http://evil.example"} {
+			request := httptest.NewRequest("POST", path, strings.NewReader(`{"title": "client"}`))
+			if origin != "" {
+				request.Header.Set("Origin", origin)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, request)
+			if forbidden := recorder.Code == http.StatusForbidden; forbidden != (origin != "") {
+				t.Errorf("unexpected status of %s from %q: %d", path, origin, recorder.Code)
+			}
+		}
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	cookie := recorder.Result().Cookies()[0]
+	token := csrfToken(handler, cookie)
+	if code := call(cookie, "", ""); code != http.StatusForbidden {
+		t.Errorf("expected a browser request without the token to fail, got %d", code)
+	}
+	if code := call(cookie, token, "http://example.com"); code != http.StatusCreated {
+		t.Errorf("expected a same-origin request with the token to pass, got %d", code)
+	}
+
+	server.SetCredentials("admin", "secret")
+	form := url.Values{"username": {"admin"}, "password": {"secret"}}
+	request := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Origin", "http://evil.example")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("expected a cross-site login to fail, got %d", recorder.Code)
+	}
+	request.Header.Del("Origin")
+	request.Body = io.NopCloser(strings.NewReader(form.Encode()))
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	session := recorder.Result().Cookies()[0]
+
+	token = csrfToken(handler, session)
+	if code := call(session, "", ""); code != http.StatusForbidden {
+		t.Errorf("expected a request without the token to fail, got %d", code)
+	}
+	if code := call(session, "bogus", ""); code != http.StatusForbidden {
+		t.Errorf("expected a request with a wrong token to fail, got %d", code)
+	}
+	if code := call(session, token, "http://evil.example"); code != http.StatusForbidden {
+		t.Errorf("expected a cross-site request to fail, got %d", code)
+	}
+	if code := call(session, token, ""); code != http.StatusCreated {
+		t.Errorf("expected a request with the token to pass, got %d", code)
+	}
+
+	// bearer tokens are not sent by the browsers on their own
+	db.CreateAPIToken(storage.DefaultUserId, "script", auth.HashToken("token"), auth.ScopeWrite)
+	request = httptest.NewRequest("POST", "/api/folders", strings.NewReader(`{"title": "script"}`))
+	request.Header.Set("Authorization", "Bearer token")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusCreated {
+		t.Errorf("expected a bearer request to pass, got %d", recorder.Code)
+	}
+}
+
+func TestGoogleReader(t *testing.T) {
+	log.SetOutput(io.Discard)
+	db, _ := storage.New(":memory:")
+	tech := db.CreateFolder("Tech", nil)
+	feed := db.CreateFeed("Blog", "", "https://example.com", "https://example.com/feed.xml", &tech.Id)
+	db.CreateItems([]storage.Item{
+		{GUID: "1", FeedId: feed.Id, Title: "First", Date: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{GUID: "2", FeedId: feed.Id, Title: "Second", Date: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)},
+	})
+	log.SetOutput(os.Stderr)
+
+	server := NewServer(db, "127.0.0.1:8000")
+	server.SetCredentials("admin", "secret")
+	handler := server.handler()
+
+	login := func(password, agent string) (int, string) {
+		form := url.Values{"Email": {"admin"}, "Passwd": {password}}
+		request := httptest.NewRequest("POST", "/accounts/ClientLogin", strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("User-Agent", agent)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		_, token, _ := strings.Cut(recorder.Body.String(), "Auth=")
+		return recorder.Code, strings.TrimSpace(token)
+	}
+	if code, _ := login("wrong", "Phone"); code != http.StatusUnauthorized {
+		t.Fatalf("expected a wrong password to fail, got %d", code)
+	}
+	code, phone := login("secret", "Phone")
+	if code != http.StatusOK || phone == "" {
+		t.Fatalf("expected a token, got %d", code)
+	}
+	// the devices don't log each other out
+	_, token := login("secret", "Desktop")
+	tokens := db.ListAPITokens(storage.DefaultUserId)
+	if len(tokens) != 2 || tokens[0].Name != "Google Reader (Phone)" || tokens[1].Name != "Google Reader (Desktop)" {
+		t.Errorf("expected a token per device, got %v", tokens)
+	}
+	request := httptest.NewRequest("GET", "/reader/api/0/subscription/list", nil)
+	request.Header.Set("Authorization", "GoogleLogin auth="+phone)
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected the first device's token to keep working, got %d", recorder.Code)
+	}
+
+	call := func(method, path string, form url.Values, out interface{}) int {
+		request := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		request.Header.Set("Authorization", "GoogleLogin auth="+token)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if out != nil {
+			json.Unmarshal(recorder.Body.Bytes(), out)
+		}
+		return recorder.Code
+	}
+	unread := func(stream string) int64 {
+		var body struct {
+			Counts []GReaderUnreadCount `json:"unreadcounts"`
+		}
+		call("GET", "/reader/api/0/unread-count", nil, &body)
+		for _, count := range body.Counts {
+			if count.ID == stream {
+				return count.Count
+			}
+		}
+		return -1
+	}
+	feedStream := fmt.Sprintf("feed/%d", feed.Id)
+
+	var subscriptions struct {
+		Subscriptions []GReaderSubscription `json:"subscriptions"`
+	}
+	call("GET", "/reader/api/0/subscription/list", nil, &subscriptions)
+	if len(subscriptions.Subscriptions) != 1 || subscriptions.Subscriptions[0].ID != feedStream ||
+		subscriptions.Subscriptions[0].Categories[0].ID != "user/-/label/Tech" {
+		t.Fatalf("unexpected subscriptions: %v", subscriptions)
+	}
+	if n := unread("user/-/label/Tech"); n != 2 {
+		t.Fatalf("expected 2 unread items in the folder, got %d", n)
+	}
+
+	var ids struct {
+		Refs         []GReaderItemRef `json:"itemRefs"`
+		Continuation string           `json:"continuation"`
+	}
+	call("GET", "/reader/api/0/stream/items/ids?s=user/-/state/com.google/reading-list&xt=user/-/state/com.google/read&n=1", nil, &ids)
+	if len(ids.Refs) != 1 || ids.Continuation == "" {
+		t.Fatalf("expected a page of 1 item, got %v", ids)
+	}
+	first := ids.Refs[0].ID
+	call("GET", "/reader/api/0/stream/items/ids?s=user/-/label/Tech&n=1&c="+ids.Continuation, nil, &ids)
+	if len(ids.Refs) != 1 || ids.Refs[0].ID == first {
+		t.Fatalf("expected the next page, got %v", ids)
+	}
+
+	var contents struct {
+		Items []GReaderItem `json:"items"`
+	}
+	call("POST", "/reader/api/0/stream/items/contents", url.Values{"i": {first}}, &contents)
+	if len(contents.Items) != 1 || contents.Items[0].Title != "Second" || contents.Items[0].Origin.StreamID != feedStream {
+		t.Fatalf("unexpected items: %v", contents)
+	}
+	longId := contents.Items[0].ID
+
+	edit := url.Values{"i": {longId}, "a": {"user/-/state/com.google/read", "user/-/label/later"}}
+	if code := call("POST", "/reader/api/0/edit-tag", edit, nil); code != http.StatusOK {
+		t.Fatalf("expected edit-tag to succeed, got %d", code)
+	}
+	if n := unread(feedStream); n != 1 {
+		t.Fatalf("expected 1 unread item, got %d", n)
+	}
+	call("GET", "/reader/api/0/stream/contents/user/-/label/later", nil, &contents)
+	if len(contents.Items) != 1 || contents.Items[0].ID != longId {
+		t.Fatalf("expected the labeled item, got %v", contents)
+	}
+	call("POST", "/reader/api/0/edit-tag", url.Values{"i": {first}, "a": {"user/-/state/com.google/starred"}}, nil)
+	call("GET", "/reader/api/0/stream/contents/user/-/state/com.google/starred", nil, &contents)
+	if len(contents.Items) != 1 || !slices.Contains(contents.Items[0].Categories, "user/-/state/com.google/starred") {
+		t.Fatalf("expected the starred item, got %v", contents)
+	}
+
+	call("POST", "/reader/api/0/mark-all-as-read", url.Values{"s": {feedStream}}, nil)
+	if n := unread("user/-/state/com.google/reading-list"); n != 0 {
+		t.Fatalf("expected no unread items, got %d", n)
+	}
+
+	edit = url.Values{"ac": {"edit"}, "s": {feedStream}, "t": {"Renamed"}, "a": {"user/-/label/News/Daily"}}
+	call("POST", "/reader/api/0/subscription/edit", edit, nil)
+	call("GET", "/reader/api/0/subscription/list", nil, &subscriptions)
+	if sub := subscriptions.Subscriptions[0]; sub.Title != "Renamed" || sub.Categories[0].Label != "News/Daily" {
+		t.Fatalf("expected the feed to be renamed & moved, got %v", sub)
+	}
+	call("POST", "/reader/api/0/subscription/edit", url.Values{"ac": {"unsubscribe"}, "s": {feedStream}}, nil)
+	call("GET", "/reader/api/0/subscription/list", nil, &subscriptions)
+	if len(subscriptions.Subscriptions) != 0 {
+		t.Fatalf("expected no subscriptions, got %v", subscriptions)
+	}
+
+	db.CreateAPIToken(storage.DefaultUserId, "reader", auth.HashToken("read"), auth.ScopeRead)
+	token = "read"
+	if code := call("GET", "/reader/api/0/tag/list", nil, nil); code != http.StatusOK {
+		t.Errorf("expected a read token to list tags, got %d", code)
+	}
+	if code := call("POST", "/reader/api/0/mark-all-as-read", url.Values{"s": {feedStream}}, nil); code != http.StatusForbidden {
+		t.Errorf("expected a read token not to write, got %d", code)
+	}
+	token = "bogus"
+	if code := call("GET", "/reader/api/0/tag/list", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("expected an unknown token to fail, got %d", code)
+	}
+}
+
+func TestGoogleReaderUnreadCount(t *testing.T) {
+	log.SetOutput(io.Discard)
+	db, _ := storage.New(":memory:")
+	tech := db.CreateFolder("Tech", nil)
+	blogs := db.CreateFolder("Blogs", &tech.Id)
+	news := db.CreateFolder("News", nil)
+	blog := db.CreateFeed("Blog", "", "https://example.com", "https://example.com/feed.xml", &blogs.Id)
+	daily := db.CreateFeed("Daily", "", "https://example.org", "https://example.org/feed.xml", &news.Id)
+	may, june := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	db.CreateItems([]storage.Item{
+		{GUID: "1", FeedId: blog.Id, Title: "Blog", Date: may},
+		{GUID: "2", FeedId: daily.Id, Title: "Daily", Date: june},
+	})
+	log.SetOutput(os.Stderr)
+
+	recorder := httptest.NewRecorder()
+	NewServer(db, "127.0.0.1:8000").handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/reader/api/0/unread-count", nil))
+	var body struct {
+		Counts []GReaderUnreadCount `json:"unreadcounts"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &body)
+	have := make(map[string]string)
+	for _, count := range body.Counts {
+		have[count.ID] = count.NewestItemTimestampUsec
+	}
+	want := map[string]string{
+		greaderFeed(blog.Id):       usec(may),
+		greaderFeed(daily.Id):      usec(june),
+		greaderLabel("Tech"):       usec(may),
+		greaderLabel("Tech/Blogs"): usec(may),
+		greaderLabel("News"):       usec(june),
+		greaderReadingList:         usec(june),
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("unexpected newest items\nwant: %v\nhave: %v", want, have)
+	}
+}
+
+func TestMiniflux(t *testing.T) {
+	log.SetOutput(io.Discard)
+	db, _ := storage.New(":memory:")
+	tech := db.CreateFolder("Tech", nil)
+	blogs := db.CreateFolder("Blogs", &tech.Id)
+	feed := db.CreateFeed("Blog", "", "https://example.com", "https://example.com/feed.xml", &blogs.Id)
+	other := db.CreateFeed("Other", "", "https://example.org", "https://example.org/feed.xml", nil)
+	icon := []byte("GIF89a")
+	db.UpdateFeedIcon(feed.Id, &icon)
+	db.CreateItems([]storage.Item{
+		{GUID: "1", FeedId: feed.Id, Title: "First", Date: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{GUID: "2", FeedId: feed.Id, Title: "Second", Date: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)},
+		{GUID: "3", FeedId: other.Id, Title: "Third", Date: time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC)},
+	})
+	first := db.ListItems(storage.ItemFilter{}, 1, false, false)[0].Id
+	db.CreateAPIToken(storage.DefaultUserId, "miniflux", auth.HashToken("token"), auth.ScopeWrite)
+	log.SetOutput(os.Stderr)
+
+	server := NewServer(db, "127.0.0.1:8000")
+	server.SetCredentials("admin", "secret")
+	handler := server.handler()
+
+	// requests as sent by the clients, with the parts of the responses they rely on
+	requests := []struct {
+		method, path, body string
+		status             int
+		want               []string
+	}{
+		{"GET", "/v1/me", "", 200, []string{`"username":"admin"`}},
+		{"GET", "/v1/categories?counts=true", "", 200, []string{
+			`{"id":0,"title":"Uncategorized","user_id":1,"hide_globally":false,"feed_count":1,"total_unread":1}`,
+			fmt.Sprintf(`{"id":%d,"title":"Tech/Blogs","user_id":1,"hide_globally":false,"feed_count":1,"total_unread":2}`, blogs.Id),
+		}},
+		{"GET", "/v1/feeds", "", 200, []string{
+			`"feed_url":"https://example.com/feed.xml"`,
+			fmt.Sprintf(`"icon":{"feed_id":%d,"icon_id":%d}`, feed.Id, feed.Id),
+			`"category":{"id":0,"title":"Uncategorized"`,
+		}},
+		{"GET", fmt.Sprintf("/v1/categories/%d/feeds", blogs.Id), "", 200, []string{`"title":"Blog"`}},
+		{"GET", fmt.Sprintf("/v1/feeds/%d/icon", feed.Id), "", 200, []string{`"data":"image/gif;base64,R0lGODlh","mime_type":"image/gif"`}},
+		{"GET", fmt.Sprintf("/v1/feeds/%d/icon", other.Id), "", 404, []string{`"error_message"`}},
+		{"GET", "/v1/entries?status=unread&direction=desc&limit=2", "", 200, []string{
+			`"total":3`, `"title":"Third"`, `"title":"Second"`, `"status":"unread"`,
+		}},
+		{"GET", fmt.Sprintf("/v1/entries?category_id=%d&offset=1&limit=1", tech.Id), "", 200, []string{`"total":2`, `"title":"Second"`}},
+		{"PUT", "/v1/entries", fmt.Sprintf(`{"entry_ids":[%d],"status":"read"}`, first), 204, nil},
+		{"PUT", fmt.Sprintf("/v1/entries/%d/bookmark", first+1), "", 204, nil},
+		{"GET", "/v1/entries?starred=true", "", 200, []string{`"total":1`, `"title":"Second"`, `"starred":true`, `"status":"read"`}},
+		{"GET", "/v1/entries?status=read", "", 200, []string{`"total":2`}},
+		{"GET", "/v1/feeds/counters", "", 200, []string{
+			fmt.Sprintf(`"reads":{"%d":2,"%d":0}`, feed.Id, other.Id),
+			fmt.Sprintf(`"unreads":{"%d":0,"%d":1}`, feed.Id, other.Id),
+		}},
+		{"GET", fmt.Sprintf("/v1/feeds/%d/entries/%d", feed.Id, first), "", 200, []string{`"title":"First"`, `"feed":{`}},
+		{"GET", fmt.Sprintf("/v1/feeds/%d/entries/%d", other.Id, first), "", 404, nil},
+		{"PUT", "/v1/users/99/mark-all-as-read", "", 403, nil},
+		{"PUT", "/v1/users/bogus/mark-all-as-read", "", 403, nil},
+		{"GET", "/v1/entries?status=unread", "", 200, []string{`"total":1`}},
+		{"PUT", fmt.Sprintf("/v1/feeds/%d/mark-all-as-read", other.Id), "", 204, nil},
+		{"PUT", fmt.Sprintf("/v1/users/%d/mark-all-as-read", storage.DefaultUserId), "", 204, nil},
+		{"GET", "/v1/entries?status=unread", "", 200, []string{`"total":0`}},
+		{"POST", "/v1/categories", `{"title":"News"}`, 201, []string{`"title":"News"`}},
+		{"POST", "/v1/categories", `{"title":"News"}`, 400, nil},
+		{"PUT", fmt.Sprintf("/v1/feeds/%d", other.Id), fmt.Sprintf(`{"title":"Renamed","category_id":%d}`, tech.Id), 201, []string{
+			`"title":"Renamed"`, `"category":{"id":` + strconv.FormatInt(tech.Id, 10) + `,"title":"Tech"`,
+		}},
+		{"DELETE", fmt.Sprintf("/v1/feeds/%d", other.Id), "", 204, nil},
+		{"GET", fmt.Sprintf("/v1/feeds/%d", other.Id), "", 404, nil},
+	}
+	for _, r := range requests {
+		request := httptest.NewRequest(r.method, r.path, strings.NewReader(r.body))
+		request.Header.Set("X-Auth-Token", "token")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != r.status {
+			t.Fatalf("%s %s: expected %d, got %d: %s", r.method, r.path, r.status, recorder.Code, recorder.Body)
+		}
+		for _, want := range r.want {
+			if !strings.Contains(recorder.Body.String(), want) {
+				t.Errorf("%s %s: expected %s in %s", r.method, r.path, want, recorder.Body)
+			}
+		}
+	}
+
+	basic := func(username, password string) int {
+		request := httptest.NewRequest("GET", "/v1/me", nil)
+		request.SetBasicAuth(username, password)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+	if code := basic("admin", "secret"); code != http.StatusOK {
+		t.Errorf("expected basic auth to pass, got %d", code)
+	}
+	if code := basic("admin", "token"); code != http.StatusOK {
+		t.Errorf("expected a token in place of the password to pass, got %d", code)
+	}
+	if code := basic("admin", "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("expected a wrong password to fail, got %d", code)
+	}
+}
+
+func TestNextcloud(t *testing.T) {
+	log.SetOutput(io.Discard)
+	db, _ := storage.New(":memory:")
+	tech := db.CreateFolder("Tech", nil)
+	blogs := db.CreateFolder("Blogs", &tech.Id)
+	feed := db.CreateFeed("Blog", "", "https://example.com", "https://example.com/feed.xml", &blogs.Id)
+	other := db.CreateFeed("Other", "", "https://example.org", "https://example.org/feed.xml", nil)
+	db.CreateItems([]storage.Item{
+		{GUID: "1", FeedId: feed.Id, Title: "First", Date: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{GUID: "2", FeedId: feed.Id, Title: "Second", Date: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)},
+		{GUID: "3", FeedId: other.Id, Title: "Third", Date: time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC)},
+	})
+	log.SetOutput(os.Stderr)
+
+	server := NewServer(db, "127.0.0.1:8000")
+	server.SetCredentials("admin", "secret")
+	handler := server.handler()
+
+	password := "secret"
+	call := func(method, path, body string, out interface{}) int {
+		request := httptest.NewRequest(method, "/index.php/apps/news/api/v1-3"+path, strings.NewReader(body))
+		request.SetBasicAuth("admin", password)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if out != nil {
+			json.Unmarshal(recorder.Body.Bytes(), out)
+		}
+		return recorder.Code
+	}
+	type items struct {
+		Items []NextcloudItem `json:"items"`
+	}
+	ids := func(list items) []int64 {
+		result := make([]int64, 0)
+		for _, item := range list.Items {
+			result = append(result, item.ID)
+		}
+		return result
+	}
+
+	var folders struct {
+		Folders []NextcloudFolder `json:"folders"`
+	}
+	call("GET", "/folders", "", &folders)
+	if len(folders.Folders) != 2 || folders.Folders[0].Name != "Tech/Blogs" && folders.Folders[1].Name != "Tech/Blogs" {
+		t.Fatalf("unexpected folders: %v", folders)
+	}
+	var feeds struct {
+		Feeds        []NextcloudFeed `json:"feeds"`
+		NewestItemID int64           `json:"newestItemId"`
+	}
+	call("GET", "/feeds", "", &feeds)
+	if len(feeds.Feeds) != 2 || feeds.Feeds[0].UnreadCount != 2 || *feeds.Feeds[0].FolderID != blogs.Id || feeds.Feeds[1].FolderID != nil {
+		t.Fatalf("unexpected feeds: %v", feeds)
+	}
+	newest := feeds.NewestItemID
+
+	var list items
+	call("GET", "/items?batchSize=2&type=3&getRead=true", "", &list)
+	if have := ids(list); !reflect.DeepEqual(have, []int64{newest, newest - 1}) {
+		t.Fatalf("expected the 2 newest items, got %v", have)
+	}
+	call("GET", fmt.Sprintf("/items?batchSize=2&type=3&offset=%d", newest-1), "", &list)
+	if have := ids(list); !reflect.DeepEqual(have, []int64{newest - 2}) {
+		t.Fatalf("expected the next page, got %v", have)
+	}
+	call("GET", fmt.Sprintf("/items?type=1&id=%d&oldestFirst=true", tech.Id), "", &list)
+	if have := ids(list); !reflect.DeepEqual(have, []int64{newest - 2, newest - 1}) {
+		t.Fatalf("expected the items of the folder, got %v", have)
+	}
+	if code := call("GET", "/items?type=0&id=999", "", nil); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown feed, got %d", code)
+	}
+
+	since := time.Now().UnixMicro()
+	call("PUT", fmt.Sprintf("/items/%d/read", newest), "", nil)
+	call("POST", "/items/star/multiple", fmt.Sprintf(`{"itemIds": [%d]}`, newest-1), nil)
+	call("GET", "/items?type=3&getRead=false", "", &list)
+	if have := ids(list); !reflect.DeepEqual(have, []int64{newest - 2}) {
+		t.Fatalf("expected 1 unread item, got %v", have)
+	}
+	call("GET", "/items?type=2", "", &list)
+	if len(list.Items) != 1 || !list.Items[0].Starred || list.Items[0].Unread {
+		t.Fatalf("expected the starred item, got %v", list)
+	}
+	call("GET", fmt.Sprintf("/items/updated?type=3&lastModified=%d", since), "", &list)
+	if have := ids(list); !reflect.DeepEqual(have, []int64{newest - 1, newest}) {
+		t.Fatalf("expected the updated items, got %v", have)
+	}
+	call("PUT", fmt.Sprintf("/feeds/%d/read", feed.Id), fmt.Sprintf(`{"newestItemId": %d}`, newest), nil)
+	call("GET", "/items?type=3&getRead=false", "", &list)
+	if len(list.Items) != 0 {
+		t.Fatalf("expected no unread items, got %v", ids(list))
+	}
+	call("POST", "/items/unstar/multiple", fmt.Sprintf(`{"itemIds": [%d]}`, newest-1), nil)
+	call("POST", "/items/unread/multiple", fmt.Sprintf(`{"itemIds": [%d, %d]}`, newest-1, newest), nil)
+	call("GET", "/items?type=3&getRead=false", "", &list)
+	if have := ids(list); !reflect.DeepEqual(have, []int64{newest, newest - 1}) {
+		t.Fatalf("expected 2 unread items, got %v", have)
+	}
+
+	if code := call("POST", "/folders", `{"name": "News"}`, &folders); code != http.StatusOK || folders.Folders[0].Name != "News" {
+		t.Fatalf("expected the folder to be created, got %d", code)
+	}
+	if code := call("POST", "/folders", `{"name": "News"}`, nil); code != http.StatusConflict {
+		t.Fatalf("expected a conflict, got %d", code)
+	}
+	call("PUT", fmt.Sprintf("/feeds/%d/move", other.Id), fmt.Sprintf(`{"folderId": %d}`, folders.Folders[0].ID), nil)
+	call("PUT", fmt.Sprintf("/feeds/%d/rename", other.Id), `{"feedTitle": "Renamed"}`, nil)
+	call("GET", "/feeds", "", &feeds)
+	if f := feeds.Feeds[1]; f.Title != "Renamed" || f.FolderID == nil || *f.FolderID != folders.Folders[0].ID {
+		t.Fatalf("expected the feed to be moved & renamed, got %v", f)
+	}
+
+	password = "wrong"
+	if code := call("GET", "/feeds", "", nil); code != http.StatusUnauthorized {
+		t.Fatalf("expected a wrong password to fail, got %d", code)
+	}
+}
+
+func TestFever(t *testing.T) {
+	log.SetOutput(io.Discard)
+	db, _ := storage.New(":memory:")
+	tech := db.CreateFolder("Tech", nil)
+	spark := db.CreateFeed("Spark", "", "https://a.com", "https://a.com/feed.xml", &tech.Id)
+	blog := db.CreateFeed("Blog", "", "https://b.com", "https://b.com/feed.xml", &tech.Id)
+	news := db.CreateFeed("News", "", "https://c.com", "https://c.com/feed.xml", nil)
+	db.UpdateFeedSpark(spark.Id, true)
+	now := time.Now().UTC()
+	db.CreateItems([]storage.Item{
+		{GUID: "a1", FeedId: spark.Id, Title: "A1", Link: "https://a.com/1", Date: now.Add(-3 * time.Hour),
+			Content: `<a href="https://example.net/hot#top">hot</a> <a href="/1">self</a> <a href="https://c.com/1">c</a>`},
+		{GUID: "b1", FeedId: blog.Id, Title: "B1", Link: "https://b.com/1", Date: now.Add(-2 * time.Hour),
+			Content: `<a href="https://example.net/hot">Hot link</a> <a href="https://c.com/1">news</a>`},
+		{GUID: "b2", FeedId: blog.Id, Title: "B2", Link: "https://b.com/2", Date: now.Add(-time.Hour),
+			Content: `<a href="https://c.com/1">again</a>`},
+		{GUID: "c1", FeedId: news.Id, Title: "C1", Link: "https://c.com/1", Author: "Jane Roe", Date: now,
+			Content: `<a href="https://a.com/1">spark</a>`},
+		{GUID: "old", FeedId: news.Id, Title: "Old", Link: "https://c.com/0", Date: now.AddDate(0, 0, -30),
+			Content: `<a href="https://example.net/hot">old</a>`},
+	})
+	alice := db.CreateUser("alice", "", false)
+	db.UpdateUserFeverKey(alice.Id, feverKey("alice", "fever"))
+	db.ForUser(alice.Id).CreateFeed("Blog", "", "https://b.com", "https://b.com/feed.xml", nil)
+	log.SetOutput(os.Stderr)
+
+	server := NewServer(db, "127.0.0.1:8000")
+	server.SetCredentials("admin", "secret")
+	handler := server.handler()
+
+	call := func(key, query string, out interface{}) {
+		form := url.Values{"api_key": {key}}
+		request := httptest.NewRequest("POST", "/fever/?api&"+query, strings.NewReader(form.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if out != nil {
+			json.Unmarshal(recorder.Body.Bytes(), out)
+		}
+	}
+	admin := feverKey("admin", "secret")
+	unread := func(key string) string {
+		var ids struct {
+			IDs string `json:"unread_item_ids"`
+		}
+		call(key, "unread_item_ids", &ids)
+		return ids.IDs
+	}
+	items := make(map[string]storage.Item)
+	for _, item := range db.ListItems(storage.ItemFilter{}, 10, false, false) {
+		items[item.Title] = item
+	}
+	idsOf := func(titles ...string) string {
+		ids := make([]int64, len(titles))
+		for i, title := range titles {
+			ids[i] = items[title].Id
+		}
+		return joinInts(ids)
+	}
+
+	var feeds struct {
+		Feeds       []FeverFeed       `json:"feeds"`
+		FeedsGroups []FeverFeedsGroup `json:"feeds_groups"`
+	}
+	call(admin, "feeds", &feeds)
+	for _, feed := range feeds.Feeds {
+		if want := feed.ID == spark.Id; (feed.IsSpark == 1) != want {
+			t.Errorf("feed %s: expected is_spark %v", feed.Title, want)
+		}
+	}
+	if len(feeds.FeedsGroups) != 1 {
+		t.Errorf("expected the admin's group, got %v", feeds.FeedsGroups)
+	}
+	var groups struct {
+		Groups      []FeverGroup      `json:"groups"`
+		FeedsGroups []FeverFeedsGroup `json:"feeds_groups"`
+	}
+	call(feverKey("alice", "fever"), "groups", &groups)
+	if len(groups.Groups) != 0 || len(groups.FeedsGroups) != 0 {
+		t.Errorf("expected none of the admin's groups, got %v", groups)
+	}
+
+	var list struct {
+		Items []FeverItem `json:"items"`
+	}
+	call(admin, "items&with_ids="+idsOf("C1"), &list)
+	if len(list.Items) != 1 || list.Items[0].Author != "Jane Roe" {
+		t.Errorf("expected the item author, got %v", list.Items)
+	}
+
+	var links struct {
+		Links []FeverLink `json:"links"`
+	}
+	call(admin, "links", &links)
+	want := []FeverLink{
+		{
+			ID: feverLinkID("https://c.com/1"), FeedID: news.Id, ItemID: items["C1"].Id,
+			Temperature: 3, IsItem: 1, IsLocal: 1, Title: "C1",
+			Url: "https://c.com/1", ItemIDs: idsOf("B2", "B1", "A1"),
+		},
+		{
+			ID: feverLinkID("https://example.net/hot"), FeedID: blog.Id, ItemID: items["B1"].Id,
+			Temperature: 2, Title: "Hot link",
+			Url: "https://example.net/hot", ItemIDs: idsOf("B1", "A1"),
+		},
+	}
+	if !reflect.DeepEqual(links.Links, want) {
+		t.Errorf("unexpected links:\nwant: %+v\nhave: %+v", want, links.Links)
+	}
+	// the range is cut to a month, leaving the old item out
+	call(admin, "links&range=100000", &links)
+	if !reflect.DeepEqual(links.Links, want) {
+		t.Errorf("unexpected links of a long range:\nwant: %+v\nhave: %+v", want, links.Links)
+	}
+	// a month ago a single feed linked to it
+	call(admin, "links&offset=20&range=20", &links)
+	if len(links.Links) != 0 {
+		t.Errorf("expected no hot links, got %v", links.Links)
+	}
+	call(admin, "links&page=2", &links)
+	if len(links.Links) != 0 {
+		t.Errorf("expected an empty page, got %v", links.Links)
+	}
+
+	// kindling leaves the sparks alone
+	call(admin, "mark=group&as=read&id=0", nil)
+	if have, want := unread(admin), idsOf("A1"); have != want {
+		t.Errorf("expected %s unread, got %s", want, have)
+	}
+	call(admin, "mark=group&as=read&id=-1", nil)
+	if have := unread(admin); have != "" {
+		t.Errorf("expected all read, got %s", have)
+	}
+	if have, want := unread(feverKey("alice", "fever")), idsOf("B2", "B1"); have != want {
+		t.Errorf("expected the other user's items unread, got %s", have)
+	}
+	call(admin, "mark=item&as=saved&id="+strconv.FormatInt(items["B1"].Id, 10), nil)
+	call(admin, "unread_recently_read=1", nil)
+	if have, want := unread(admin), idsOf("C1", "B2", "A1", "Old"); have != want {
+		t.Errorf("expected the recently read items unread, got %s, want %s", have, want)
+	}
 }
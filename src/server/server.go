@@ -1,13 +1,18 @@
 package server
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/thang-qt/Readn/src/server/auth"
+	"github.com/thang-qt/Readn/src/server/router"
 	"github.com/thang-qt/Readn/src/storage"
 	"github.com/thang-qt/Readn/src/worker"
 )
@@ -21,12 +26,27 @@ type Server struct {
 
 	BasePath string
 
-	// auth
+	// credentials of the admin account, see SetCredentials
 	Username string
 	Password string
+	authMu   sync.RWMutex
+	// header with the username set by a reverse proxy from the trusted
+	// addresses; requests over a unix socket are always trusted
+	AuthHeader     string
+	TrustedProxies []netip.Prefix
+	limiter        *auth.Limiter
 	// https
 	CertFile string
 	KeyFile  string
+	// scheduled backups
+	BackupDir      string
+	BackupInterval time.Duration
+	BackupKeep     int
+	// bearer token for /metrics, which otherwise requires the regular auth
+	MetricsToken string
+
+	httpserver *http.Server
+	stopped    chan struct{}
 }
 
 func NewServer(db *storage.Storage, addr string) *Server {
@@ -36,9 +56,53 @@ func NewServer(db *storage.Storage, addr string) *Server {
 		worker:      worker.NewWorker(db),
 		cache:       make(map[string]interface{}),
 		cache_mutex: &sync.Mutex{},
+		limiter:     auth.NewLimiter(),
+		httpserver:  &http.Server{},
+		stopped:     make(chan struct{}),
+	}
+}
+
+// Sets up the admin account and turns on the authentication.
+// Empty credentials turn it off, leaving the accounts as they are.
+// Safe to call while running.
+func (s *Server) SetCredentials(username, password string) {
+	s.authMu.Lock()
+	defer s.authMu.Unlock()
+	s.Username = username
+	s.Password = password
+	if username != "" && password != "" {
+		s.setupAdmin(username, password)
+	}
+}
+
+func (s *Server) credentials() (string, string) {
+	s.authMu.RLock()
+	defer s.authMu.RUnlock()
+	return s.Username, s.Password
+}
+
+func (s *Server) authEnabled() bool {
+	username, password := s.credentials()
+	return (username != "" && password != "") || s.AuthHeader != ""
+}
+
+func (s *Server) trustedProxies() auth.TrustedProxies {
+	return auth.TrustedProxies{
+		Prefixes:   s.TrustedProxies,
+		UnixSocket: strings.HasPrefix(s.Addr, "unix:"),
 	}
 }
 
+// Returns the storage bound to the user making the request.
+func (s *Server) userDB(c *router.Context) *storage.Storage {
+	return s.db.ForUser(c.UserID)
+}
+
+// Applies the settings changed outside of the UI (e.g. by the config file).
+func (s *Server) ReloadSettings() {
+	s.worker.SetRefreshRate(s.db.GetSettingsValueInt64("refresh_rate"))
+}
+
 func (h *Server) GetAddr() string {
 	proto := "http"
 	if h.CertFile != "" && h.KeyFile != "" {
@@ -51,6 +115,9 @@ func (s *Server) Start() {
 	refreshRate := s.db.GetSettingsValueInt64("refresh_rate")
 	s.worker.FindFavicons()
 	s.worker.StartFeedCleaner()
+	if s.BackupDir != "" && s.BackupInterval > 0 {
+		s.worker.StartBackups(s.BackupDir, s.BackupInterval, s.BackupKeep)
+	}
 	s.worker.SetRefreshRate(refreshRate)
 	if refreshRate > 0 {
 		s.worker.RefreshFeeds()
@@ -62,7 +129,7 @@ func (s *Server) Start() {
 	if path, isUnix := strings.CutPrefix(s.Addr, "unix:"); isUnix {
 		err = os.Remove(path)
 		if err != nil {
-			log.Print(err)
+			slog.Debug("failed to remove socket", "path", path, "err", err)
 		}
 		ln, err = net.Listen("unix", path)
 	} else {
@@ -70,18 +137,38 @@ func (s *Server) Start() {
 	}
 
 	if err != nil {
-		log.Fatal(err)
+		slog.Error("failed to listen", "addr", s.Addr, "err", err)
+		os.Exit(1)
 	}
 
-	httpserver := &http.Server{Handler: s.handler()}
+	s.httpserver.Handler = s.handler()
 	if s.CertFile != "" && s.KeyFile != "" {
-		err = httpserver.ServeTLS(ln, s.CertFile, s.KeyFile)
+		err = s.httpserver.ServeTLS(ln, s.CertFile, s.KeyFile)
 		ln.Close()
 	} else {
-		err = httpserver.Serve(ln)
+		err = s.httpserver.Serve(ln)
 	}
 
 	if err != http.ErrServerClosed {
-		log.Fatal(err)
+		slog.Error("server error", "err", err)
+		os.Exit(1)
+	}
+	// wait for Shutdown to complete
+	<-s.stopped
+}
+
+// Stops accepting requests, waits for the active ones and the feed refresh
+// in progress to finish, then closes the database. Requests & feed fetches
+// still running once the context is done get cancelled.
+func (s *Server) Shutdown(ctx context.Context) {
+	defer close(s.stopped)
+
+	if err := s.httpserver.Shutdown(ctx); err != nil {
+		slog.Error("failed to stop server gracefully", "err", err)
+		s.httpserver.Close()
+	}
+	s.worker.Stop(ctx)
+	if err := s.db.Close(); err != nil {
+		slog.Error("failed to close database", "err", err)
 	}
 }
@@ -0,0 +1,372 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/thang-qt/Readn/src/server/auth"
+	"github.com/thang-qt/Readn/src/server/router"
+	"github.com/thang-qt/Readn/src/storage"
+)
+
+// Creates or updates the admin account with the given credentials.
+// The first account set up takes over the data of the single-user install,
+// a new username in the credentials renames it. If the username is taken
+// by another user instead, the account set up before is disabled, so that
+// its login doesn't outlive the credentials.
+func (s *Server) setupAdmin(username, password string) {
+	previous := s.db.GetConfiguredUser()
+	user := s.db.GetUserByName(username)
+	if user == nil {
+		owner := previous
+		if owner == nil {
+			if owner = s.db.GetUser(storage.DefaultUserId); owner != nil && owner.Password != "" {
+				owner = nil
+			}
+		}
+		if owner != nil {
+			if !s.db.RenameUser(owner.Id, username) {
+				return
+			}
+			user = owner
+		} else if user = s.db.CreateUser(username, "", true); user == nil {
+			slog.Error("failed to create admin account", "username", username)
+			return
+		}
+	}
+	if previous != nil && previous.Id != user.Id {
+		slog.Warn("disabling the admin account of the former credentials", "username", previous.Username)
+		s.db.UpdateUserAdmin(previous.Id, false)
+		s.db.UpdateUserDisabled(previous.Id, true)
+		s.db.DeleteSessions(previous.Id, 0)
+	}
+	s.db.UpdateUserConfigured(user.Id)
+	// a new password logs the admin out everywhere & resets the Fever
+	// password, which is kept as set by the admin otherwise
+	if !auth.CheckPassword(user.Password, password) {
+		s.db.UpdateUserPassword(user.Id, auth.HashPassword(password))
+		s.db.UpdateUserFeverKey(user.Id, feverKey(username, password))
+		s.db.DeleteSessions(user.Id, 0)
+	} else if user.Username != username && user.FeverKey != "" {
+		// the Fever key is derived from the username too
+		s.db.UpdateUserFeverKey(user.Id, feverKey(username, password))
+	}
+	s.db.UpdateUserAdmin(user.Id, true)
+	s.db.UpdateUserDisabled(user.Id, false)
+}
+
+func (s *Server) requireAdmin(c *router.Context) {
+	if !s.isAdmin(c) {
+		c.Out.WriteHeader(http.StatusForbidden)
+		return
+	}
+	c.Next()
+}
+
+// Lets through the login sessions and the admin-scoped tokens.
+func (s *Server) requireAccountScope(c *router.Context) {
+	if !auth.ScopeAllows(c.Scope, auth.ScopeAdmin) {
+		c.Out.WriteHeader(http.StatusForbidden)
+		return
+	}
+	c.Next()
+}
+
+// Tells whether the request is made by an admin with the admin rights,
+// the tokens of a narrower scope don't carry them.
+func (s *Server) isAdmin(c *router.Context) bool {
+	if !auth.ScopeAllows(c.Scope, auth.ScopeAdmin) {
+		return false
+	}
+	user := s.db.GetUser(c.UserID)
+	return user != nil && user.IsAdmin
+}
+
+func (s *Server) handleAccount(c *router.Context) {
+	user := s.db.GetUser(c.UserID)
+	if user == nil {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// Sets the password the user's Fever clients log in with.
+// An empty password turns off the Fever API for the user.
+func (s *Server) handleAccountFeverUpdate(c *router.Context) {
+	var body FeverPasswordForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+		slog.Debug("invalid request body", "err", err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	user := s.db.GetUser(c.UserID)
+	if user == nil {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	key := ""
+	if body.Password != "" {
+		key = feverKey(user.Username, body.Password)
+	}
+	if !s.db.UpdateUserFeverKey(user.Id, key) {
+		c.Out.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	c.Out.WriteHeader(http.StatusOK)
+}
+
+// Starts setting up the second login factor. It's turned on once
+// the first code from the authenticator app is confirmed.
+func (s *Server) handleTOTPSetup(c *router.Context) {
+	user := s.db.GetUser(c.UserID)
+	if user == nil {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, map[string]string{"error": "Two-factor authentication is already on."})
+		return
+	}
+	secret := auth.NewTOTPSecret()
+	if !s.db.UpdateUserTOTPPending(user.Id, secret) {
+		c.Out.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusOK, map[string]string{
+		"secret": secret,
+		"uri":    auth.TOTPURI("Readn", user.Username, secret),
+	})
+}
+
+// Turns on the second login factor and returns the recovery codes,
+// the only time they are shown.
+func (s *Server) handleTOTPConfirm(c *router.Context) {
+	var body TOTPCodeForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+		slog.Debug("invalid request body", "err", err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	user := s.db.GetUser(c.UserID)
+	if user == nil || user.TOTPPending == "" {
+		c.JSON(http.StatusBadRequest, map[string]string{"error": "Two-factor authentication setup not started."})
+		return
+	}
+	step, ok := auth.ValidateTOTP(user.TOTPPending, strings.TrimSpace(body.Code), time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid code."})
+		return
+	}
+	codes := auth.NewRecoveryCodes()
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+	if !s.db.EnableUserTOTP(user.Id, hashes) {
+		c.Out.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	s.db.UseTOTPStep(user.Id, step)
+	slog.Info("two-factor authentication enabled", "user_id", user.Id, "username", user.Username)
+	c.JSON(http.StatusOK, map[string][]string{"recovery_codes": codes})
+}
+
+// Turning off the second factor takes a current code (or a recovery code).
+func (s *Server) handleTOTPDisable(c *router.Context) {
+	var body TOTPCodeForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+		slog.Debug("invalid request body", "err", err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	user := s.db.GetUser(c.UserID)
+	if user == nil || !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, map[string]string{"error": "Two-factor authentication is not on."})
+		return
+	}
+	code := strings.TrimSpace(body.Code)
+	_, valid := auth.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !valid && !s.db.UseRecoveryCode(user.Id, auth.HashRecoveryCode(code)) {
+		c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid code."})
+		return
+	}
+	if !s.db.DisableUserTOTP(user.Id) {
+		c.Out.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	slog.Info("two-factor authentication disabled", "user_id", user.Id, "username", user.Username)
+	c.Out.WriteHeader(http.StatusOK)
+}
+
+type sessionInfo struct {
+	storage.Session
+	Current bool `json:"current"`
+}
+
+func (s *Server) handleSessionList(c *router.Context) {
+	current := auth.CurrentSession(c.Req, s.db)
+	list := make([]sessionInfo, 0)
+	for _, session := range s.db.ListSessions(c.UserID) {
+		list = append(list, sessionInfo{
+			Session: session,
+			Current: current != nil && current.Id == session.Id,
+		})
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// Signs out all the sessions of the user but the current one.
+func (s *Server) handleSessionListDelete(c *router.Context) {
+	var keep int64
+	if current := auth.CurrentSession(c.Req, s.db); current != nil {
+		keep = current.Id
+	}
+	num := s.db.DeleteSessions(c.UserID, keep)
+	c.JSON(http.StatusOK, map[string]int64{"deleted": num})
+}
+
+func (s *Server) handleSessionDelete(c *router.Context) {
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !s.db.DeleteSession(c.UserID, id) {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	c.Out.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) handleAPITokenList(c *router.Context) {
+	c.JSON(http.StatusOK, s.db.ListAPITokens(c.UserID))
+}
+
+// The token itself is only returned here, it's stored hashed.
+func (s *Server) handleAPITokenCreate(c *router.Context) {
+	var body APITokenCreateForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+		slog.Debug("invalid request body", "err", err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if body.Scope == "" {
+		body.Scope = auth.ScopeWrite
+	}
+	if strings.TrimSpace(body.Name) == "" {
+		c.JSON(http.StatusBadRequest, map[string]string{"error": "Token name missing."})
+		return
+	}
+	if !auth.ValidScope(body.Scope) {
+		c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid token scope."})
+		return
+	}
+	// tokens cannot be used to obtain wider access
+	if !auth.ScopeAllows(c.Scope, body.Scope) || (body.Scope == auth.ScopeAdmin && !s.isAdmin(c)) {
+		c.JSON(http.StatusForbidden, map[string]string{"error": "Token scope not allowed."})
+		return
+	}
+	secret := auth.NewToken()
+	token := s.db.CreateAPIToken(c.UserID, body.Name, auth.HashToken(secret), body.Scope)
+	if token == nil {
+		c.Out.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	c.JSON(http.StatusCreated, struct {
+		storage.APIToken
+		Token string `json:"token"`
+	}{*token, secret})
+}
+
+func (s *Server) handleAPITokenDelete(c *router.Context) {
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !s.db.DeleteAPIToken(c.UserID, id) {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	c.Out.WriteHeader(http.StatusOK)
+}
+
+// Clients currently locked out after failed login attempts.
+func (s *Server) handleLockoutList(c *router.Context) {
+	c.JSON(http.StatusOK, s.limiter.Lockouts())
+}
+
+func (s *Server) handleUserList(c *router.Context) {
+	c.JSON(http.StatusOK, s.db.ListUsers())
+}
+
+func (s *Server) handleUserCreate(c *router.Context) {
+	var body UserCreateForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+		slog.Debug("invalid request body", "err", err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if !auth.ValidUsername(body.Username) {
+		c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid username."})
+		return
+	}
+	if body.Password == "" {
+		c.JSON(http.StatusBadRequest, map[string]string{"error": "Password missing."})
+		return
+	}
+	user := s.db.CreateUser(body.Username, auth.HashPassword(body.Password), body.IsAdmin)
+	if user == nil {
+		c.JSON(http.StatusConflict, map[string]string{"error": "Username already taken."})
+		return
+	}
+	slog.Info("created user", "user_id", user.Id, "username", user.Username, "by", c.User)
+	c.JSON(http.StatusCreated, user)
+}
+
+func (s *Server) handleUserUpdate(c *router.Context) {
+	id, err := c.VarInt64("id")
+	if err != nil {
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var body UserUpdateForm
+	if err := json.NewDecoder(c.Req.Body).Decode(&body); err != nil {
+		slog.Debug("invalid request body", "err", err)
+		c.Out.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	user := s.db.GetUser(id)
+	if user == nil {
+		c.Out.WriteHeader(http.StatusNotFound)
+		return
+	}
+	// keep the admins from locking themselves out
+	if id == c.UserID && ((body.Disabled != nil && *body.Disabled) || (body.IsAdmin != nil && !*body.IsAdmin)) {
+		c.JSON(http.StatusBadRequest, map[string]string{"error": "Cannot disable or demote own account."})
+		return
+	}
+	if body.Password != nil {
+		if *body.Password == "" {
+			c.JSON(http.StatusBadRequest, map[string]string{"error": "Password missing."})
+			return
+		}
+		s.db.UpdateUserPassword(id, auth.HashPassword(*body.Password))
+		s.db.DeleteSessions(id, 0)
+	}
+	if body.IsAdmin != nil {
+		s.db.UpdateUserAdmin(id, *body.IsAdmin)
+	}
+	if body.Disabled != nil {
+		s.db.UpdateUserDisabled(id, *body.Disabled)
+		if *body.Disabled {
+			s.db.DeleteSessions(id, 0)
+			slog.Info("disabled user", "user_id", id, "username", user.Username, "by", c.User)
+		}
+	}
+	c.JSON(http.StatusOK, s.db.GetUser(id))
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	backupPrefix = "readn-"
+	backupSuffix = ".db"
+)
+
+// Writes a consistent snapshot of the database to a new file.
+// Safe to call while the database is in use.
+func (s *Storage) Backup(path string) error {
+	_, err := s.db.Exec(`vacuum into ?`, path)
+	return err
+}
+
+// Writes a timestamped snapshot into the directory and removes
+// the oldest snapshots so that at most `keep` of them remain (0: keep all).
+func (s *Storage) BackupToDir(dir string, keep int) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	name := backupPrefix + time.Now().UTC().Format("20060102-150405") + backupSuffix
+	path := filepath.Join(dir, name)
+	if err := s.Backup(path); err != nil {
+		return "", err
+	}
+	if keep <= 0 {
+		return path, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return path, err
+	}
+	backups := make([]string, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, backupPrefix) && strings.HasSuffix(name, backupSuffix) {
+			backups = append(backups, name)
+		}
+	}
+	// timestamps in the names sort chronologically
+	sort.Strings(backups)
+	for len(backups) > keep {
+		if err := os.Remove(filepath.Join(dir, backups[0])); err != nil {
+			return path, err
+		}
+		backups = backups[1:]
+	}
+	return path, nil
+}
+
+// Replaces the database file at `path` with the backup.
+// The server must not be running.
+//
+// The backup is copied next to the database, checked for integrity and
+// migrated to the current schema version before the files get swapped.
+// The replaced database is kept with the `.bak` suffix.
+func Restore(backupPath, path string) error {
+	tmpPath := path + ".restore"
+	if err := copyFile(backupPath, tmpPath); err != nil {
+		return err
+	}
+	if err := prepareRestore(tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		err := os.Rename(path+suffix, path+".bak"+suffix)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func prepareRestore(path string) error {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result string
+	if err = db.QueryRow(`pragma integrity_check`).Scan(&result); err != nil {
+		return fmt.Errorf("not a database: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+
+	var version int64
+	if err = db.QueryRow(`pragma user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version == 0 {
+		return fmt.Errorf("not a readn database")
+	}
+	if version > maxVersion {
+		return fmt.Errorf("database version %d is newer than supported %d", version, maxVersion)
+	}
+	if err = migrate(db); err != nil {
+		return err
+	}
+	// leave no write-ahead log behind
+	_, err = db.Exec(`pragma journal_mode = delete`)
+	return err
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err = out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
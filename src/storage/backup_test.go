@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "storage.db")
+
+	db, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.CreateFeed("feed", "", "", "http://test.com/feed.xml", nil)
+
+	backupPath := filepath.Join(dir, "backup.db")
+	if err := db.Backup(backupPath); err != nil {
+		t.Fatal(err)
+	}
+	db.CreateFeed("another", "", "", "http://test.com/another.xml", nil)
+	db.db.Close()
+
+	if err := Restore(backupPath, path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".bak"); err != nil {
+		t.Error("expected the replaced database to be kept")
+	}
+
+	db, err = New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.db.Close()
+	if feeds := db.ListFeeds(); len(feeds) != 1 || feeds[0].Title != "feed" {
+		t.Fatalf("invalid restored feeds: %#v", feeds)
+	}
+}
+
+func TestRestoreInvalid(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "storage.db")
+	os.WriteFile(path, []byte("current"), 0644)
+
+	garbage := filepath.Join(dir, "garbage.db")
+	os.WriteFile(garbage, []byte(strings.Repeat("garbage", 100)), 0644)
+	if err := Restore(garbage, path); err == nil {
+		t.Fatal("expected garbage to be rejected")
+	}
+
+	empty := filepath.Join(dir, "empty.db")
+	os.WriteFile(empty, nil, 0644)
+	if err := Restore(empty, path); err == nil {
+		t.Fatal("expected empty database to be rejected")
+	}
+
+	if data, _ := os.ReadFile(path); string(data) != "current" {
+		t.Fatal("database must stay intact")
+	}
+	if _, err := os.Stat(path + ".restore"); err == nil {
+		t.Fatal("temporary file must be removed")
+	}
+}
+
+func TestBackupToDir(t *testing.T) {
+	dir := t.TempDir()
+	db := testDB()
+
+	for _, name := range []string{"readn-20200101-000000.db", "readn-20200102-000000.db", "other.db"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	path, err := db.BackupToDir(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	have := make([]string, 0)
+	for _, entry := range entries {
+		have = append(have, entry.Name())
+	}
+	want := []string{"other.db", "readn-20200102-000000.db", filepath.Base(path)}
+	if strings.Join(have, ",") != strings.Join(want, ",") {
+		t.Fatalf("invalid backups kept\nwant: %v\nhave: %v", want, have)
+	}
+}
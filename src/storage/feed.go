@@ -2,7 +2,9 @@ package storage
 
 import (
 	"database/sql"
-	"log"
+	"fmt"
+	"log/slog"
+	"strings"
 )
 
 type Feed struct {
@@ -14,25 +16,51 @@ type Feed struct {
 	FeedLink    string  `json:"feed_link"`
 	Icon        *[]byte `json:"icon,omitempty"`
 	HasIcon     bool    `json:"has_icon"`
+	// sparks are busy feeds the user skims, kept out of the unread counts by the Fever clients
+	IsSpark bool `json:"is_spark"`
 }
 
+// Subscribes the user to the feed. The feed is stored once
+// no matter how many users follow the same link.
+// The feed goes to the top level if the folder isn't the user's.
 func (s *Storage) CreateFeed(title, description, link, feedLink string, folderId *int64) *Feed {
 	if title == "" {
 		title = feedLink
 	}
-	row := s.db.QueryRow(`
-		insert into feeds (title, description, link, feed_link, folder_id) 
-		values (?, ?, ?, ?, ?)
-		on conflict (feed_link) do update set folder_id = ?
-        returning id`,
-		title, description, link, feedLink, folderId,
-		folderId,
-	)
+	if folderId != nil && s.GetFolder(*folderId) == nil {
+		folderId = nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return nil
+	}
+	defer tx.Rollback()
 
 	var id int64
-	err := row.Scan(&id)
+	err = tx.QueryRow(`
+		insert into feeds (title, description, link, feed_link)
+		values (?, ?, ?, ?)
+		on conflict (feed_link) do update set feed_link = excluded.feed_link
+		returning id`,
+		title, description, link, feedLink,
+	).Scan(&id)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return nil
+	}
+	_, err = tx.Exec(`
+		insert into subscriptions (user_id, feed_id, folder_id, title)
+		values (?, ?, ?, ?)
+		on conflict (user_id, feed_id) do update set folder_id = excluded.folder_id`,
+		s.userId, id, folderId, title,
+	)
 	if err != nil {
-		log.Print(err)
+		slog.Error("database error", "err", err)
+		return nil
+	}
+	if err = tx.Commit(); err != nil {
+		slog.Error("database error", "err", err)
 		return nil
 	}
 	return &Feed{
@@ -45,35 +73,122 @@ func (s *Storage) CreateFeed(title, description, link, feedLink string, folderId
 	}
 }
 
+// Articles saved from arbitrary urls (read it later) are kept
+// in a pseudo-feed per user, which is never refreshed or cleaned up.
+// Its link is the prefix followed by the user id.
+const SavedFeedLink = "readn:saved"
+
+func (f Feed) IsSaved() bool {
+	return strings.HasPrefix(f.FeedLink, SavedFeedLink+":")
+}
+
+// Returns the user's saved articles pseudo-feed, creating it on the first use.
+func (s *Storage) GetSavedFeed() *Feed {
+	feedLink := fmt.Sprintf("%s:%d", SavedFeedLink, s.userId)
+	// empty icon, so that the favicon finder leaves the feed alone
+	_, err := s.db.Exec(`
+		insert into feeds (title, description, link, feed_link, icon)
+		values ('Saved', '', '', ?, x'')
+		on conflict (feed_link) do nothing`,
+		feedLink,
+	)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return nil
+	}
+	_, err = s.db.Exec(`
+		insert into subscriptions (user_id, feed_id, title)
+		select ?, id, title from feeds where feed_link = ?
+		on conflict (user_id, feed_id) do nothing`,
+		s.userId, feedLink,
+	)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return nil
+	}
+	var id int64
+	if err = s.db.QueryRow(`select id from feeds where feed_link = ?`, feedLink).Scan(&id); err != nil {
+		slog.Error("database error", "err", err)
+		return nil
+	}
+	return s.GetFeed(id)
+}
+
+// Unsubscribes the user from the feed.
+// The feed is deleted along with its items once nobody follows it.
 func (s *Storage) DeleteFeed(feedId int64) bool {
-	result, err := s.db.Exec(`delete from feeds where id = ?`, feedId)
+	tx, err := s.db.Begin()
 	if err != nil {
-		log.Print(err)
+		slog.Error("database error", "err", err)
 		return false
 	}
-	nrows, err := result.RowsAffected()
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`delete from subscriptions where user_id = ? and feed_id = ?`, s.userId, feedId)
 	if err != nil {
-		if err != sql.ErrNoRows {
-			log.Print(err)
-		}
+		slog.Error("database error", "err", err)
+		return false
+	}
+	if nrows, err := result.RowsAffected(); err != nil || nrows != 1 {
 		return false
 	}
-	return nrows == 1
+	_, err = tx.Exec(`
+		delete from feeds
+		where id = ? and not exists (select 1 from subscriptions where feed_id = ?)`,
+		feedId, feedId,
+	)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return false
+	}
+	if err = tx.Commit(); err != nil {
+		slog.Error("database error", "err", err)
+		return false
+	}
+	return true
 }
 
 func (s *Storage) RenameFeed(feedId int64, newTitle string) bool {
-	_, err := s.db.Exec(`update feeds set title = ? where id = ?`, newTitle, feedId)
+	_, err := s.db.Exec(
+		`update subscriptions set title = ? where user_id = ? and feed_id = ?`,
+		newTitle, s.userId, feedId,
+	)
+	return err == nil
+}
+
+func (s *Storage) UpdateFeedSpark(feedId int64, isSpark bool) bool {
+	_, err := s.db.Exec(
+		`update subscriptions set is_spark = ? where user_id = ? and feed_id = ?`,
+		isSpark, s.userId, feedId,
+	)
 	return err == nil
 }
 
 func (s *Storage) UpdateFeedFolder(feedId int64, newFolderId *int64) bool {
-	_, err := s.db.Exec(`update feeds set folder_id = ? where id = ?`, newFolderId, feedId)
+	_, err := s.db.Exec(`
+		update subscriptions set folder_id = (select id from folders where id = ? and user_id = ?)
+		where user_id = ? and feed_id = ?`,
+		newFolderId, s.userId, s.userId, feedId,
+	)
 	return err == nil
 }
 
+// The link is shared by all the subscribers, so only the sole subscriber
+// of the feed may change it.
 func (s *Storage) UpdateFeedLink(feedId int64, newLink string) bool {
-	_, err := s.db.Exec(`update feeds set feed_link = ? where id = ?`, newLink, feedId)
-	return err == nil
+	result, err := s.db.Exec(`
+		update feeds set feed_link = ?
+		where id = ?
+		  and exists (select 1 from subscriptions where feed_id = feeds.id and user_id = ?)
+		  and not exists (select 1 from subscriptions where feed_id = feeds.id and user_id != ?)`,
+		newLink, feedId, s.userId, s.userId,
+	)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return false
+	}
+	nrows, err := result.RowsAffected()
+	return err == nil && nrows == 1
 }
 
 func (s *Storage) UpdateFeedIcon(feedId int64, icon *[]byte) bool {
@@ -81,23 +196,58 @@ func (s *Storage) UpdateFeedIcon(feedId int64, icon *[]byte) bool {
 	return err == nil
 }
 
+// Lists the feeds the user is subscribed to.
 func (s *Storage) ListFeeds() []Feed {
 	result := make([]Feed, 0)
 	rows, err := s.db.Query(`
-		select id, folder_id, title, description, link, feed_link,
+		select f.id, sub.folder_id, sub.title, f.description, f.link, f.feed_link,
+		       ifnull(length(f.icon), 0) > 0 as has_icon, sub.is_spark
+		from feeds f
+		join subscriptions sub on sub.feed_id = f.id and sub.user_id = ?
+		order by sub.title collate nocase
+	`, s.userId)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return result
+	}
+	for rows.Next() {
+		var f Feed
+		err = rows.Scan(
+			&f.Id,
+			&f.FolderId,
+			&f.Title,
+			&f.Description,
+			&f.Link,
+			&f.FeedLink,
+			&f.HasIcon,
+			&f.IsSpark,
+		)
+		if err != nil {
+			slog.Error("database error", "err", err)
+			return result
+		}
+		result = append(result, f)
+	}
+	return result
+}
+
+// Lists the feeds of all the users, without the folders.
+func (s *Storage) ListAllFeeds() []Feed {
+	result := make([]Feed, 0)
+	rows, err := s.db.Query(`
+		select id, title, description, link, feed_link,
 		       ifnull(length(icon), 0) > 0 as has_icon
 		from feeds
 		order by title collate nocase
 	`)
 	if err != nil {
-		log.Print(err)
+		slog.Error("database error", "err", err)
 		return result
 	}
 	for rows.Next() {
 		var f Feed
 		err = rows.Scan(
 			&f.Id,
-			&f.FolderId,
 			&f.Title,
 			&f.Description,
 			&f.Link,
@@ -105,7 +255,7 @@ func (s *Storage) ListFeeds() []Feed {
 			&f.HasIcon,
 		)
 		if err != nil {
-			log.Print(err)
+			slog.Error("database error", "err", err)
 			return result
 		}
 		result = append(result, f)
@@ -116,26 +266,25 @@ func (s *Storage) ListFeeds() []Feed {
 func (s *Storage) ListFeedsMissingIcons() []Feed {
 	result := make([]Feed, 0)
 	rows, err := s.db.Query(`
-		select id, folder_id, title, description, link, feed_link
+		select id, title, description, link, feed_link
 		from feeds
 		where icon is null
 	`)
 	if err != nil {
-		log.Print(err)
+		slog.Error("database error", "err", err)
 		return result
 	}
 	for rows.Next() {
 		var f Feed
 		err = rows.Scan(
 			&f.Id,
-			&f.FolderId,
 			&f.Title,
 			&f.Description,
 			&f.Link,
 			&f.FeedLink,
 		)
 		if err != nil {
-			log.Print(err)
+			slog.Error("database error", "err", err)
 			return result
 		}
 		result = append(result, f)
@@ -143,29 +292,54 @@ func (s *Storage) ListFeedsMissingIcons() []Feed {
 	return result
 }
 
+// Returns the feed if the user is subscribed to it.
 func (s *Storage) GetFeed(id int64) *Feed {
 	var f Feed
 	err := s.db.QueryRow(`
 		select
-			id, folder_id, title, link, feed_link,
-			icon, ifnull(icon, '') != '' as has_icon
-		from feeds where id = ?
-	`, id).Scan(
+			f.id, sub.folder_id, sub.title, f.link, f.feed_link,
+			f.icon, ifnull(f.icon, '') != '' as has_icon, sub.is_spark
+		from feeds f
+		join subscriptions sub on sub.feed_id = f.id and sub.user_id = ?
+		where f.id = ?
+	`, s.userId, id).Scan(
 		&f.Id, &f.FolderId, &f.Title, &f.Link, &f.FeedLink,
-		&f.Icon, &f.HasIcon,
+		&f.Icon, &f.HasIcon, &f.IsSpark,
 	)
 	if err != nil {
 		if err != sql.ErrNoRows {
-			log.Print(err)
+			slog.Error("database error", "err", err)
 		}
 		return nil
 	}
 	return &f
 }
 
+// Reports whether the user is subscribed to the feed.
+func (s *Storage) HasFeed(id int64) bool {
+	var found bool
+	err := s.db.QueryRow(`
+		select exists (select 1 from subscriptions where feed_id = ? and user_id = ?)
+	`, id, s.userId).Scan(&found)
+	if err != nil {
+		slog.Error("database error", "err", err)
+	}
+	return found
+}
+
+// Reports whether the feed exists, whoever is subscribed to it.
+func (s *Storage) FeedExists(id int64) bool {
+	var found bool
+	err := s.db.QueryRow(`select exists (select 1 from feeds where id = ?)`, id).Scan(&found)
+	if err != nil {
+		slog.Error("database error", "err", err)
+	}
+	return found
+}
+
 func (s *Storage) ResetFeedErrors() {
 	if _, err := s.db.Exec(`delete from feed_errors`); err != nil {
-		log.Print(err)
+		slog.Error("database error", "err", err)
 	}
 }
 
@@ -177,16 +351,31 @@ func (s *Storage) SetFeedError(feedID int64, lastError error) {
 		feedID, lastError.Error(),
 	)
 	if err != nil {
-		log.Print(err)
+		slog.Error("database error", "err", err)
 	}
 }
 
+// Returns the errors of the feeds the user is subscribed to.
 func (s *Storage) GetFeedErrors() map[int64]string {
+	return s.queryFeedErrors(`
+		select e.feed_id, e.error
+		from feed_errors e
+		join subscriptions sub on sub.feed_id = e.feed_id and sub.user_id = ?`,
+		s.userId,
+	)
+}
+
+// Returns the errors of the feeds of all the users.
+func (s *Storage) GetAllFeedErrors() map[int64]string {
+	return s.queryFeedErrors(`select feed_id, error from feed_errors`)
+}
+
+func (s *Storage) queryFeedErrors(query string, args ...interface{}) map[int64]string {
 	errors := make(map[int64]string)
 
-	rows, err := s.db.Query(`select feed_id, error from feed_errors`)
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		log.Print(err)
+		slog.Error("database error", "err", err)
 		return errors
 	}
 
@@ -194,7 +383,7 @@ func (s *Storage) GetFeedErrors() map[int64]string {
 		var id int64
 		var error string
 		if err = rows.Scan(&id, &error); err != nil {
-			log.Print(err)
+			slog.Error("database error", "err", err)
 		}
 		errors[id] = error
 	}
@@ -209,6 +398,6 @@ func (s *Storage) SetFeedSize(feedId int64, size int) {
 		feedId, size,
 	)
 	if err != nil {
-		log.Print(err)
+		slog.Error("database error", "err", err)
 	}
 }
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"errors"
 	"reflect"
 	"testing"
 )
@@ -51,7 +52,7 @@ func TestReadFeed(t *testing.T) {
 func TestUpdateFeed(t *testing.T) {
 	db := testDB()
 	feed1 := db.CreateFeed("feed 1", "", "http://example1.com", "http://example1.com/feed.xml", nil)
-	folder := db.CreateFolder("test")
+	folder := db.CreateFolder("test", nil)
 	icon := []byte("icon")
 
 	db.RenameFeed(feed1.Id, "newtitle")
@@ -85,3 +86,20 @@ func TestDeleteFeed(t *testing.T) {
 		t.Fatal("feed still exists")
 	}
 }
+
+func TestFeedErrorsOfOtherUsers(t *testing.T) {
+	db := testDB()
+	feed := db.CreateFeed("title", "", "", "http://example.com/feed.xml", nil)
+	db.SetFeedError(feed.Id, errors.New("gone"))
+	other := db.ForUser(db.CreateUser("alice", "", false).Id)
+
+	if have := other.GetFeedErrors(); len(have) != 0 {
+		t.Errorf("expected no errors of the feeds of another user, got %#v", have)
+	}
+	if have := db.GetFeedErrors(); have[feed.Id] != "gone" {
+		t.Errorf("expected the feed error, got %#v", have)
+	}
+	if have := other.GetAllFeedErrors(); len(have) != 1 {
+		t.Errorf("expected all the feed errors, got %#v", have)
+	}
+}
@@ -1,22 +1,60 @@
 package storage
 
 import (
-	"log"
+	"database/sql"
+	"fmt"
+	"log/slog"
 )
 
 type Folder struct {
 	Id         int64  `json:"id"`
+	ParentId   *int64 `json:"parent_id"`
 	Title      string `json:"title"`
 	IsExpanded bool   `json:"is_expanded"`
 }
 
-func (s *Storage) CreateFolder(title string) *Folder {
+// Selects the id of the folder passed as the query argument
+// together with the ids of all its descendants owned by the user
+// (the second argument).
+const folderSubtreeQuery = `
+	with recursive subtree(id) as (
+		select ?
+		union
+		select f.id from folders f join subtree t on f.parent_id = t.id and f.user_id = ?
+	)
+	select id from subtree`
+
+// Returns the paths of the folders: their titles joined with `/`
+// with the titles of the folders above, e.g. `Tech/Blogs`.
+func FolderPaths(folders []Folder) map[int64]string {
+	byId := make(map[int64]Folder)
+	for _, folder := range folders {
+		byId[folder.Id] = folder
+	}
+	paths := make(map[int64]string)
+	for _, folder := range folders {
+		path := folder.Title
+		// guard against cycles in a damaged database
+		for parent, depth := folder.ParentId, 0; parent != nil && depth < len(folders); depth++ {
+			path = byId[*parent].Title + "/" + path
+			parent = byId[*parent].ParentId
+		}
+		paths[folder.Id] = path
+	}
+	return paths
+}
+
+// Returns nil if the parent folder isn't the user's.
+func (s *Storage) CreateFolder(title string, parentId *int64) *Folder {
+	if parentId != nil && s.GetFolder(*parentId) == nil {
+		return nil
+	}
 	expanded := true
 	row := s.db.QueryRow(`
-		insert into folders (title, is_expanded) values (?, ?)
-		on conflict (title) do update set title = ?
+		insert into folders (user_id, title, parent_id, is_expanded) values (?, ?, ?, ?)
+		on conflict (user_id, coalesce(parent_id, 0), title) do update set title = ?
         returning id`,
-		title, expanded,
+		s.userId, title, parentId, expanded,
 		// provide title again so that we can extract row id
 		title,
 	)
@@ -24,39 +62,87 @@ func (s *Storage) CreateFolder(title string) *Folder {
 	err := row.Scan(&id)
 
 	if err != nil {
-		log.Print(err)
+		slog.Error("database error", "err", err)
 		return nil
 	}
-	return &Folder{Id: id, Title: title, IsExpanded: expanded}
+	return &Folder{Id: id, ParentId: parentId, Title: title, IsExpanded: expanded}
 }
 
+// Deletes the folder. Its subfolders and feeds are moved one level up.
 func (s *Storage) DeleteFolder(folderId int64) bool {
-	_, err := s.db.Exec(`delete from folders where id = ?`, folderId)
+	tx, err := s.db.Begin()
 	if err != nil {
-		log.Print(err)
+		slog.Error("database error", "err", err)
+		return false
 	}
-	return err == nil
+	queries := []string{
+		`update folders set parent_id = (select parent_id from folders where id = ?) where parent_id = ? and user_id = ?`,
+		`update subscriptions set folder_id = (select parent_id from folders where id = ?) where folder_id = ? and user_id = ?`,
+	}
+	for _, query := range queries {
+		if _, err = tx.Exec(query, folderId, folderId, s.userId); err != nil {
+			slog.Error("database error", "err", err)
+			tx.Rollback()
+			return false
+		}
+	}
+	if _, err = tx.Exec(`delete from folders where id = ? and user_id = ?`, folderId, s.userId); err != nil {
+		slog.Error("database error", "err", err)
+		tx.Rollback()
+		return false
+	}
+	if err = tx.Commit(); err != nil {
+		slog.Error("database error", "err", err)
+		return false
+	}
+	return true
 }
 
 func (s *Storage) RenameFolder(folderId int64, newTitle string) bool {
-	_, err := s.db.Exec(`update folders set title = ? where id = ?`, newTitle, folderId)
+	_, err := s.db.Exec(`update folders set title = ? where id = ? and user_id = ?`, newTitle, folderId, s.userId)
 	return err == nil
 }
 
 func (s *Storage) ToggleFolderExpanded(folderId int64, isExpanded bool) bool {
-	_, err := s.db.Exec(`update folders set is_expanded = ? where id = ?`, isExpanded, folderId)
+	_, err := s.db.Exec(`update folders set is_expanded = ? where id = ? and user_id = ?`, isExpanded, folderId, s.userId)
+	return err == nil
+}
+
+// Moves the folder under a new parent (nil for the top level).
+// Refuses to put the folder inside itself or any of its subfolders.
+func (s *Storage) UpdateFolderParent(folderId int64, newParentId *int64) bool {
+	if newParentId != nil {
+		if parent := s.GetFolder(*newParentId); parent == nil {
+			return false
+		}
+		var cycle bool
+		query := fmt.Sprintf(`select ? in (%s)`, folderSubtreeQuery)
+		if err := s.db.QueryRow(query, *newParentId, folderId, s.userId).Scan(&cycle); err != nil {
+			slog.Error("database error", "err", err)
+			return false
+		}
+		if cycle {
+			return false
+		}
+	}
+	_, err := s.db.Exec(`update folders set parent_id = ? where id = ? and user_id = ?`, newParentId, folderId, s.userId)
+	if err != nil {
+		slog.Error("database error", "err", err)
+	}
 	return err == nil
 }
 
 func (s *Storage) GetFolder(id int64) *Folder {
 	f := &Folder{}
 	err := s.db.QueryRow(`
-		select id, title, is_expanded
+		select id, parent_id, title, is_expanded
 		from folders
-		where id = ?
-	`, id).Scan(&f.Id, &f.Title, &f.IsExpanded)
+		where id = ? and user_id = ?
+	`, id, s.userId).Scan(&f.Id, &f.ParentId, &f.Title, &f.IsExpanded)
 	if err != nil {
-		log.Print(err)
+		if err != sql.ErrNoRows {
+			slog.Error("database error", "err", err)
+		}
 		return nil
 	}
 	return f
@@ -65,22 +151,60 @@ func (s *Storage) GetFolder(id int64) *Folder {
 func (s *Storage) ListFolders() []Folder {
 	result := make([]Folder, 0, 0)
 	rows, err := s.db.Query(`
-		select id, title, is_expanded
+		select id, parent_id, title, is_expanded
 		from folders
+		where user_id = ?
 		order by title collate nocase
-	`)
+	`, s.userId)
 	if err != nil {
-		log.Print(err)
+		slog.Error("database error", "err", err)
 		return result
 	}
 	for rows.Next() {
 		var f Folder
-		err = rows.Scan(&f.Id, &f.Title, &f.IsExpanded)
+		err = rows.Scan(&f.Id, &f.ParentId, &f.Title, &f.IsExpanded)
 		if err != nil {
-			log.Print(err)
+			slog.Error("database error", "err", err)
 			return result
 		}
 		result = append(result, f)
 	}
 	return result
 }
+
+type FolderStat struct {
+	FolderId     int64 `json:"folder_id"`
+	UnreadCount  int64 `json:"unread"`
+	StarredCount int64 `json:"starred"`
+}
+
+// Item counts per folder, including the items of all subfolders.
+func (s *Storage) FolderStats() []FolderStat {
+	result := make([]FolderStat, 0)
+	rows, err := s.db.Query(fmt.Sprintf(`
+		with recursive tree(root_id, folder_id) as (
+			select id, id from folders where user_id = ?
+			union
+			select t.root_id, f.id from folders f join tree t on f.parent_id = t.folder_id and f.user_id = ?
+		)
+		select
+			t.root_id,
+			sum(case %s when %d then 1 else 0 end),
+			sum(case %s when %d then 1 else 0 end)
+		from tree t
+		join subscriptions sub on sub.folder_id = t.folder_id and sub.user_id = ?
+		join items i on i.feed_id = sub.feed_id
+		left join item_states st on st.item_id = i.id and st.user_id = sub.user_id
+		group by t.root_id
+	`, itemStatusExpr, UNREAD, itemStatusExpr, STARRED), s.userId, s.userId, s.userId)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return result
+	}
+	for rows.Next() {
+		stat := FolderStat{}
+		rows.Scan(&stat.FolderId, &stat.UnreadCount, &stat.StarredCount)
+		result = append(result, stat)
+	}
+	return result
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCreateFolderNested(t *testing.T) {
+	db := testDB()
+	parent := db.CreateFolder("engineering", nil)
+	child1 := db.CreateFolder("blogs", &parent.Id)
+	child2 := db.CreateFolder("blogs", nil)
+	if child1 == nil || child2 == nil || child1.Id == child2.Id {
+		t.Fatal("expected same titles to be allowed under different parents")
+	}
+
+	same := db.CreateFolder("blogs", &parent.Id)
+	if same == nil || same.Id != child1.Id {
+		t.Fatalf("expected the same folder.\nwant: %#v\nhave: %#v", child1, same)
+	}
+
+	have := db.GetFolder(child1.Id)
+	if have == nil || !reflect.DeepEqual(have, child1) {
+		t.Fatalf("invalid folder: %#v", have)
+	}
+}
+
+func TestFoldersOfOtherUsers(t *testing.T) {
+	db := testDB()
+	folder := db.CreateFolder("engineering", nil)
+	other := db.ForUser(db.CreateUser("alice", "", false).Id)
+
+	if other.CreateFolder("blogs", &folder.Id) != nil {
+		t.Error("expected no folder under the folder of another user")
+	}
+	feed := other.CreateFeed("feed", "", "", "http://example.com/feed.xml", &folder.Id)
+	if feed == nil || feed.FolderId != nil || other.GetFeed(feed.Id).FolderId != nil {
+		t.Errorf("expected the feed at the top level, got %#v", feed)
+	}
+	if len(db.FolderStats()) != 0 {
+		t.Errorf("expected no stats of the feeds of another user, got %#v", db.FolderStats())
+	}
+}
+
+func TestUpdateFolderParentCycle(t *testing.T) {
+	db := testDB()
+	a := db.CreateFolder("a", nil)
+	b := db.CreateFolder("b", &a.Id)
+	c := db.CreateFolder("c", &b.Id)
+
+	if db.UpdateFolderParent(a.Id, &a.Id) {
+		t.Error("folder moved into itself")
+	}
+	if db.UpdateFolderParent(a.Id, &c.Id) {
+		t.Error("folder moved into its descendant")
+	}
+	if !db.UpdateFolderParent(c.Id, &a.Id) {
+		t.Error("failed to move folder up")
+	}
+	if !db.UpdateFolderParent(b.Id, nil) {
+		t.Error("failed to move folder to the top level")
+	}
+	if f := db.GetFolder(b.Id); f.ParentId != nil {
+		t.Errorf("expected top level folder, got parent %d", *f.ParentId)
+	}
+}
+
+func TestDeleteFolderNested(t *testing.T) {
+	db := testDB()
+	a := db.CreateFolder("a", nil)
+	b := db.CreateFolder("b", &a.Id)
+	c := db.CreateFolder("c", &b.Id)
+	feed := db.CreateFeed("feed", "", "", "http://test.com/feed.xml", &b.Id)
+
+	if !db.DeleteFolder(b.Id) {
+		t.Fatal("failed to delete folder")
+	}
+	if f := db.GetFolder(c.Id); f == nil || f.ParentId == nil || *f.ParentId != a.Id {
+		t.Errorf("expected subfolder to be moved up: %#v", f)
+	}
+	if f := db.GetFeed(feed.Id); f == nil || f.FolderId == nil || *f.FolderId != a.Id {
+		t.Errorf("expected feed to be moved up: %#v", f)
+	}
+}
+
+func TestListItemsNestedFolders(t *testing.T) {
+	db := testDB()
+	scope := testItemsSetup(db)
+
+	// folder2 becomes a subfolder of folder1
+	db.UpdateFolderParent(scope.folder2.Id, &scope.folder1.Id)
+
+	have := getItemGuids(db.ListItems(ItemFilter{FolderID: &scope.folder1.Id}, 10, false, false))
+	want := []string{"item111", "item112", "item113", "item121", "item122", "item211", "item212"}
+	if !reflect.DeepEqual(have, want) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fail()
+	}
+
+	stats := make(map[int64]FolderStat)
+	for _, stat := range db.FolderStats() {
+		stats[stat.FolderId] = stat
+	}
+	if stat := stats[scope.folder1.Id]; stat.UnreadCount != 2 || stat.StarredCount != 2 {
+		t.Errorf("invalid folder1 stats: %#v", stat)
+	}
+	if stat := stats[scope.folder2.Id]; stat.UnreadCount != 0 || stat.StarredCount != 1 {
+		t.Errorf("invalid folder2 stats: %#v", stat)
+	}
+}
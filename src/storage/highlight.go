@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"log/slog"
+	"time"
+)
+
+// A passage of the article text selected by the user.
+// The quote is anchored by the text right before & after it,
+// so that the same words appearing elsewhere can be told apart.
+type Highlight struct {
+	Id          int64     `json:"id"`
+	ItemId      int64     `json:"item_id"`
+	Text        string    `json:"text"`
+	Prefix      string    `json:"prefix"`
+	Suffix      string    `json:"suffix"`
+	Comment     string    `json:"comment"`
+	DateCreated time.Time `json:"date_created"`
+}
+
+func (s *Storage) CreateHighlight(h Highlight) *Highlight {
+	h.DateCreated = time.Now().UTC()
+	row := s.db.QueryRow(`
+		insert into highlights (user_id, item_id, text, prefix, suffix, comment, date_created)
+		values (?, ?, ?, ?, ?, ?, ?)
+		returning id`,
+		s.userId, h.ItemId, h.Text, h.Prefix, h.Suffix, h.Comment, h.DateCreated,
+	)
+	if err := row.Scan(&h.Id); err != nil {
+		slog.Error("database error", "err", err)
+		return nil
+	}
+	return &h
+}
+
+func (s *Storage) UpdateHighlightComment(id int64, comment string) bool {
+	_, err := s.db.Exec(`update highlights set comment = ? where id = ? and user_id = ?`, comment, id, s.userId)
+	return err == nil
+}
+
+func (s *Storage) DeleteHighlight(id int64) bool {
+	_, err := s.db.Exec(`delete from highlights where id = ? and user_id = ?`, id, s.userId)
+	if err != nil {
+		slog.Error("database error", "err", err)
+	}
+	return err == nil
+}
+
+// Lists highlights of the given item, or of all items if itemId is nil.
+func (s *Storage) ListHighlights(itemId *int64) []Highlight {
+	result := make([]Highlight, 0)
+	rows, err := s.db.Query(`
+		select id, item_id, text, prefix, suffix, comment, date_created
+		from highlights
+		where user_id = ? and (? is null or item_id = ?)
+		order by date_created, id
+	`, s.userId, itemId, itemId)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return result
+	}
+	for rows.Next() {
+		var h Highlight
+		err = rows.Scan(&h.Id, &h.ItemId, &h.Text, &h.Prefix, &h.Suffix, &h.Comment, &h.DateCreated)
+		if err != nil {
+			slog.Error("database error", "err", err)
+			return result
+		}
+		result = append(result, h)
+	}
+	return result
+}
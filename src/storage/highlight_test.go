@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHighlights(t *testing.T) {
+	db := testDB()
+	testItemsSetup(db)
+
+	item111 := getItem(db, "item111")
+	item121 := getItem(db, "item121")
+
+	h1 := db.CreateHighlight(Highlight{ItemId: item111.Id, Text: "quote", Prefix: "a ", Suffix: " b"})
+	h2 := db.CreateHighlight(Highlight{ItemId: item121.Id, Text: "another", Comment: "why"})
+	if h1 == nil || h2 == nil || h1.Id == h2.Id {
+		t.Fatal("expected highlights to be created")
+	}
+
+	if have := db.ListHighlights(&item111.Id); len(have) != 1 || have[0].Text != "quote" || have[0].Prefix != "a " {
+		t.Errorf("invalid item highlights: %#v", have)
+	}
+	if have := db.ListHighlights(nil); len(have) != 2 {
+		t.Errorf("expected 2 highlights, got %#v", have)
+	}
+
+	db.UpdateHighlightComment(h1.Id, "note")
+	if have := db.ListHighlights(&item111.Id); have[0].Comment != "note" {
+		t.Errorf("comment not updated: %#v", have)
+	}
+
+	db.DeleteHighlight(h2.Id)
+	if have := db.ListHighlights(nil); len(have) != 1 {
+		t.Errorf("expected 1 highlight, got %#v", have)
+	}
+}
+
+func TestDeleteOldItemsKeepsHighlighted(t *testing.T) {
+	db := testDB()
+	feed := db.CreateFeed("feed", "", "", "http://test.com/feed.xml", nil)
+	db.CreateItems([]Item{{GUID: "highlighted", FeedId: feed.Id, Title: "title", Date: time.Now()}})
+	db.db.Exec(`update items set date_arrived = ?`, time.Now().Add(-time.Hour*time.Duration(itemsKeepDays*24+1)))
+	db.CreateHighlight(Highlight{ItemId: getItem(db, "highlighted").Id, Text: "quote"})
+
+	// force the feed below its retention size
+	db.UpdateSettings(map[string]interface{}{"retention_keep_size": 0})
+
+	db.DeleteOldItems()
+	if have := db.CountItems(ItemFilter{FeedID: &feed.Id}); have != 1 {
+		t.Fatalf("expected highlighted item to be kept, have %d items", have)
+	}
+}
@@ -1,7 +1,7 @@
 package storage
 
 import (
-	"log"
+	"log/slog"
 	"time"
 )
 
@@ -17,7 +17,7 @@ func (s *Storage) ListHTTPStates() map[int64]HTTPState {
 	result := make(map[int64]HTTPState)
 	rows, err := s.db.Query(`select feed_id, last_refreshed, last_modified, etag from http_states`)
 	if err != nil {
-		log.Print(err)
+		slog.Error("database error", "err", err)
 		return result
 	}
 	for rows.Next() {
@@ -29,7 +29,7 @@ func (s *Storage) ListHTTPStates() map[int64]HTTPState {
 			&state.Etag,
 		)
 		if err != nil {
-			log.Print(err)
+			slog.Error("database error", "err", err)
 			return result
 		}
 		result[state.FeedID] = state
@@ -68,6 +68,6 @@ func (s *Storage) SetHTTPState(feedID int64, lastModified, etag string) {
 		lastModified, etag,
 	)
 	if err != nil {
-		log.Print(err)
+		slog.Error("database error", "err", err)
 	}
 }
@@ -1,10 +1,11 @@
 package storage
 
 import (
+	"database/sql"
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"sort"
 	"strings"
 	"time"
@@ -65,32 +66,46 @@ func (m MediaLinks) Value() (driver.Value, error) {
 }
 
 type Item struct {
-	Id         int64      `json:"id"`
-	GUID       string     `json:"guid"`
-	FeedId     int64      `json:"feed_id"`
-	Title      string     `json:"title"`
-	Link       string     `json:"link"`
-	Content    string     `json:"content,omitempty"`
-	Date       time.Time  `json:"date"`
-	Status     ItemStatus `json:"status"`
-	MediaLinks MediaLinks `json:"media_links"`
+	Id          int64      `json:"id"`
+	GUID        string     `json:"guid"`
+	FeedId      int64      `json:"feed_id"`
+	Title       string     `json:"title"`
+	Author      string     `json:"author,omitempty"`
+	Link        string     `json:"link"`
+	Content     string     `json:"content,omitempty"`
+	Date        time.Time  `json:"date"`
+	Status      ItemStatus `json:"status"`
+	MediaLinks  MediaLinks `json:"media_links"`
+	ReadingTime int        `json:"reading_time,omitempty"`
+
+	// when the item arrived or its status last changed, set by ListItems
+	LastModified time.Time `json:"-"`
 }
 
 type ItemFilter struct {
 	FolderID *int64
 	FeedID   *int64
+	LabelID  *int64
 	Status   *ItemStatus
+	Statuses *[]ItemStatus
 	Search   *string
 	After    *int64
 	IDs      *[]int64
 	SinceID  *int64
 	MaxID    *int64
 	Before   *time.Time
+	Since    *time.Time
+	Spark    *bool
+	// arrived or changed the status since
+	ModifiedSince *time.Time
 }
 
 type MarkFilter struct {
 	FolderID *int64
 	FeedID   *int64
+	LabelID  *int64
+	MaxID    *int64
+	Spark    *bool
 
 	Before *time.Time
 }
@@ -114,10 +129,17 @@ func (list ItemList) Swap(i, j int) {
 }
 
 func (s *Storage) CreateItems(items []Item) bool {
+	_, ok := s.CreateNewItems(items)
+	return ok
+}
+
+// Same as CreateItems, but also returns the number of items
+// not stored before.
+func (s *Storage) CreateNewItems(items []Item) (int64, bool) {
 	tx, err := s.db.Begin()
 	if err != nil {
-		log.Print(err)
-		return false
+		slog.Error("database error", "err", err)
+		return 0, false
 	}
 
 	now := time.Now().UTC()
@@ -125,54 +147,84 @@ func (s *Storage) CreateItems(items []Item) bool {
 	itemsSorted := ItemList(items)
 	sort.Sort(itemsSorted)
 
+	created := int64(0)
 	for _, item := range itemsSorted {
-		_, err = tx.Exec(`
+		res, err := tx.Exec(`
 			insert into items (
 				guid, feed_id, title, link, date,
-				content, media_links,
-				date_arrived, status
+				content, media_links, reading_time,
+				date_arrived, author
 			)
 			values (
 				?, ?, ?, ?, strftime('%Y-%m-%d %H:%M:%f', ?),
-				?, ?,
+				?, ?, ?,
 				?, ?
 			)
 			on conflict (feed_id, guid) do nothing`,
 			item.GUID, item.FeedId, item.Title, item.Link, item.Date,
-			item.Content, item.MediaLinks,
-			now, UNREAD,
+			item.Content, item.MediaLinks, item.ReadingTime,
+			now, item.Author,
 		)
 		if err != nil {
-			log.Print(err)
+			slog.Error("failed to store item", "feed_id", item.FeedId, "guid", item.GUID, "err", err)
 			if err = tx.Rollback(); err != nil {
-				log.Print(err)
-				return false
+				slog.Error("database error", "err", err)
+				return 0, false
 			}
-			return false
+			return 0, false
+		}
+		if n, err := res.RowsAffected(); err == nil {
+			created += n
 		}
 	}
 	if err = tx.Commit(); err != nil {
-		log.Print(err)
-		return false
+		slog.Error("database error", "err", err)
+		return 0, false
 	}
-	return true
+	return created, true
 }
 
-func listQueryPredicate(filter ItemFilter, newestFirst bool) (string, []interface{}) {
+// Items of the feeds the user (the query argument) is subscribed to,
+// joined with the subscription `sub` and the user's item state `st`.
+const userItemsTable = `
+	items i
+	join subscriptions sub on sub.feed_id = i.feed_id and sub.user_id = ?
+	left join item_states st on st.item_id = i.id and st.user_id = sub.user_id`
+
+// Status of the item for the user, see userItemsTable.
+var itemStatusExpr = fmt.Sprintf("ifnull(st.status, %d)", UNREAD)
+
+// Makes the wildcards of the `like` patterns match literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Predicate over userItemsTable, the args follow the user id.
+func (s *Storage) listQueryPredicate(filter ItemFilter, newestFirst bool) (string, []interface{}) {
 	cond := make([]string, 0)
 	args := make([]interface{}, 0)
 	if filter.FolderID != nil {
-		cond = append(cond, "i.feed_id in (select id from feeds where folder_id = ?)")
-		args = append(args, *filter.FolderID)
+		cond = append(cond, fmt.Sprintf("sub.folder_id in (%s)", folderSubtreeQuery))
+		args = append(args, *filter.FolderID, s.userId)
 	}
 	if filter.FeedID != nil {
 		cond = append(cond, "i.feed_id = ?")
 		args = append(args, *filter.FeedID)
 	}
+	if filter.LabelID != nil {
+		cond = append(cond, "i.id in (select il.item_id from item_labels il join labels l on l.id = il.label_id where l.id = ? and l.user_id = ?)")
+		args = append(args, *filter.LabelID, s.userId)
+	}
 	if filter.Status != nil {
-		cond = append(cond, "i.status = ?")
+		cond = append(cond, itemStatusExpr+" = ?")
 		args = append(args, *filter.Status)
 	}
+	if filter.Statuses != nil {
+		qmarks := make([]string, len(*filter.Statuses))
+		for i, status := range *filter.Statuses {
+			qmarks[i] = "?"
+			args = append(args, status)
+		}
+		cond = append(cond, fmt.Sprintf("%s in (%s)", itemStatusExpr, strings.Join(qmarks, ",")))
+	}
 	if filter.Search != nil {
 		words := strings.Fields(*filter.Search)
 		terms := make([]string, len(words))
@@ -180,8 +232,23 @@ func listQueryPredicate(filter ItemFilter, newestFirst bool) (string, []interfac
 			terms[idx] = word + "*"
 		}
 
-		cond = append(cond, "i.search_rowid in (select rowid from search where search match ?)")
-		args = append(args, strings.Join(terms, " "))
+		// notes are private, so they're matched apart from the shared index
+		noteCond := make([]string, len(words))
+		noteArgs := make([]interface{}, len(words))
+		for idx, word := range words {
+			noteCond[idx] = `text like ? escape '\'`
+			noteArgs[idx] = "%" + likeEscaper.Replace(word) + "%"
+		}
+		if len(words) == 0 {
+			noteCond = append(noteCond, "0")
+		}
+
+		cond = append(cond, fmt.Sprintf(`(
+			i.search_rowid in (select rowid from search where search match ?) or
+			i.id in (select item_id from item_notes where user_id = ? and %s)
+		)`, strings.Join(noteCond, " and ")))
+		args = append(args, strings.Join(terms, " "), s.userId)
+		args = append(args, noteArgs...)
 	}
 	if filter.After != nil {
 		compare := ">"
@@ -213,6 +280,18 @@ func listQueryPredicate(filter ItemFilter, newestFirst bool) (string, []interfac
 		cond = append(cond, "i.date < ?")
 		args = append(args, filter.Before)
 	}
+	if filter.Since != nil {
+		cond = append(cond, "i.date >= ?")
+		args = append(args, filter.Since)
+	}
+	if filter.Spark != nil {
+		cond = append(cond, "sub.is_spark = ?")
+		args = append(args, *filter.Spark)
+	}
+	if filter.ModifiedSince != nil {
+		cond = append(cond, "(i.date_arrived >= ? or st.date_updated >= ?)")
+		args = append(args, filter.ModifiedSince.UTC(), filter.ModifiedSince.UTC())
+	}
 
 	predicate := "1"
 	if len(cond) > 0 {
@@ -223,29 +302,34 @@ func listQueryPredicate(filter ItemFilter, newestFirst bool) (string, []interfac
 }
 
 func (s *Storage) CountItems(filter ItemFilter) int {
-	predicate, args := listQueryPredicate(filter, false)
+	predicate, args := s.listQueryPredicate(filter, false)
 
 	var count int
 	query := fmt.Sprintf(`
 		select count(*)
-		from items
+		from %s
 		where %s
-		`, predicate)
-	err := s.db.QueryRow(query, args...).Scan(&count)
+		`, userItemsTable, predicate)
+	err := s.db.QueryRow(query, append([]interface{}{s.userId}, args...)...).Scan(&count)
 	if err != nil {
-		log.Print(err)
+		slog.Error("database error", "err", err)
 		return 0
 	}
 	return count
 }
 
 func (s *Storage) ListItems(filter ItemFilter, limit int, newestFirst bool, withContent bool) []Item {
-	predicate, args := listQueryPredicate(filter, newestFirst)
+	return s.ListItemsPage(filter, limit, 0, newestFirst, withContent)
+}
+
+// Same as ListItems, skipping the first `offset` items.
+func (s *Storage) ListItemsPage(filter ItemFilter, limit, offset int, newestFirst bool, withContent bool) []Item {
+	predicate, args := s.listQueryPredicate(filter, newestFirst)
 	result := make([]Item, 0, 0)
 
-	order := "date desc, id desc"
+	order := "i.date desc, i.id desc"
 	if !newestFirst {
-		order = "date asc, id asc"
+		order = "i.date asc, i.id asc"
 	}
 	if filter.IDs != nil || filter.SinceID != nil {
 		order = "i.id asc"
@@ -254,7 +338,7 @@ func (s *Storage) ListItems(filter ItemFilter, limit int, newestFirst bool, with
 		order = "i.id desc"
 	}
 
-	selectCols := "i.id, i.guid, i.feed_id, i.title, i.link, i.date, i.status, i.media_links"
+	selectCols := "i.id, i.guid, i.feed_id, i.title, i.link, i.date, " + itemStatusExpr + ", i.media_links, i.reading_time, i.date_arrived, st.date_updated, ifnull(i.author, '')"
 	if withContent {
 		selectCols += ", i.content"
 	} else {
@@ -262,69 +346,96 @@ func (s *Storage) ListItems(filter ItemFilter, limit int, newestFirst bool, with
 	}
 	query := fmt.Sprintf(`
 		select %s
-		from items i
+		from %s
 		where %s
 		order by %s
-		limit %d
-		`, selectCols, predicate, order, limit)
-	rows, err := s.db.Query(query, args...)
+		limit %d offset %d
+		`, selectCols, userItemsTable, predicate, order, limit, offset)
+	rows, err := s.db.Query(query, append([]interface{}{s.userId}, args...)...)
 	if err != nil {
-		log.Print(err)
+		slog.Error("database error", "err", err)
 		return result
 	}
 	for rows.Next() {
 		var x Item
+		var arrived, updated sql.NullTime
 		err = rows.Scan(
 			&x.Id, &x.GUID, &x.FeedId,
 			&x.Title, &x.Link, &x.Date,
-			&x.Status, &x.MediaLinks, &x.Content,
+			&x.Status, &x.MediaLinks, &x.ReadingTime,
+			&arrived, &updated, &x.Author, &x.Content,
 		)
 		if err != nil {
-			log.Print(err)
+			slog.Error("database error", "err", err)
 			return result
 		}
+		x.LastModified = arrived.Time
+		if updated.Valid && updated.Time.After(x.LastModified) {
+			x.LastModified = updated.Time
+		}
 		result = append(result, x)
 	}
 	return result
 }
 
+// Returns the item if it belongs to a feed the user is subscribed to.
 func (s *Storage) GetItem(id int64) *Item {
 	i := &Item{}
-	err := s.db.QueryRow(`
+	err := s.db.QueryRow(fmt.Sprintf(`
 		select
 			i.id, i.guid, i.feed_id, i.title, i.link, i.content,
-			i.date, i.status, i.media_links
-		from items i
+			i.date, %s, i.media_links, i.reading_time, ifnull(i.author, '')
+		from %s
 		where i.id = ?
-	`, id).Scan(
+	`, itemStatusExpr, userItemsTable), s.userId, id).Scan(
 		&i.Id, &i.GUID, &i.FeedId, &i.Title, &i.Link, &i.Content,
-		&i.Date, &i.Status, &i.MediaLinks,
+		&i.Date, &i.Status, &i.MediaLinks, &i.ReadingTime, &i.Author,
 	)
 	if err != nil {
-		log.Print(err)
+		if err != sql.ErrNoRows {
+			slog.Error("database error", "err", err)
+		}
 		return nil
 	}
 	return i
 }
 
 func (s *Storage) UpdateItemStatus(item_id int64, status ItemStatus) bool {
-	_, err := s.db.Exec(`update items set status = ? where id = ?`, status, item_id)
+	_, err := s.db.Exec(`
+		insert into item_states (user_id, item_id, status, date_updated)
+		select sub.user_id, i.id, ?, ?
+		from items i
+		join subscriptions sub on sub.feed_id = i.feed_id and sub.user_id = ?
+		where i.id = ?
+		on conflict (user_id, item_id) do update
+		set status = excluded.status, date_updated = excluded.date_updated
+		where status != excluded.status`,
+		status, time.Now().UTC(), s.userId, item_id,
+	)
 	return err == nil
 }
 
 func (s *Storage) MarkItemsRead(filter MarkFilter) bool {
-	predicate, args := listQueryPredicate(ItemFilter{
+	predicate, args := s.listQueryPredicate(ItemFilter{
 		FolderID: filter.FolderID,
 		FeedID:   filter.FeedID,
+		LabelID:  filter.LabelID,
+		MaxID:    filter.MaxID,
+		Spark:    filter.Spark,
 		Before:   filter.Before,
 	}, false)
 	query := fmt.Sprintf(`
-		update items as i set status = %d
-		where %s and i.status != %d
-		`, READ, predicate, STARRED)
+		insert into item_states (user_id, item_id, status, date_updated)
+		select sub.user_id, i.id, %d, ?
+		from %s
+		where %s and %s = %d
+		on conflict (user_id, item_id) do update
+		set status = excluded.status, date_updated = excluded.date_updated
+		`, READ, userItemsTable, predicate, itemStatusExpr, UNREAD)
+	args = append([]interface{}{time.Now().UTC(), s.userId}, args...)
 	_, err := s.db.Exec(query, args...)
 	if err != nil {
-		log.Print(err)
+		slog.Error("database error", "err", err)
 	}
 	return err == nil
 }
@@ -339,14 +450,14 @@ func (s *Storage) FeedStats() []FeedStat {
 	result := make([]FeedStat, 0)
 	rows, err := s.db.Query(fmt.Sprintf(`
 		select
-			feed_id,
-			sum(case status when %d then 1 else 0 end),
-			sum(case status when %d then 1 else 0 end)
-		from items
-		group by feed_id
-	`, UNREAD, STARRED))
+			i.feed_id,
+			sum(case %s when %d then 1 else 0 end),
+			sum(case %s when %d then 1 else 0 end)
+		from %s
+		group by i.feed_id
+	`, itemStatusExpr, UNREAD, itemStatusExpr, STARRED, userItemsTable), s.userId)
 	if err != nil {
-		log.Print(err)
+		slog.Error("database error", "err", err)
 		return result
 	}
 	for rows.Next() {
@@ -357,14 +468,39 @@ func (s *Storage) FeedStats() []FeedStat {
 	return result
 }
 
+// Returns the date of the newest item of each feed the user follows.
+func (s *Storage) FeedLastItemDates() map[int64]time.Time {
+	result := make(map[int64]time.Time)
+	rows, err := s.db.Query(`
+		select i.feed_id, cast(strftime('%s', max(i.date)) as integer)
+		from items i
+		join subscriptions sub on sub.feed_id = i.feed_id and sub.user_id = ?
+		group by i.feed_id
+	`, s.userId)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return result
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var feedId, unix int64
+		if err := rows.Scan(&feedId, &unix); err != nil {
+			slog.Error("database error", "err", err)
+			return result
+		}
+		result[feedId] = time.Unix(unix, 0).UTC()
+	}
+	return result
+}
+
 func (s *Storage) SyncSearch() {
 	rows, err := s.db.Query(`
-		select id, title, content
-		from items
-		where search_rowid is null;
+		select i.id, i.title, i.content
+		from items i
+		where i.search_rowid is null;
 	`)
 	if err != nil {
-		log.Print(err)
+		slog.Error("database error", "err", err)
 		return
 	}
 
@@ -377,11 +513,11 @@ func (s *Storage) SyncSearch() {
 
 	for _, item := range items {
 		result, err := s.db.Exec(`
-			insert into search (title, description, content) values (?, "", ?)`,
+			insert into search (title, description, content) values (?, '', ?)`,
 			item.Title, htmlutil.ExtractText(item.Content),
 		)
 		if err != nil {
-			log.Print(err)
+			slog.Error("failed to index item", "item_id", item.Id, "err", err)
 			return
 		}
 		if numrows, err := result.RowsAffected(); err == nil && numrows == 1 {
@@ -400,65 +536,121 @@ var (
 	itemsKeepDays = 90
 )
 
+// Items any user has starred, labeled, annotated, highlighted or saved are never cleaned up.
+var itemIsDisposable = fmt.Sprintf(`
+	i.id not in (select item_id from item_states where status = %d)
+	and i.id not in (select item_id from item_labels)
+	and i.id not in (select item_id from item_notes)
+	and i.id not in (select item_id from highlights)
+	and i.feed_id not in (select id from feeds where feed_link like '%s:%%')`,
+	STARRED, SavedFeedLink,
+)
+
 // Delete old articles from the database to cleanup space.
 //
 // The rules:
-//   - Never delete starred entries.
-//   - Keep at least the same amount of articles the feed provides (default: 50).
+//   - Never delete starred, labeled, annotated, highlighted or saved entries.
+//   - Keep at least the same amount of articles the feed provides, but no less
+//     than the retention size (default: 50).
 //     This prevents from deleting items for rarely updated and/or ever-growing
 //     feeds which might eventually reappear as unread.
-//   - Keep entries for a certain period (default: 90 days).
+//   - Keep entries for a certain period (default: 90 days, 0 keeps forever).
+//   - Optionally drop the content of entries older than a certain period,
+//     keeping the entries themselves.
+//
+// The retention settings can be overridden per feed (see RetentionPolicy).
 func (s *Storage) DeleteOldItems() {
-	rows, err := s.db.Query(`
-		select
-			i.feed_id,
-			max(coalesce(s.size, 0), ?) as max_items,
-			count(*) as num_items
-		from items i
-		left outer join feed_sizes s on s.feed_id = i.feed_id
-		where status != ?
-		group by i.feed_id
-	`, itemsKeepSize, STARRED)
-
+	feedRules, feedSizes, err := s.feedRetentionRules()
 	if err != nil {
-		log.Print(err)
+		slog.Error("database error", "err", err)
 		return
 	}
 
-	feedLimits := make(map[int64]int64, 0)
-	for rows.Next() {
-		var feedId, limit int64
-		rows.Scan(&feedId, &limit, nil)
-		feedLimits[feedId] = limit
-	}
-
-	for feedId, limit := range feedLimits {
-		result, err := s.db.Exec(`
-			delete from items
-			where id in (
-				select i.id
-				from items i
-				where i.feed_id = ? and status != ?
-				order by date desc
-				limit -1 offset ?
-			) and date_arrived < ?
-			`,
-			feedId,
-			STARRED,
-			limit,
-			time.Now().UTC().Add(-time.Hour*time.Duration(24*itemsKeepDays)),
-		)
-		if err != nil {
-			log.Print(err)
-			return
-		}
-		numDeleted, err := result.RowsAffected()
-		if err != nil {
-			log.Print(err)
-			return
+	for feedId, rules := range feedRules {
+		if rules.keepDays > 0 {
+			result, err := s.db.Exec(
+				`delete from items where id in (`+expiredItemsQuery+`)`,
+				feedId,
+				max(feedSizes[feedId], rules.keepSize),
+				daysAgo(rules.keepDays),
+			)
+			if err != nil {
+				slog.Error("database error", "err", err)
+				return
+			}
+			numDeleted, err := result.RowsAffected()
+			if err != nil {
+				slog.Error("database error", "err", err)
+				return
+			}
+			if numDeleted > 0 {
+				slog.Info("deleted old items", "feed_id", feedId, "count", numDeleted)
+			}
 		}
-		if numDeleted > 0 {
-			log.Printf("Deleted %d old items (feed: %d)", numDeleted, feedId)
+		if rules.contentDays > 0 {
+			numDropped, err := s.dropItemContent(feedId, daysAgo(rules.contentDays))
+			if err != nil {
+				slog.Error("database error", "err", err)
+				return
+			}
+			if numDropped > 0 {
+				slog.Info("dropped content of old items", "feed_id", feedId, "count", numDropped)
+			}
 		}
 	}
 }
+
+func (s *Storage) dropItemContent(feedId int64, cutoff time.Time) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		update search set content = ''
+		where rowid in (
+			select search_rowid from items
+			where id in (`+staleContentQuery+`) and search_rowid is not null
+		)`,
+		feedId, cutoff,
+	)
+	if err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec(
+		`update items set content = '' where id in (`+staleContentQuery+`)`,
+		feedId, cutoff,
+	)
+	if err != nil {
+		return 0, err
+	}
+	numDropped, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return numDropped, tx.Commit()
+}
+
+// Stores an article in the user's saved articles pseudo-feed.
+// Saving an article with the same guid returns the existing one.
+func (s *Storage) CreateSavedItem(item Item) *Item {
+	feed := s.GetSavedFeed()
+	if feed == nil {
+		return nil
+	}
+	item.FeedId = feed.Id
+	if !s.CreateItems([]Item{item}) {
+		return nil
+	}
+	var id int64
+	err := s.db.QueryRow(
+		`select id from items where feed_id = ? and guid = ?`,
+		feed.Id, item.GUID,
+	).Scan(&id)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return nil
+	}
+	return s.GetItem(id)
+}
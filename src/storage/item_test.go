@@ -34,8 +34,8 @@ type testItemScope struct {
 }
 
 func testItemsSetup(db *Storage) testItemScope {
-	folder1 := db.CreateFolder("folder1")
-	folder2 := db.CreateFolder("folder2")
+	folder1 := db.CreateFolder("folder1", nil)
+	folder2 := db.CreateFolder("folder2", nil)
 
 	feed11 := db.CreateFeed("feed11", "", "", "http://test.com/feed11.xml", &folder1.Id)
 	feed12 := db.CreateFeed("feed12", "", "", "http://test.com/feed12.xml", &folder1.Id)
@@ -59,8 +59,12 @@ func testItemsSetup(db *Storage) testItemScope {
 		{GUID: "item012", FeedId: feed01.Id, Title: "title012", Date: now.Add(time.Hour * 24 * 9)},  // read
 		{GUID: "item013", FeedId: feed01.Id, Title: "title013", Date: now.Add(time.Hour * 24 * 10)}, // starred
 	})
-	db.db.Exec(`update items set status = ? where guid in ("item112", "item122", "item211", "item012")`, READ)
-	db.db.Exec(`update items set status = ? where guid in ("item113", "item212", "item013")`, STARRED)
+	for _, guid := range []string{"item112", "item122", "item211", "item012"} {
+		db.UpdateItemStatus(getItem(db, guid).Id, READ)
+	}
+	for _, guid := range []string{"item113", "item212", "item013"} {
+		db.UpdateItemStatus(getItem(db, guid).Id, STARRED)
+	}
 
 	return testItemScope{
 		feed11:  feed11,
@@ -77,10 +81,11 @@ func getItem(db *Storage, guid string) *Item {
 	err := db.db.QueryRow(`
 		select
 			i.id, i.guid, i.feed_id, i.title, i.link, i.content,
-			i.date, i.status, i.media_links
+			i.date, ifnull(st.status, 0), i.media_links
 		from items i
+		left join item_states st on st.item_id = i.id and st.user_id = ?
 		where i.guid = ?
-	`, guid).Scan(
+	`, db.userId, guid).Scan(
 		&i.Id, &i.GUID, &i.FeedId, &i.Title, &i.Link, &i.Content,
 		&i.Date, &i.Status, &i.MediaLinks,
 	)
@@ -226,6 +231,50 @@ func TestListItemsPaginated(t *testing.T) {
 	}
 }
 
+func TestListItemsPage(t *testing.T) {
+	db := testDB()
+	testItemsSetup(db)
+
+	// read or starred, newest first, second page
+	statuses := []ItemStatus{READ, STARRED}
+	have := getItemGuids(db.ListItemsPage(ItemFilter{Statuses: &statuses}, 3, 3, true, false))
+	want := []string{"item211", "item122", "item113"}
+	if !reflect.DeepEqual(have, want) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fail()
+	}
+	if count := db.CountItems(ItemFilter{Statuses: &statuses}); count != 7 {
+		t.Fatalf("expected 7 items, got %d", count)
+	}
+}
+
+func TestListItemsModifiedSince(t *testing.T) {
+	db := testDB()
+	scope := testItemsSetup(db)
+
+	since := time.Now()
+	db.UpdateItemStatus(getItem(db, "item111").Id, READ)
+	db.MarkItemsRead(MarkFilter{FeedID: &scope.feed12.Id})
+
+	items := db.ListItems(ItemFilter{ModifiedSince: &since}, 10, false, false)
+	have := getItemGuids(items)
+	want := []string{"item111", "item121"}
+	if !reflect.DeepEqual(have, want) {
+		t.Logf("want: %#v", want)
+		t.Logf("have: %#v", have)
+		t.Fail()
+	}
+	for _, item := range items {
+		if item.LastModified.Before(since) {
+			t.Fatalf("expected %s to be modified after %s, got %s", item.GUID, since, item.LastModified)
+		}
+	}
+	if all := db.ListItems(ItemFilter{}, 1, false, false); all[0].LastModified.IsZero() {
+		t.Fatal("expected the arrival date as the last modification")
+	}
+}
+
 func TestMarkItemsRead(t *testing.T) {
 	// NOTE: starred items must not be marked as read
 	var read ItemStatus = READ
@@ -328,3 +377,44 @@ func TestDeleteOldItems(t *testing.T) {
 		)
 	}
 }
+
+func TestCreateSavedItem(t *testing.T) {
+	db := testDB()
+	item1 := db.CreateSavedItem(Item{GUID: "http://example.com/a", Title: "a", Link: "http://example.com/a", Date: time.Now(), ReadingTime: 3})
+	if item1 == nil || item1.ReadingTime != 3 {
+		t.Fatalf("expected saved item, got %#v", item1)
+	}
+	item2 := db.CreateSavedItem(Item{GUID: "http://example.com/a", Title: "a"})
+	if item2 == nil || item2.Id != item1.Id {
+		t.Fatalf("expected the same item.\nwant: %#v\nhave: %#v", item1, item2)
+	}
+
+	feed := db.GetSavedFeed()
+	if feed == nil || !feed.IsSaved() || feed.Id != item1.FeedId {
+		t.Fatalf("invalid saved feed: %#v", feed)
+	}
+	if len(db.ListFeedsMissingIcons()) != 0 {
+		t.Error("saved feed must not be looked up for a favicon")
+	}
+
+	db.db.Exec(`update items set date_arrived = ?`, time.Now().Add(-time.Hour*time.Duration(itemsKeepDays*24+1)))
+	db.UpdateSettings(map[string]interface{}{"retention_keep_size": 0})
+
+	db.DeleteOldItems()
+	if db.GetItem(item1.Id) == nil {
+		t.Fatal("saved item must never be cleaned up")
+	}
+}
+
+func TestCreateNewItems(t *testing.T) {
+	db := testDB()
+	scope := testItemsSetup(db)
+
+	created, ok := db.CreateNewItems([]Item{
+		{GUID: "item111", FeedId: scope.feed11.Id, Title: "title111", Date: time.Now()},
+		{GUID: "item114", FeedId: scope.feed11.Id, Title: "title114", Date: time.Now()},
+	})
+	if !ok || created != 1 {
+		t.Fatalf("expected 1 new item, got %d (ok: %v)", created, ok)
+	}
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"log/slog"
+)
+
+type Label struct {
+	Id    int64  `json:"id"`
+	Title string `json:"title"`
+}
+
+func (s *Storage) CreateLabel(title string) *Label {
+	row := s.db.QueryRow(`
+		insert into labels (user_id, title) values (?, ?)
+		on conflict (user_id, title) do update set title = ?
+		returning id`,
+		s.userId, title,
+		// provide title again so that we can extract row id
+		title,
+	)
+	var id int64
+	if err := row.Scan(&id); err != nil {
+		slog.Error("database error", "err", err)
+		return nil
+	}
+	return &Label{Id: id, Title: title}
+}
+
+func (s *Storage) RenameLabel(labelId int64, newTitle string) bool {
+	_, err := s.db.Exec(`update labels set title = ? where id = ? and user_id = ?`, newTitle, labelId, s.userId)
+	return err == nil
+}
+
+func (s *Storage) DeleteLabel(labelId int64) bool {
+	_, err := s.db.Exec(`delete from labels where id = ? and user_id = ?`, labelId, s.userId)
+	if err != nil {
+		slog.Error("database error", "err", err)
+	}
+	return err == nil
+}
+
+func (s *Storage) ListLabels() []Label {
+	result := make([]Label, 0)
+	rows, err := s.db.Query(`
+		select id, title
+		from labels
+		where user_id = ?
+		order by title collate nocase
+	`, s.userId)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return result
+	}
+	for rows.Next() {
+		var l Label
+		if err = rows.Scan(&l.Id, &l.Title); err != nil {
+			slog.Error("database error", "err", err)
+			return result
+		}
+		result = append(result, l)
+	}
+	return result
+}
+
+func (s *Storage) ListItemLabels(itemId int64) []Label {
+	result := make([]Label, 0)
+	rows, err := s.db.Query(`
+		select l.id, l.title
+		from labels l
+		join item_labels il on il.label_id = l.id
+		where il.item_id = ? and l.user_id = ?
+		order by l.title collate nocase
+	`, itemId, s.userId)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return result
+	}
+	for rows.Next() {
+		var l Label
+		if err = rows.Scan(&l.Id, &l.Title); err != nil {
+			slog.Error("database error", "err", err)
+			return result
+		}
+		result = append(result, l)
+	}
+	return result
+}
+
+// Replaces the labels of the item with the given ones.
+func (s *Storage) SetItemLabels(itemId int64, labelIds []int64) bool {
+	tx, err := s.db.Begin()
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return false
+	}
+	_, err = tx.Exec(`
+		delete from item_labels
+		where item_id = ? and label_id in (select id from labels where user_id = ?)`,
+		itemId, s.userId,
+	)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		tx.Rollback()
+		return false
+	}
+	for _, labelId := range labelIds {
+		_, err = tx.Exec(`
+			insert into item_labels (item_id, label_id)
+			select ?, id from labels where id = ? and user_id = ?
+			on conflict do nothing`,
+			itemId, labelId, s.userId,
+		)
+		if err != nil {
+			slog.Error("database error", "err", err)
+			tx.Rollback()
+			return false
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		slog.Error("database error", "err", err)
+		return false
+	}
+	return true
+}
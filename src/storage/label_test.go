@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestItemLabels(t *testing.T) {
+	db := testDB()
+	testItemsSetup(db)
+
+	work := db.CreateLabel("work")
+	later := db.CreateLabel("later")
+	if same := db.CreateLabel("work"); same == nil || same.Id != work.Id {
+		t.Fatalf("expected the same label.\nwant: %#v\nhave: %#v", work, same)
+	}
+
+	item111 := getItem(db, "item111")
+	item211 := getItem(db, "item211")
+	db.SetItemLabels(item111.Id, []int64{work.Id, later.Id})
+	db.SetItemLabels(item211.Id, []int64{work.Id, 100500})
+
+	have := db.ListItemLabels(item111.Id)
+	if want := []Label{*later, *work}; !reflect.DeepEqual(have, want) {
+		t.Errorf("invalid item labels\nwant: %#v\nhave: %#v", want, have)
+	}
+
+	guids := getItemGuids(db.ListItems(ItemFilter{LabelID: &work.Id}, 10, false, false))
+	if want := []string{"item111", "item211"}; !reflect.DeepEqual(guids, want) {
+		t.Errorf("invalid items by label\nwant: %#v\nhave: %#v", want, guids)
+	}
+
+	db.SetItemLabels(item111.Id, []int64{})
+	if have := db.ListItemLabels(item111.Id); len(have) != 0 {
+		t.Errorf("expected labels to be removed, got %#v", have)
+	}
+}
+
+func TestItemNoteSearch(t *testing.T) {
+	db := testDB()
+	testItemsSetup(db)
+
+	item111 := getItem(db, "item111")
+	item121 := getItem(db, "item121")
+
+	// note written before the item got indexed
+	db.UpdateItemNote(item111.Id, "remember *quokka*")
+	db.SyncSearch()
+	// note written after the item got indexed
+	db.UpdateItemNote(item121.Id, "about quokkas again")
+
+	if note := db.GetItemNote(item111.Id); note == nil || note.Text != "remember *quokka*" {
+		t.Fatalf("invalid note: %#v", note)
+	}
+
+	search := "quokka"
+	have := getItemGuids(db.ListItems(ItemFilter{Search: &search}, 10, false, false))
+	if want := []string{"item111", "item121"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("invalid search results\nwant: %#v\nhave: %#v", want, have)
+	}
+
+	db.UpdateItemNote(item121.Id, "")
+	if db.GetItemNote(item121.Id) != nil {
+		t.Error("expected note to be removed")
+	}
+	have = getItemGuids(db.ListItems(ItemFilter{Search: &search}, 10, false, false))
+	if want := []string{"item111"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("invalid search results\nwant: %#v\nhave: %#v", want, have)
+	}
+}
+
+func TestItemNoteSearchWildcards(t *testing.T) {
+	db := testDB()
+	testItemsSetup(db)
+
+	item111 := getItem(db, "item111")
+	item121 := getItem(db, "item121")
+	db.UpdateItemNote(item111.Id, "quokka_fact")
+	db.UpdateItemNote(item121.Id, "quokkasfact")
+
+	search := "quokka_fact"
+	have := getItemGuids(db.ListItems(ItemFilter{Search: &search}, 10, false, false))
+	if want := []string{"item111"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("invalid search results\nwant: %#v\nhave: %#v", want, have)
+	}
+}
+
+func TestDeleteOldItemsKeepsLabeledAndNoted(t *testing.T) {
+	now := time.Now().UTC()
+	db := testDB()
+	feed := db.CreateFeed("feed", "", "", "http://test.com/feed.xml", nil)
+
+	items := make([]Item, 0)
+	for i := 0; i < itemsKeepSize+3; i++ {
+		istr := strconv.Itoa(i)
+		items = append(items, Item{GUID: istr, FeedId: feed.Id, Title: istr, Date: now.Add(time.Hour * time.Duration(i))})
+	}
+	db.CreateItems(items)
+	db.db.Exec(`update items set date_arrived = ?`, now.Add(-time.Hour*time.Duration(itemsKeepDays*24+1)))
+
+	label := db.CreateLabel("keep")
+	db.SetItemLabels(getItem(db, "0").Id, []int64{label.Id})
+	db.UpdateItemNote(getItem(db, "1").Id, "note")
+
+	db.DeleteOldItems()
+
+	have := len(db.ListItems(ItemFilter{FeedID: &feed.Id}, 1000, false, false))
+	if want := itemsKeepSize + 2; have != want {
+		t.Fatalf("invalid number of items kept\nwant: %d\nhave: %d", want, have)
+	}
+}
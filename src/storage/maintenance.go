@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"fmt"
+)
+
+// Runs the integrity and foreign key checks.
+// Returns the list of problems found (empty if none).
+func (s *Storage) Check() ([]string, error) {
+	problems := make([]string, 0)
+
+	rows, err := s.db.Query(`pragma integrity_check`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var result string
+		if err = rows.Scan(&result); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	rows.Close()
+
+	rows, err = s.db.Query(`pragma foreign_key_check`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table, parent string
+		var rowid *int64
+		var fkid int64
+		if err = rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			return nil, err
+		}
+		if rowid != nil {
+			problems = append(problems, fmt.Sprintf("%s row %d references missing %s", table, *rowid, parent))
+		} else {
+			problems = append(problems, fmt.Sprintf("%s references missing %s", table, parent))
+		}
+	}
+	return problems, rows.Err()
+}
+
+func (s *Storage) Vacuum() error {
+	_, err := s.db.Exec(`vacuum`)
+	return err
+}
+
+// Recreates the full-text search index from scratch.
+func (s *Storage) ReindexSearch() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		`drop table if exists search`,
+		`create virtual table search using fts4(title, description, content)`,
+		`update items set search_rowid = null`,
+	}
+	for _, query := range queries {
+		if _, err = tx.Exec(query); err != nil {
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	s.SyncSearch()
+	return nil
+}
+
+// Returns the size of the database file and the unused space in it.
+func (s *Storage) Size() (total, free int64, err error) {
+	err = s.db.QueryRow(`
+		select p.page_count * s.page_size, f.freelist_count * s.page_size
+		from pragma_page_count() p, pragma_page_size() s, pragma_freelist_count() f
+	`).Scan(&total, &free)
+	return
+}
+
+type TableStat struct {
+	Name string
+	Rows int64
+}
+
+type FeedSizeStat struct {
+	FeedId int64
+	Title  string
+	Items  int64
+	Bytes  int64
+}
+
+type ItemSizeStat struct {
+	ItemId    int64
+	FeedTitle string
+	Title     string
+	Bytes     int64
+}
+
+type DBStats struct {
+	FileSize     int64
+	FreeSize     int64
+	Tables       []TableStat
+	Feeds        []FeedSizeStat
+	LargestItems []ItemSizeStat
+}
+
+// Collects row counts, bytes per feed and the largest items
+// (see itemSizeExpr for how the size of an item is approximated).
+func (s *Storage) Stats(numItems int) (*DBStats, error) {
+	stats := &DBStats{}
+
+	var err error
+	stats.FileSize, stats.FreeSize, err = s.Size()
+	if err != nil {
+		return nil, err
+	}
+
+	// fts shadow tables are left out
+	rows, err := s.db.Query(`
+		select name from sqlite_master
+		where type = 'table' and name not like 'sqlite_%' and name not like 'search_%'
+		order by name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var table TableStat
+		if err = rows.Scan(&table.Name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		stats.Tables = append(stats.Tables, table)
+	}
+	rows.Close()
+	for i := range stats.Tables {
+		query := fmt.Sprintf(`select count(*) from "%s"`, stats.Tables[i].Name)
+		if err = s.db.QueryRow(query).Scan(&stats.Tables[i].Rows); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err = s.db.Query(fmt.Sprintf(`
+		select f.id, f.title, count(i.id), coalesce(sum(%s), 0) as size
+		from feeds f
+		left join items i on i.feed_id = f.id
+		group by f.id
+		order by size desc
+	`, itemSizeExpr))
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var feed FeedSizeStat
+		if err = rows.Scan(&feed.FeedId, &feed.Title, &feed.Items, &feed.Bytes); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		stats.Feeds = append(stats.Feeds, feed)
+	}
+	rows.Close()
+
+	rows, err = s.db.Query(fmt.Sprintf(`
+		select i.id, f.title, coalesce(i.title, ''), %s as size
+		from items i
+		join feeds f on f.id = i.feed_id
+		order by size desc
+		limit ?
+	`, itemSizeExpr), numItems)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item ItemSizeStat
+		if err = rows.Scan(&item.ItemId, &item.FeedTitle, &item.Title, &item.Bytes); err != nil {
+			return nil, err
+		}
+		stats.LargestItems = append(stats.LargestItems, item)
+	}
+	return stats, rows.Err()
+}
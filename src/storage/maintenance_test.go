@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReindexSearch(t *testing.T) {
+	db := testDB()
+	testItemsSetup(db)
+	db.SyncSearch()
+
+	db.db.Exec(`delete from search`)
+	if err := db.ReindexSearch(); err != nil {
+		t.Fatal(err)
+	}
+
+	search := "title111"
+	have := getItemGuids(db.ListItems(ItemFilter{Search: &search}, 10, false, false))
+	if want := []string{"item111"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("invalid search results\nwant: %#v\nhave: %#v", want, have)
+	}
+}
+
+func TestCheckAndStats(t *testing.T) {
+	db := testDB()
+	scope := testItemsSetup(db)
+
+	if problems, err := db.Check(); err != nil || len(problems) != 0 {
+		t.Fatalf("expected no problems, got %v (%v)", problems, err)
+	}
+
+	stats, err := db.Stats(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := make(map[string]int64)
+	for _, table := range stats.Tables {
+		rows[table.Name] = table.Rows
+	}
+	if rows["feeds"] != 4 || rows["items"] != 10 {
+		t.Errorf("invalid row counts: %v", rows)
+	}
+	if len(stats.Feeds) != 4 || stats.Feeds[0].Items != 3 || stats.Feeds[3].FeedId != scope.feed21.Id && stats.Feeds[3].FeedId != scope.feed12.Id {
+		t.Errorf("invalid feed stats: %#v", stats.Feeds)
+	}
+	if len(stats.LargestItems) != 3 {
+		t.Errorf("invalid largest items: %#v", stats.LargestItems)
+	}
+}
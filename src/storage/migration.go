@@ -3,7 +3,7 @@ package storage
 import (
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 )
 
@@ -18,10 +18,28 @@ var migrations = []func(*sql.Tx) error{
 	m08_normalize_datetime,
 	m09_change_item_index,
 	m10_add_item_medialinks,
+	m11_add_folder_parent,
+	m12_add_labels_and_notes,
+	m13_add_highlights,
+	m14_add_item_reading_time,
+	m15_add_feed_retention,
+	m16_add_users,
+	m17_add_sessions,
+	m18_add_api_tokens,
+	m19_add_totp,
+	m20_add_item_state_date,
+	m21_add_feed_sparks,
+	m22_add_user_configured,
 }
 
 var maxVersion = int64(len(migrations))
 
+// Returns the schema version of the database and the latest one known.
+func (s *Storage) SchemaVersion() (current, latest int64, err error) {
+	err = s.db.QueryRow("pragma user_version").Scan(&current)
+	return current, maxVersion, err
+}
+
 func migrate(db *sql.DB) error {
 	var version int64
 	if err := db.QueryRow("pragma user_version").Scan(&version); err != nil {
@@ -32,7 +50,7 @@ func migrate(db *sql.DB) error {
 		return nil
 	}
 
-	log.Printf("db version is %d. migrating to %d", version, maxVersion)
+	slog.Info("migrating database", "from", version, "to", maxVersion)
 
 	for v := version + 1; v <= maxVersion; v++ {
 		// Migrations altering schema using a sequence of steps due to SQLite limitations.
@@ -41,7 +59,7 @@ func migrate(db *sql.DB) error {
 		// https://www.sqlite.org/lang_altertable.html
 		trickyAlteration := (v == 3)
 
-		log.Printf("[migration:%d] starting", v)
+		slog.Debug("migration starting", "version", v)
 
 		if trickyAlteration {
 			db.Exec("pragma foreign_keys=off;")
@@ -57,7 +75,7 @@ func migrate(db *sql.DB) error {
 			return err
 		}
 
-		log.Printf("[migration:%d] done", v)
+		slog.Debug("migration done", "version", v)
 	}
 	return nil
 }
@@ -67,21 +85,21 @@ func migrateVersion(v int64, db *sql.DB) error {
 	var tx *sql.Tx
 	migratefunc := migrations[v-1]
 	if tx, err = db.Begin(); err != nil {
-		log.Printf("[migration:%d] failed to start transaction", v)
+		slog.Error("migration failed to start transaction", "version", v, "err", err)
 		return err
 	}
 	if err = migratefunc(tx); err != nil {
-		log.Printf("[migration:%d] failed to migrate", v)
+		slog.Error("migration failed to migrate", "version", v, "err", err)
 		tx.Rollback()
 		return err
 	}
 	if _, err = tx.Exec(fmt.Sprintf("pragma user_version = %d", v)); err != nil {
-		log.Printf("[migration:%d] failed to bump version", v)
+		slog.Error("migration failed to bump version", "version", v, "err", err)
 		tx.Rollback()
 		return err
 	}
 	if err = tx.Commit(); err != nil {
-		log.Printf("[migration:%d] failed to commit changes", v)
+		slog.Error("migration failed to commit changes", "version", v, "err", err)
 		return err
 	}
 	return nil
@@ -329,3 +347,258 @@ func m10_add_item_medialinks(tx *sql.Tx) error {
 	_, err := tx.Exec(sql)
 	return err
 }
+
+func m11_add_folder_parent(tx *sql.Tx) error {
+	sql := `
+		alter table folders add column parent_id references folders(id) on delete set null;
+		drop index if exists idx_folder_title;
+		create unique index if not exists idx_folder_parent_title on folders(coalesce(parent_id, 0), title);
+		create index if not exists idx_folder_parent_id on folders(parent_id);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m12_add_labels_and_notes(tx *sql.Tx) error {
+	sql := `
+		create table if not exists labels (
+		 id             integer primary key autoincrement,
+		 title          text not null
+		);
+
+		create unique index if not exists idx_label_title on labels(title);
+
+		create table if not exists item_labels (
+		 item_id        references items(id) on delete cascade,
+		 label_id       references labels(id) on delete cascade,
+		 primary key (item_id, label_id)
+		);
+
+		create index if not exists idx_item_label_label_id on item_labels(label_id);
+
+		create table if not exists item_notes (
+		 item_id        references items(id) on delete cascade unique,
+		 text           text not null,
+		 date_updated   datetime not null
+		);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m13_add_highlights(tx *sql.Tx) error {
+	sql := `
+		create table if not exists highlights (
+		 id             integer primary key autoincrement,
+		 item_id        references items(id) on delete cascade,
+		 text           text not null,
+		 prefix         text not null default '',
+		 suffix         text not null default '',
+		 comment        text not null default '',
+		 date_created   datetime not null
+		);
+
+		create index if not exists idx_highlight_item_id on highlights(item_id);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m14_add_item_reading_time(tx *sql.Tx) error {
+	sql := `
+		alter table items add column reading_time integer not null default 0;
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m15_add_feed_retention(tx *sql.Tx) error {
+	sql := `
+		create table if not exists feed_retention (
+		 feed_id        references feeds(id) on delete cascade unique,
+		 keep_days      integer,
+		 keep_size      integer,
+		 content_days   integer
+		);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m16_add_users(tx *sql.Tx) error {
+	sql := `
+		create table if not exists users (
+		 id             integer primary key autoincrement,
+		 username       text not null,
+		 password       text not null default '',
+		 fever_key      text not null default '',
+		 is_admin       boolean not null default false,
+		 disabled       boolean not null default false,
+		 date_created   datetime not null
+		);
+
+		create unique index if not exists idx_user_username on users(username);
+		create index if not exists idx_user_fever_key on users(fever_key);
+
+		-- owner of the existing data, claimed by the account set up with -auth
+		insert into users (id, username, is_admin, date_created)
+		values (1, 'admin', true, strftime('%Y-%m-%d %H:%M:%f', 'now'));
+
+		-- feeds are shared, the title & folder are up to each subscriber.
+		-- feeds.folder_id is superseded by subscriptions.folder_id
+		create table if not exists subscriptions (
+		 user_id        references users(id) on delete cascade,
+		 feed_id        references feeds(id) on delete cascade,
+		 folder_id      references folders(id) on delete set null,
+		 title          text not null,
+		 primary key (user_id, feed_id)
+		);
+
+		create index if not exists idx_subscription_feed_id on subscriptions(feed_id);
+		create index if not exists idx_subscription_folder_id on subscriptions(folder_id);
+
+		insert into subscriptions (user_id, feed_id, folder_id, title)
+		select 1, id, folder_id, title from feeds;
+		update feeds set folder_id = null;
+
+		-- items without a state row are unread
+		create table if not exists item_states (
+		 user_id        references users(id) on delete cascade,
+		 item_id        references items(id) on delete cascade,
+		 status         integer not null,
+		 primary key (user_id, item_id)
+		);
+
+		create index if not exists idx_item_state_item_id on item_states(item_id);
+
+		insert into item_states (user_id, item_id, status)
+		select 1, id, status from items where status != 0;
+		drop index if exists idx_item__date_id_status;
+		alter table items drop column status;
+		create index if not exists idx_item_date_id on items(date, id);
+
+		-- saved articles are kept in a pseudo-feed per user
+		update feeds set feed_link = 'readn:saved:1' where feed_link = 'readn:saved';
+
+		alter table folders add column user_id integer not null default 1;
+		drop index if exists idx_folder_parent_title;
+		create unique index if not exists idx_folder_user_parent_title on folders(user_id, coalesce(parent_id, 0), title);
+
+		alter table labels add column user_id integer not null default 1;
+		drop index if exists idx_label_title;
+		create unique index if not exists idx_label_user_title on labels(user_id, title);
+
+		alter table highlights add column user_id integer not null default 1;
+
+		create table if not exists new_item_notes (
+		 user_id        integer not null,
+		 item_id        references items(id) on delete cascade,
+		 text           text not null,
+		 date_updated   datetime not null,
+		 primary key (user_id, item_id)
+		);
+		insert into new_item_notes (user_id, item_id, text, date_updated)
+		select 1, item_id, text, date_updated from item_notes;
+		drop table item_notes;
+		alter table new_item_notes rename to item_notes;
+		create index if not exists idx_item_note_item_id on item_notes(item_id);
+
+		-- notes are searched per user, not through the shared index
+		update search set description = '';
+
+		-- instance-wide settings stay in the settings table
+		create table if not exists user_settings (
+		 user_id        references users(id) on delete cascade,
+		 key            string not null,
+		 val            blob,
+		 primary key (user_id, key)
+		);
+
+		insert into user_settings (user_id, key, val)
+		select 1, key, val from settings
+		where key not in ('refresh_rate', 'retention_keep_days', 'retention_keep_size', 'retention_content_days');
+		delete from settings
+		where key not in ('refresh_rate', 'retention_keep_days', 'retention_keep_size', 'retention_content_days');
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m17_add_sessions(tx *sql.Tx) error {
+	sql := `
+		create table if not exists sessions (
+		 id             integer primary key autoincrement,
+		 user_id        integer not null references users(id) on delete cascade,
+		 token          text not null unique,
+		 user_agent     text not null default '',
+		 date_created   datetime not null,
+		 last_seen      datetime not null,
+		 expires        datetime not null
+		);
+
+		create index if not exists idx_session_user_id on sessions(user_id);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m18_add_api_tokens(tx *sql.Tx) error {
+	sql := `
+		create table if not exists api_tokens (
+		 id             integer primary key autoincrement,
+		 user_id        integer not null references users(id) on delete cascade,
+		 name           text not null,
+		 token          text not null unique,
+		 scope          text not null,
+		 date_created   datetime not null,
+		 last_used      datetime
+		);
+
+		create index if not exists idx_api_token_user_id on api_tokens(user_id);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m19_add_totp(tx *sql.Tx) error {
+	sql := `
+		alter table users add column totp_secret text not null default '';
+		alter table users add column totp_pending text not null default '';
+		alter table users add column totp_last_step integer not null default 0;
+
+		create table if not exists recovery_codes (
+		 user_id        integer not null references users(id) on delete cascade,
+		 code           text not null,
+		 primary key (user_id, code)
+		);
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m20_add_item_state_date(tx *sql.Tx) error {
+	// null for the states changed before, when the item arrived is used instead
+	sql := `
+		alter table item_states add column date_updated datetime;
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m21_add_feed_sparks(tx *sql.Tx) error {
+	sql := `
+		alter table subscriptions add column is_spark boolean not null default false;
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
+
+func m22_add_user_configured(tx *sql.Tx) error {
+	// the account of the server credentials, so far always the first one
+	sql := `
+		alter table users add column is_configured boolean not null default false;
+		update users set is_configured = true where id = 1 and password != '';
+	`
+	_, err := tx.Exec(sql)
+	return err
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"log/slog"
+	"time"
+)
+
+type ItemNote struct {
+	ItemId      int64     `json:"item_id"`
+	Text        string    `json:"text"`
+	DateUpdated time.Time `json:"date_updated"`
+}
+
+func (s *Storage) GetItemNote(itemId int64) *ItemNote {
+	note := &ItemNote{}
+	err := s.db.QueryRow(`
+		select item_id, text, date_updated
+		from item_notes
+		where user_id = ? and item_id = ?
+	`, s.userId, itemId).Scan(&note.ItemId, &note.Text, &note.DateUpdated)
+	if err != nil {
+		return nil
+	}
+	return note
+}
+
+// Saves the markdown note of the item. An empty text removes the note.
+// The note is also matched by the item search of its author.
+func (s *Storage) UpdateItemNote(itemId int64, text string) bool {
+	var err error
+	if text == "" {
+		_, err = s.db.Exec(`delete from item_notes where user_id = ? and item_id = ?`, s.userId, itemId)
+	} else {
+		_, err = s.db.Exec(`
+			insert into item_notes (user_id, item_id, text, date_updated)
+			values (?, ?, ?, ?)
+			on conflict (user_id, item_id) do update set text = excluded.text, date_updated = excluded.date_updated`,
+			s.userId, itemId, text, time.Now().UTC(),
+		)
+	}
+	if err != nil {
+		slog.Error("database error", "err", err)
+	}
+	return err == nil
+}
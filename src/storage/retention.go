@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// Per-feed overrides of the global retention settings.
+// Nil fields fall back to the global settings.
+type RetentionPolicy struct {
+	KeepDays    *int `json:"keep_days"`
+	KeepSize    *int `json:"keep_size"`
+	ContentDays *int `json:"content_days"`
+}
+
+type retentionRules struct {
+	// Keep items for this many days (0: keep forever).
+	keepDays int
+	// Keep at least this many items per feed.
+	keepSize int
+	// Drop the content of items older than this many days (0: never).
+	contentDays int
+}
+
+func (s *Storage) globalRetentionRules() retentionRules {
+	return retentionRules{
+		keepDays:    int(s.GetSettingsValueInt64("retention_keep_days")),
+		keepSize:    int(s.GetSettingsValueInt64("retention_keep_size")),
+		contentDays: int(s.GetSettingsValueInt64("retention_content_days")),
+	}
+}
+
+func (r retentionRules) override(p RetentionPolicy) retentionRules {
+	if p.KeepDays != nil {
+		r.keepDays = *p.KeepDays
+	}
+	if p.KeepSize != nil {
+		r.keepSize = *p.KeepSize
+	}
+	if p.ContentDays != nil {
+		r.contentDays = *p.ContentDays
+	}
+	return r
+}
+
+func daysAgo(days int) time.Time {
+	return time.Now().UTC().Add(-time.Hour * time.Duration(24*days))
+}
+
+// Selects the ids of the feed's items to be deleted.
+// Args: feed id, number of items to keep, arrival cutoff.
+var expiredItemsQuery = fmt.Sprintf(`
+	select id from items
+	where id in (
+		select i.id
+		from items i
+		where i.feed_id = ? and %s
+		order by date desc
+		limit -1 offset ?
+	) and date_arrived < ?`,
+	itemIsDisposable,
+)
+
+// Selects the ids of the feed's items to have their content dropped.
+// Args: feed id, arrival cutoff.
+var staleContentQuery = fmt.Sprintf(`
+	select i.id
+	from items i
+	where i.feed_id = ? and %s and coalesce(i.content, '') != '' and i.date_arrived < ?`,
+	itemIsDisposable,
+)
+
+// Approximate number of bytes an item occupies in the database.
+const itemSizeExpr = `
+	coalesce(length(cast(i.title as blob)), 0) +
+	coalesce(length(cast(i.link as blob)), 0) +
+	coalesce(length(cast(i.content as blob)), 0) +
+	coalesce(length(cast(i.media_links as blob)), 0)`
+
+func (s *Storage) GetFeedRetention(feedId int64) RetentionPolicy {
+	var p RetentionPolicy
+	err := s.db.QueryRow(`
+		select keep_days, keep_size, content_days
+		from feed_retention
+		where feed_id = ?
+	`, feedId).Scan(&p.KeepDays, &p.KeepSize, &p.ContentDays)
+	if err != nil && err != sql.ErrNoRows {
+		slog.Error("database error", "err", err)
+	}
+	return p
+}
+
+func (s *Storage) SetFeedRetention(feedId int64, p RetentionPolicy) bool {
+	var err error
+	if p.KeepDays == nil && p.KeepSize == nil && p.ContentDays == nil {
+		_, err = s.db.Exec(`delete from feed_retention where feed_id = ?`, feedId)
+	} else {
+		_, err = s.db.Exec(`
+			insert into feed_retention (feed_id, keep_days, keep_size, content_days)
+			values (?, ?, ?, ?)
+			on conflict (feed_id) do update set
+				keep_days = excluded.keep_days,
+				keep_size = excluded.keep_size,
+				content_days = excluded.content_days`,
+			feedId, p.KeepDays, p.KeepSize, p.ContentDays,
+		)
+	}
+	if err != nil {
+		slog.Error("database error", "err", err)
+	}
+	return err == nil
+}
+
+// Effective retention rules and feed sizes of the feeds having disposable items.
+func (s *Storage) feedRetentionRules() (map[int64]retentionRules, map[int64]int, error) {
+	global := s.globalRetentionRules()
+
+	rows, err := s.db.Query(fmt.Sprintf(`
+		select
+			i.feed_id,
+			coalesce(s.size, 0),
+			r.keep_days,
+			r.keep_size,
+			r.content_days
+		from items i
+		left outer join feed_sizes s on s.feed_id = i.feed_id
+		left outer join feed_retention r on r.feed_id = i.feed_id
+		where %s
+		group by i.feed_id
+	`, itemIsDisposable))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	rules := make(map[int64]retentionRules)
+	sizes := make(map[int64]int)
+	for rows.Next() {
+		var feedId int64
+		var size int
+		var p RetentionPolicy
+		if err = rows.Scan(&feedId, &size, &p.KeepDays, &p.KeepSize, &p.ContentDays); err != nil {
+			return nil, nil, err
+		}
+		rules[feedId] = global.override(p)
+		sizes[feedId] = size
+	}
+	return rules, sizes, rows.Err()
+}
+
+type RetentionStat struct {
+	FeedId       int64 `json:"feed_id"`
+	Items        int64 `json:"items"`
+	Bytes        int64 `json:"bytes"`
+	ContentItems int64 `json:"content_items"`
+	ContentBytes int64 `json:"content_bytes"`
+}
+
+// Reports what the next cleanup would remove from each feed
+// without changing anything. Feeds losing nothing are omitted.
+func (s *Storage) RetentionReport() []RetentionStat {
+	result := make([]RetentionStat, 0)
+	feedRules, feedSizes, err := s.feedRetentionRules()
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return result
+	}
+	for feedId, rules := range feedRules {
+		stat := RetentionStat{FeedId: feedId}
+		expiredQuery, expiredArgs := "select null where 0", []interface{}{}
+		if rules.keepDays > 0 {
+			expiredQuery = expiredItemsQuery
+			expiredArgs = []interface{}{feedId, max(feedSizes[feedId], rules.keepSize), daysAgo(rules.keepDays)}
+			err = s.db.QueryRow(fmt.Sprintf(`
+				select count(*), coalesce(sum(%s), 0)
+				from items i where i.id in (%s)
+			`, itemSizeExpr, expiredQuery), expiredArgs...).Scan(&stat.Items, &stat.Bytes)
+			if err != nil {
+				slog.Error("database error", "err", err)
+				return result
+			}
+		}
+		if rules.contentDays > 0 {
+			args := append([]interface{}{feedId, daysAgo(rules.contentDays)}, expiredArgs...)
+			err = s.db.QueryRow(fmt.Sprintf(`
+				select count(*), coalesce(sum(length(cast(content as blob))), 0)
+				from items where id in (%s) and id not in (%s)
+			`, staleContentQuery, expiredQuery), args...).Scan(&stat.ContentItems, &stat.ContentBytes)
+			if err != nil {
+				slog.Error("database error", "err", err)
+				return result
+			}
+		}
+		if stat.Items > 0 || stat.ContentItems > 0 {
+			result = append(result, stat)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].FeedId < result[j].FeedId })
+	return result
+}
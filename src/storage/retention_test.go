@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func retentionSetup(db *Storage, numItems int, arrived time.Time) *Feed {
+	feed := db.CreateFeed("feed", "", "", "http://test.com/feed.xml", nil)
+	items := make([]Item, 0)
+	for i := 0; i < numItems; i++ {
+		istr := strconv.Itoa(i)
+		items = append(items, Item{GUID: istr, FeedId: feed.Id, Title: istr, Content: "content", Date: arrived.Add(time.Hour * time.Duration(i))})
+	}
+	db.CreateItems(items)
+	db.db.Exec(`update items set date_arrived = ?`, arrived)
+	return feed
+}
+
+func TestFeedRetention(t *testing.T) {
+	db := testDB()
+	feed := db.CreateFeed("feed", "", "", "http://test.com/feed.xml", nil)
+
+	if have := db.GetFeedRetention(feed.Id); !reflect.DeepEqual(have, RetentionPolicy{}) {
+		t.Fatalf("expected empty policy, got %#v", have)
+	}
+
+	days := 7
+	db.SetFeedRetention(feed.Id, RetentionPolicy{KeepDays: &days})
+	have := db.GetFeedRetention(feed.Id)
+	if have.KeepDays == nil || *have.KeepDays != 7 || have.KeepSize != nil || have.ContentDays != nil {
+		t.Fatalf("invalid policy: %#v", have)
+	}
+
+	db.SetFeedRetention(feed.Id, RetentionPolicy{})
+	if have := db.GetFeedRetention(feed.Id); !reflect.DeepEqual(have, RetentionPolicy{}) {
+		t.Fatalf("expected policy to be reset, got %#v", have)
+	}
+}
+
+func TestDeleteOldItemsFeedPolicy(t *testing.T) {
+	db := testDB()
+	arrived := time.Now().UTC().Add(-time.Hour * 24 * 10)
+	feed := retentionSetup(db, 5, arrived)
+	db.UpdateSettings(map[string]interface{}{"retention_keep_size": 2})
+
+	// the global policy keeps 10-day old items
+	if report := db.RetentionReport(); len(report) != 0 {
+		t.Fatalf("expected nothing to be cleaned up, got %#v", report)
+	}
+
+	// archival feed
+	forever := 0
+	db.SetFeedRetention(feed.Id, RetentionPolicy{KeepDays: &forever})
+	db.UpdateSettings(map[string]interface{}{"retention_keep_days": 1})
+	if report := db.RetentionReport(); len(report) != 0 {
+		t.Fatalf("expected nothing to be cleaned up, got %#v", report)
+	}
+
+	// firehose feed
+	week := 7
+	db.SetFeedRetention(feed.Id, RetentionPolicy{KeepDays: &week})
+	report := db.RetentionReport()
+	if len(report) != 1 || report[0].FeedId != feed.Id || report[0].Items != 3 || report[0].Bytes == 0 {
+		t.Fatalf("invalid report: %#v", report)
+	}
+
+	db.DeleteOldItems()
+	have := getItemGuids(db.ListItems(ItemFilter{FeedID: &feed.Id}, 10, false, false))
+	if want := []string{"3", "4"}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("invalid items kept\nwant: %#v\nhave: %#v", want, have)
+	}
+}
+
+func TestDeleteOldItemsDropContent(t *testing.T) {
+	db := testDB()
+	arrived := time.Now().UTC().Add(-time.Hour * 24 * 10)
+	feed := retentionSetup(db, 3, arrived)
+	db.CreateItems([]Item{{GUID: "new", FeedId: feed.Id, Title: "new", Content: "content", Date: time.Now()}})
+	db.SyncSearch()
+	db.UpdateSettings(map[string]interface{}{"retention_content_days": 5})
+
+	report := db.RetentionReport()
+	if len(report) != 1 || report[0].Items != 0 || report[0].ContentItems != 3 || report[0].ContentBytes != 3*7 {
+		t.Fatalf("invalid report: %#v", report)
+	}
+
+	db.DeleteOldItems()
+	if have := db.CountItems(ItemFilter{FeedID: &feed.Id}); have != 4 {
+		t.Fatalf("expected items to be kept, have %d", have)
+	}
+	if item := db.GetItem(getItem(db, "0").Id); item.Content != "" {
+		t.Errorf("expected content to be dropped, got %q", item.Content)
+	}
+	if item := db.GetItem(getItem(db, "new").Id); item.Content != "content" {
+		t.Errorf("expected content to be kept, got %q", item.Content)
+	}
+
+	search := "content"
+	have := getItemGuids(db.ListItems(ItemFilter{Search: &search}, 10, false, false))
+	if want := []string{"new"}; !reflect.DeepEqual(have, want) {
+		t.Errorf("invalid search results\nwant: %#v\nhave: %#v", want, have)
+	}
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+// Login session. Only the hash of the session token is stored.
+type Session struct {
+	Id          int64     `json:"id"`
+	UserId      int64     `json:"-"`
+	UserAgent   string    `json:"user_agent"`
+	DateCreated time.Time `json:"date_created"`
+	LastSeen    time.Time `json:"last_seen"`
+	Expires     time.Time `json:"expires"`
+}
+
+const sessionColumns = `id, user_id, user_agent, date_created, last_seen, expires`
+
+func scanSession(row interface{ Scan(...any) error }) (*Session, error) {
+	x := &Session{}
+	err := row.Scan(&x.Id, &x.UserId, &x.UserAgent, &x.DateCreated, &x.LastSeen, &x.Expires)
+	if err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+func (s *Storage) CreateSession(userId int64, token, userAgent string, expires time.Time) *Session {
+	now := time.Now().UTC()
+	row := s.db.QueryRow(`
+		insert into sessions (user_id, token, user_agent, date_created, last_seen, expires)
+		values (?, ?, ?, ?, ?, ?)
+		returning `+sessionColumns,
+		userId, token, userAgent, now, now, expires.UTC(),
+	)
+	x, err := scanSession(row)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return nil
+	}
+	return x
+}
+
+// Returns nil if the session does not exist or has expired.
+func (s *Storage) GetSession(token string) *Session {
+	row := s.db.QueryRow(`
+		select `+sessionColumns+` from sessions
+		where token = ? and expires > ?`,
+		token, time.Now().UTC(),
+	)
+	x, err := scanSession(row)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Error("database error", "err", err)
+		}
+		return nil
+	}
+	return x
+}
+
+func (s *Storage) ListSessions(userId int64) []Session {
+	result := make([]Session, 0)
+	rows, err := s.db.Query(`
+		select `+sessionColumns+` from sessions
+		where user_id = ? and expires > ?
+		order by last_seen desc`,
+		userId, time.Now().UTC(),
+	)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return result
+	}
+	defer rows.Close()
+	for rows.Next() {
+		x, err := scanSession(rows)
+		if err != nil {
+			slog.Error("database error", "err", err)
+			return result
+		}
+		result = append(result, *x)
+	}
+	return result
+}
+
+// Records the activity on the session and extends its expiry.
+func (s *Storage) TouchSession(id int64, expires time.Time) bool {
+	_, err := s.db.Exec(
+		`update sessions set last_seen = ?, expires = ? where id = ?`,
+		time.Now().UTC(), expires.UTC(), id,
+	)
+	if err != nil {
+		slog.Error("database error", "err", err)
+	}
+	return err == nil
+}
+
+// Reports whether the session of the user existed.
+func (s *Storage) DeleteSession(userId, id int64) bool {
+	result, err := s.db.Exec(`delete from sessions where user_id = ? and id = ?`, userId, id)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return false
+	}
+	num, err := result.RowsAffected()
+	return err == nil && num > 0
+}
+
+// Deletes all the sessions of the user except the given one (if any)
+// and returns the number of sessions deleted.
+func (s *Storage) DeleteSessions(userId, exceptId int64) int64 {
+	result, err := s.db.Exec(`delete from sessions where user_id = ? and id != ?`, userId, exceptId)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return 0
+	}
+	num, _ := result.RowsAffected()
+	return num
+}
+
+func (s *Storage) DeleteExpiredSessions() int64 {
+	result, err := s.db.Exec(`delete from sessions where expires <= ?`, time.Now().UTC())
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return 0
+	}
+	num, _ := result.RowsAffected()
+	return num
+}
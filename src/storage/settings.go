@@ -1,8 +1,11 @@
 package storage
 
 import (
+	"database/sql"
 	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
+	"sort"
 )
 
 func settingsDefaults() map[string]interface{} {
@@ -27,22 +30,52 @@ func settingsDefaults() map[string]interface{} {
 		"ai_enable_feed_summary": true,
 		"ai_enable_chat": true,
 		"ai_enable_text_actions": true,
+		"retention_keep_days":    itemsKeepDays,
+		"retention_keep_size":    itemsKeepSize,
+		"retention_content_days": 0,
 	}
 }
 
+// Settings of the whole instance rather than of a single user.
+var globalSettings = map[string]bool{
+	"refresh_rate":           true,
+	"retention_keep_days":    true,
+	"retention_keep_size":    true,
+	"retention_content_days": true,
+}
+
+func IsGlobalSetting(key string) bool {
+	return globalSettings[key]
+}
+
+// The users keep their own values of the settings which are neither
+// global nor locked. The values stored in the settings table (e.g. seeded
+// by the config file) serve as the defaults for them.
+func (s *Storage) isUserSetting(key string) bool {
+	s.lockedMu.RLock()
+	defer s.lockedMu.RUnlock()
+	return !globalSettings[key] && !s.locked[key]
+}
+
 func (s *Storage) GetSettingsValue(key string) interface{} {
-	row := s.db.QueryRow(`select val from settings where key=?`, key)
-	if row == nil {
+	var val []byte
+	err := sql.ErrNoRows
+	if s.isUserSetting(key) {
+		row := s.db.QueryRow(`select val from user_settings where user_id = ? and key = ?`, s.userId, key)
+		err = row.Scan(&val)
+	}
+	if err == sql.ErrNoRows {
+		err = s.db.QueryRow(`select val from settings where key=?`, key).Scan(&val)
+	}
+	if err == sql.ErrNoRows {
 		return settingsDefaults()[key]
 	}
-	var val []byte
-	row.Scan(&val)
 	if len(val) == 0 {
 		return nil
 	}
 	var valDecoded interface{}
 	if err := json.Unmarshal([]byte(val), &valDecoded); err != nil {
-		log.Print(err)
+		slog.Error("database error", "err", err)
 		return nil
 	}
 	return valDecoded
@@ -51,8 +84,11 @@ func (s *Storage) GetSettingsValue(key string) interface{} {
 func (s *Storage) GetSettingsValueInt64(key string) int64 {
 	val := s.GetSettingsValue(key)
 	if val != nil {
-		if fval, ok := val.(float64); ok {
-			return int64(fval)
+		switch num := val.(type) {
+		case float64:
+			return int64(num)
+		case int:
+			return int64(num)
 		}
 	}
 	return 0
@@ -60,50 +96,163 @@ func (s *Storage) GetSettingsValueInt64(key string) int64 {
 
 func (s *Storage) GetSettings() map[string]interface{} {
 	result := settingsDefaults()
-	rows, err := s.db.Query(`select key, val from settings;`)
+	s.readSettings(result, `select key, val from settings;`)
+	s.readSettings(result, `select key, val from user_settings where user_id = ?`, s.userId)
+	return result
+}
+
+func (s *Storage) readSettings(result map[string]interface{}, query string, args ...interface{}) {
+	userValues := len(args) > 0
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
-		log.Print(err)
-		return result
+		slog.Error("database error", "err", err)
+		return
 	}
+	defer rows.Close()
 	for rows.Next() {
 		var key string
 		var val []byte
 		var valDecoded interface{}
-
 		rows.Scan(&key, &val)
+		if userValues && !s.isUserSetting(key) {
+			continue
+		}
 		if err = json.Unmarshal([]byte(val), &valDecoded); err != nil {
-			log.Print(err)
+			slog.Error("database error", "err", err)
 			continue
 		}
 		result[key] = valDecoded
 	}
-	return result
 }
 
+// Global settings are updated for the whole instance,
+// the rest only for the user.
 func (s *Storage) UpdateSettings(kv map[string]interface{}) bool {
 	defaults := settingsDefaults()
 	for key, val := range kv {
-		if _, exists := defaults[key]; !exists {
+		if _, exists := defaults[key]; !exists || s.isLocked(key) {
 			continue
 		}
-		valEncoded, err := json.Marshal(val)
-		if err != nil {
-			log.Print(err)
+		ok := false
+		if globalSettings[key] {
+			ok = s.storeSetting(key, val, true)
+		} else {
+			ok = s.storeUserSetting(key, val)
+		}
+		if !ok {
 			return false
 		}
+	}
+	return true
+}
+
+func (s *Storage) isLocked(key string) bool {
+	s.lockedMu.RLock()
+	defer s.lockedMu.RUnlock()
+	return s.locked[key]
+}
+
+func (s *Storage) storeSetting(key string, val interface{}, overwrite bool) bool {
+	valEncoded, err := json.Marshal(val)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return false
+	}
+	if overwrite {
 		_, err = s.db.Exec(`
 			insert into settings (key, val) values (?, ?)
 			on conflict (key) do update set val=?`,
 			key, valEncoded, valEncoded,
 		)
-		if err != nil {
-			log.Print(err)
-			return false
-		}
+	} else {
+		_, err = s.db.Exec(`
+			insert into settings (key, val) values (?, ?)
+			on conflict (key) do nothing`,
+			key, valEncoded,
+		)
+	}
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return false
+	}
+	return true
+}
+
+func (s *Storage) storeUserSetting(key string, val interface{}) bool {
+	valEncoded, err := json.Marshal(val)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return false
+	}
+	_, err = s.db.Exec(`
+		insert into user_settings (user_id, key, val) values (?, ?, ?)
+		on conflict (user_id, key) do update set val = excluded.val`,
+		s.userId, key, valEncoded,
+	)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return false
 	}
 	return true
 }
 
+func checkSettingsKeys(kv map[string]interface{}) error {
+	defaults := settingsDefaults()
+	for key := range kv {
+		if _, exists := defaults[key]; !exists {
+			return fmt.Errorf("unknown setting %s", key)
+		}
+	}
+	return nil
+}
+
+// Stores the values of the settings which haven't been set yet.
+// For the per-user settings these become the defaults of the users.
+func (s *Storage) SeedSettings(kv map[string]interface{}) error {
+	if err := checkSettingsKeys(kv); err != nil {
+		return err
+	}
+	for key, val := range kv {
+		if !s.storeSetting(key, val, false) {
+			return fmt.Errorf("failed to store setting %s", key)
+		}
+	}
+	return nil
+}
+
+// Stores the values and makes the settings read-only:
+// UpdateSettings leaves them as they are, and the locked values
+// take precedence over those of the users.
+// Replaces the settings locked previously.
+func (s *Storage) LockSettings(kv map[string]interface{}) error {
+	if err := checkSettingsKeys(kv); err != nil {
+		return err
+	}
+	s.lockedMu.Lock()
+	defer s.lockedMu.Unlock()
+
+	clear(s.locked)
+	for key, val := range kv {
+		if !s.storeSetting(key, val, true) {
+			return fmt.Errorf("failed to store setting %s", key)
+		}
+		s.locked[key] = true
+	}
+	return nil
+}
+
+func (s *Storage) LockedSettings() []string {
+	s.lockedMu.RLock()
+	defer s.lockedMu.RUnlock()
+
+	result := make([]string, 0, len(s.locked))
+	for key := range s.locked {
+		result = append(result, key)
+	}
+	sort.Strings(result)
+	return result
+}
+
 func (s *Storage) GetAIAPIKey() string {
 	val := s.GetSettingsValue("ai_api_key")
 	if val != nil {
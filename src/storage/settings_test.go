@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSeedAndLockSettings(t *testing.T) {
+	db := testDB()
+	db.UpdateSettings(map[string]interface{}{"theme_name": "night"})
+
+	err := db.SeedSettings(map[string]interface{}{"theme_name": "sepia", "refresh_rate": 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if have := db.GetSettingsValue("theme_name"); have != "night" {
+		t.Errorf("expected user value to be kept, got %v", have)
+	}
+	if have := db.GetSettingsValueInt64("refresh_rate"); have != 30 {
+		t.Errorf("expected seeded value, got %v", have)
+	}
+
+	if err := db.LockSettings(map[string]interface{}{"refresh_rate": 60}); err != nil {
+		t.Fatal(err)
+	}
+	db.UpdateSettings(map[string]interface{}{"refresh_rate": 10, "theme_name": "light"})
+	if have := db.GetSettingsValueInt64("refresh_rate"); have != 60 {
+		t.Errorf("expected locked value, got %v", have)
+	}
+	if have := db.GetSettingsValue("theme_name"); have != "light" {
+		t.Errorf("expected unlocked setting to be updated, got %v", have)
+	}
+	if have := db.LockedSettings(); !reflect.DeepEqual(have, []string{"refresh_rate"}) {
+		t.Errorf("invalid locked settings: %v", have)
+	}
+
+	if err := db.LockSettings(map[string]interface{}{"no_such_setting": 1}); err == nil {
+		t.Error("expected unknown setting to be rejected")
+	}
+}
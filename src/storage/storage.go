@@ -1,21 +1,36 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"log/slog"
 	"strings"
+	"sync"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// The user owning the data of single-user installs
+// and of the databases created before multi-user support.
+const DefaultUserId = 1
+
+// Feeds & items are shared by all the users, while subscriptions, folders,
+// item statuses, labels, notes, highlights & settings are kept per user.
+// The user-specific methods access the data of the user the storage
+// is bound to (see ForUser).
 type Storage struct {
-	db *sql.DB
+	db     *sql.DB
+	userId int64
+
+	// settings managed by the config file
+	locked   map[string]bool
+	lockedMu *sync.RWMutex
 }
 
 func New(path string) (*Storage, error) {
 	if pos := strings.IndexRune(path, '?'); pos == -1 {
 		params := "_journal=WAL&_sync=NORMAL&_busy_timeout=5000&cache=shared"
-		log.Printf("opening db with params: %s", params)
+		slog.Debug("opening database", "params", params)
 		path = path + "?" + params
 	}
 
@@ -27,5 +42,30 @@ func New(path string) (*Storage, error) {
 	if err = migrate(db); err != nil {
 		return nil, err
 	}
-	return &Storage{db: db}, nil
+	return &Storage{
+		db:       db,
+		userId:   DefaultUserId,
+		locked:   make(map[string]bool),
+		lockedMu: &sync.RWMutex{},
+	}, nil
+}
+
+// Returns the storage accessing the data of the given user.
+// It shares the database connection with the original one.
+func (s *Storage) ForUser(userId int64) *Storage {
+	scoped := *s
+	scoped.userId = userId
+	return &scoped
+}
+
+func (s *Storage) UserId() int64 {
+	return s.userId
+}
+
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
 }
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"database/sql"
+	"log/slog"
+	"time"
+	"unicode/utf8"
+)
+
+// Token for the scripts & third-party clients. Only its hash is stored.
+type APIToken struct {
+	Id          int64      `json:"id"`
+	UserId      int64      `json:"-"`
+	Name        string     `json:"name"`
+	Scope       string     `json:"scope"`
+	DateCreated time.Time  `json:"date_created"`
+	LastUsed    *time.Time `json:"last_used"`
+}
+
+const apiTokenColumns = `id, user_id, name, scope, date_created, last_used`
+
+func scanAPIToken(row interface{ Scan(...any) error }) (*APIToken, error) {
+	x := &APIToken{}
+	err := row.Scan(&x.Id, &x.UserId, &x.Name, &x.Scope, &x.DateCreated, &x.LastUsed)
+	if err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+func (s *Storage) CreateAPIToken(userId int64, name, token, scope string) *APIToken {
+	row := s.db.QueryRow(`
+		insert into api_tokens (user_id, name, token, scope, date_created)
+		values (?, ?, ?, ?, ?)
+		returning `+apiTokenColumns,
+		userId, name, token, scope, time.Now().UTC(),
+	)
+	x, err := scanAPIToken(row)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return nil
+	}
+	return x
+}
+
+func (s *Storage) GetAPIToken(token string) *APIToken {
+	row := s.db.QueryRow(`select `+apiTokenColumns+` from api_tokens where token = ?`, token)
+	x, err := scanAPIToken(row)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Error("database error", "err", err)
+		}
+		return nil
+	}
+	return x
+}
+
+func (s *Storage) ListAPITokens(userId int64) []APIToken {
+	result := make([]APIToken, 0)
+	rows, err := s.db.Query(`
+		select `+apiTokenColumns+` from api_tokens
+		where user_id = ?
+		order by id`,
+		userId,
+	)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return result
+	}
+	defer rows.Close()
+	for rows.Next() {
+		x, err := scanAPIToken(rows)
+		if err != nil {
+			slog.Error("database error", "err", err)
+			return result
+		}
+		result = append(result, *x)
+	}
+	return result
+}
+
+func (s *Storage) TouchAPIToken(id int64) bool {
+	_, err := s.db.Exec(`update api_tokens set last_used = ? where id = ?`, time.Now().UTC(), id)
+	if err != nil {
+		slog.Error("database error", "err", err)
+	}
+	return err == nil
+}
+
+// Reports whether the token of the user existed.
+func (s *Storage) DeleteAPIToken(userId, id int64) bool {
+	result, err := s.db.Exec(`delete from api_tokens where user_id = ? and id = ?`, userId, id)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return false
+	}
+	num, err := result.RowsAffected()
+	return err == nil && num > 0
+}
+
+// Deletes the user's tokens whose names start with the prefix
+// and which haven't been used (or created, if never used) since then.
+func (s *Storage) DeleteStaleAPITokens(userId int64, prefix string, since time.Time) bool {
+	_, err := s.db.Exec(`
+		delete from api_tokens
+		where user_id = ? and substr(name, 1, ?) = ? and coalesce(last_used, date_created) < ?`,
+		userId, utf8.RuneCountInString(prefix), prefix, since.UTC(),
+	)
+	if err != nil {
+		slog.Error("database error", "err", err)
+	}
+	return err == nil
+}
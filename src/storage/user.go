@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+type User struct {
+	Id          int64     `json:"id"`
+	Username    string    `json:"username"`
+	IsAdmin     bool      `json:"is_admin"`
+	Disabled    bool      `json:"disabled"`
+	DateCreated time.Time `json:"date_created"`
+
+	// hashed by the caller, empty if the user cannot log in
+	Password string `json:"-"`
+	// md5 of `username:password` the Fever clients authenticate with
+	FeverKey string `json:"-"`
+
+	// base32 secret of the second login factor, empty if not set up
+	TOTPSecret  string `json:"-"`
+	TOTPEnabled bool   `json:"totp_enabled"`
+	// secret waiting for the first code to be confirmed
+	TOTPPending string `json:"-"`
+}
+
+const userColumns = `id, username, is_admin, disabled, date_created, password, fever_key, totp_secret, totp_pending`
+
+func scanUser(row interface{ Scan(...any) error }) (*User, error) {
+	u := &User{}
+	err := row.Scan(
+		&u.Id, &u.Username, &u.IsAdmin, &u.Disabled, &u.DateCreated,
+		&u.Password, &u.FeverKey, &u.TOTPSecret, &u.TOTPPending,
+	)
+	if err != nil {
+		return nil, err
+	}
+	u.TOTPEnabled = u.TOTPSecret != ""
+	return u, nil
+}
+
+// Returns nil if the username is already taken.
+func (s *Storage) CreateUser(username, password string, isAdmin bool) *User {
+	row := s.db.QueryRow(`
+		insert into users (username, password, is_admin, date_created)
+		values (?, ?, ?, ?)
+		on conflict (username) do nothing
+		returning `+userColumns,
+		username, password, isAdmin, time.Now().UTC(),
+	)
+	u, err := scanUser(row)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Error("database error", "err", err)
+		}
+		return nil
+	}
+	return u
+}
+
+func (s *Storage) GetUser(id int64) *User {
+	u, err := scanUser(s.db.QueryRow(`select `+userColumns+` from users where id = ?`, id))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Error("database error", "err", err)
+		}
+		return nil
+	}
+	return u
+}
+
+func (s *Storage) GetUserByName(username string) *User {
+	u, err := scanUser(s.db.QueryRow(`select `+userColumns+` from users where username = ?`, username))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Error("database error", "err", err)
+		}
+		return nil
+	}
+	return u
+}
+
+func (s *Storage) GetUserByFeverKey(key string) *User {
+	if key == "" {
+		return nil
+	}
+	u, err := scanUser(s.db.QueryRow(`select `+userColumns+` from users where fever_key = ?`, key))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Error("database error", "err", err)
+		}
+		return nil
+	}
+	return u
+}
+
+func (s *Storage) ListUsers() []User {
+	result := make([]User, 0)
+	rows, err := s.db.Query(`select ` + userColumns + ` from users order by id`)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return result
+	}
+	defer rows.Close()
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			slog.Error("database error", "err", err)
+			return result
+		}
+		result = append(result, *u)
+	}
+	return result
+}
+
+// Returns the account of the server credentials, if set up so far.
+func (s *Storage) GetConfiguredUser() *User {
+	row := s.db.QueryRow(`select `+userColumns+` from users where is_configured`)
+	u, err := scanUser(row)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			slog.Error("database error", "err", err)
+		}
+		return nil
+	}
+	return u
+}
+
+// Marks the user as the account of the server credentials, the only one.
+func (s *Storage) UpdateUserConfigured(id int64) bool {
+	_, err := s.db.Exec(`update users set is_configured = (id = ?)`, id)
+	if err != nil {
+		slog.Error("database error", "err", err)
+	}
+	return err == nil
+}
+
+func (s *Storage) RenameUser(id int64, username string) bool {
+	_, err := s.db.Exec(`update users set username = ? where id = ?`, username, id)
+	if err != nil {
+		slog.Error("database error", "err", err)
+	}
+	return err == nil
+}
+
+func (s *Storage) UpdateUserPassword(id int64, password string) bool {
+	_, err := s.db.Exec(`update users set password = ? where id = ?`, password, id)
+	if err != nil {
+		slog.Error("database error", "err", err)
+	}
+	return err == nil
+}
+
+// An empty key turns off the Fever API for the user.
+func (s *Storage) UpdateUserFeverKey(id int64, key string) bool {
+	_, err := s.db.Exec(`update users set fever_key = ? where id = ?`, key, id)
+	if err != nil {
+		slog.Error("database error", "err", err)
+	}
+	return err == nil
+}
+
+func (s *Storage) UpdateUserAdmin(id int64, isAdmin bool) bool {
+	_, err := s.db.Exec(`update users set is_admin = ? where id = ?`, isAdmin, id)
+	if err != nil {
+		slog.Error("database error", "err", err)
+	}
+	return err == nil
+}
+
+// Disabled users can neither log in nor use the APIs.
+// Their data is kept and the feeds they follow are still refreshed.
+func (s *Storage) UpdateUserDisabled(id int64, disabled bool) bool {
+	_, err := s.db.Exec(`update users set disabled = ? where id = ?`, disabled, id)
+	if err != nil {
+		slog.Error("database error", "err", err)
+	}
+	return err == nil
+}
+
+func (s *Storage) UpdateUserTOTPPending(id int64, secret string) bool {
+	_, err := s.db.Exec(`update users set totp_pending = ? where id = ?`, secret, id)
+	if err != nil {
+		slog.Error("database error", "err", err)
+	}
+	return err == nil
+}
+
+// Turns the pending secret into the active one, replacing the recovery codes.
+func (s *Storage) EnableUserTOTP(id int64, recoveryCodes []string) bool {
+	return s.updateUserTOTP(id, `
+		update users
+		set totp_secret = totp_pending, totp_pending = '', totp_last_step = 0
+		where id = ?`,
+		recoveryCodes,
+	)
+}
+
+func (s *Storage) DisableUserTOTP(id int64) bool {
+	return s.updateUserTOTP(id, `
+		update users
+		set totp_secret = '', totp_pending = '', totp_last_step = 0
+		where id = ?`,
+		nil,
+	)
+}
+
+func (s *Storage) updateUserTOTP(id int64, query string, recoveryCodes []string) bool {
+	tx, err := s.db.Begin()
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return false
+	}
+	queries := []string{query, `delete from recovery_codes where user_id = ?`}
+	for _, query := range queries {
+		if _, err = tx.Exec(query, id); err != nil {
+			slog.Error("database error", "err", err)
+			tx.Rollback()
+			return false
+		}
+	}
+	for _, code := range recoveryCodes {
+		_, err = tx.Exec(`insert into recovery_codes (user_id, code) values (?, ?)`, id, code)
+		if err != nil {
+			slog.Error("database error", "err", err)
+			tx.Rollback()
+			return false
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		slog.Error("database error", "err", err)
+		return false
+	}
+	return true
+}
+
+// Records the time step of the code used to log in. Reports false
+// if the step (or a later one) was used already, to prevent replays.
+func (s *Storage) UseTOTPStep(id, step int64) bool {
+	result, err := s.db.Exec(`
+		update users set totp_last_step = ?
+		where id = ? and totp_last_step < ?`,
+		step, id, step,
+	)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return false
+	}
+	num, err := result.RowsAffected()
+	return err == nil && num > 0
+}
+
+// Reports whether the recovery code was valid. Each code works once.
+func (s *Storage) UseRecoveryCode(id int64, code string) bool {
+	result, err := s.db.Exec(`delete from recovery_codes where user_id = ? and code = ?`, id, code)
+	if err != nil {
+		slog.Error("database error", "err", err)
+		return false
+	}
+	num, err := result.RowsAffected()
+	return err == nil && num > 0
+}
+
+func (s *Storage) CountRecoveryCodes(id int64) int {
+	var count int
+	err := s.db.QueryRow(`select count(*) from recovery_codes where user_id = ?`, id).Scan(&count)
+	if err != nil {
+		slog.Error("database error", "err", err)
+	}
+	return count
+}
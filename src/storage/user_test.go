@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUsers(t *testing.T) {
+	db := testDB()
+
+	if owner := db.GetUser(DefaultUserId); owner == nil || !owner.IsAdmin || owner.Password != "" {
+		t.Fatalf("invalid default user: %#v", owner)
+	}
+	user := db.CreateUser("alice", "hash", false)
+	if user == nil || user.Id == DefaultUserId || user.IsAdmin {
+		t.Fatalf("invalid user: %#v", user)
+	}
+	if db.CreateUser("alice", "other", true) != nil {
+		t.Error("expected username to be unique")
+	}
+	db.UpdateUserFeverKey(user.Id, "key")
+	db.UpdateUserDisabled(user.Id, true)
+	if have := db.GetUserByFeverKey("key"); have == nil || have.Id != user.Id || !have.Disabled {
+		t.Errorf("invalid user by fever key: %#v", have)
+	}
+	if db.GetUserByFeverKey("") != nil {
+		t.Error("expected no user for an empty fever key")
+	}
+	if have := db.GetUserByName("alice"); have == nil || have.Password != "hash" {
+		t.Errorf("invalid user by name: %#v", have)
+	}
+	if have := len(db.ListUsers()); have != 2 {
+		t.Errorf("expected 2 users, got %d", have)
+	}
+}
+
+func TestSharedFeeds(t *testing.T) {
+	db1 := testDB()
+	user := db1.CreateUser("alice", "", false)
+	db2 := db1.ForUser(user.Id)
+
+	folder := db2.CreateFolder("news", nil)
+	feed1 := db1.CreateFeed("feed", "", "", "http://example.com/feed.xml", nil)
+	feed2 := db2.CreateFeed("feed", "", "", "http://example.com/feed.xml", &folder.Id)
+	if feed1.Id != feed2.Id {
+		t.Fatalf("expected the feed to be shared, got %d and %d", feed1.Id, feed2.Id)
+	}
+	db2.RenameFeed(feed2.Id, "renamed")
+	if have := db1.GetFeed(feed1.Id); have.Title != "feed" || have.FolderId != nil {
+		t.Errorf("expected the subscription of the other user intact, got %#v", have)
+	}
+	if len(db1.ListFolders()) != 0 || db1.GetFolder(folder.Id) != nil {
+		t.Error("expected folders to be private")
+	}
+
+	db1.CreateItems([]Item{{GUID: "1", FeedId: feed1.Id}, {GUID: "2", FeedId: feed1.Id}})
+	item := getItem(db1, "1")
+	db1.UpdateItemStatus(item.Id, STARRED)
+	db2.MarkItemsRead(MarkFilter{FolderID: &folder.Id})
+	if have := db1.GetItem(item.Id).Status; have != STARRED {
+		t.Errorf("expected starred, got %v", have)
+	}
+	if have := db2.GetItem(item.Id).Status; have != READ {
+		t.Errorf("expected read, got %v", have)
+	}
+	unread := UNREAD
+	if have := db1.CountItems(ItemFilter{Status: &unread}); have != 1 {
+		t.Errorf("expected 1 unread item, got %d", have)
+	}
+
+	label := db1.CreateLabel("later")
+	db2.SetItemLabels(item.Id, []int64{label.Id})
+	if have := db2.ListItemLabels(item.Id); len(have) != 0 {
+		t.Errorf("expected labels of other users to be ignored, got %#v", have)
+	}
+	db1.UpdateItemNote(item.Id, "quokka")
+	search := "quokka"
+	if have := db2.ListItems(ItemFilter{Search: &search}, 10, false, false); len(have) != 0 {
+		t.Errorf("expected notes of other users to be ignored, got %#v", have)
+	}
+
+	db1.UpdateSettings(map[string]interface{}{"theme_name": "night", "refresh_rate": 30})
+	if have := db2.GetSettingsValue("theme_name"); have != "light" {
+		t.Errorf("expected own theme, got %v", have)
+	}
+	if have := db2.GetSettingsValueInt64("refresh_rate"); have != 30 {
+		t.Errorf("expected global refresh rate, got %v", have)
+	}
+
+	if db2.UpdateFeedLink(feed2.Id, "http://example.com/other.xml") {
+		t.Error("expected the link of a shared feed to stay")
+	}
+	if !db2.DeleteFeed(feed2.Id) || db2.GetFeed(feed2.Id) != nil {
+		t.Fatal("expected the user to unsubscribe")
+	}
+	if have := db1.ListAllFeeds(); len(have) != 1 || db1.GetFeed(feed1.Id) == nil {
+		t.Errorf("expected the feed to be kept for the other user, got %#v", have)
+	}
+	db1.DeleteFeed(feed1.Id)
+	if have := db1.ListAllFeeds(); !reflect.DeepEqual(have, []Feed{}) {
+		t.Errorf("expected the feed to be deleted, got %#v", have)
+	}
+}
+
+func TestStaleAPITokens(t *testing.T) {
+	db := testDB()
+	db.CreateAPIToken(DefaultUserId, "Google Reader (Phone)", "phone", "write")
+	db.CreateAPIToken(DefaultUserId, "Google Reader (Desktop)", "desktop", "write")
+	db.CreateAPIToken(DefaultUserId, "Script", "script", "write")
+	db.db.Exec(`update api_tokens set date_created = ?`, time.Now().UTC().AddDate(0, 0, -40))
+	db.TouchAPIToken(db.GetAPIToken("desktop").Id)
+
+	db.DeleteStaleAPITokens(DefaultUserId, "Google Reader", time.Now().AddDate(0, 0, -30))
+	var names []string
+	for _, token := range db.ListAPITokens(DefaultUserId) {
+		names = append(names, token.Name)
+	}
+	if want := []string{"Google Reader (Desktop)", "Script"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected %v to be left, got %v", want, names)
+	}
+}
@@ -1,6 +1,7 @@
 package worker
 
 import (
+	"context"
 	"net"
 	"net/http"
 	"time"
@@ -12,11 +13,11 @@ type Client struct {
 }
 
 func (c *Client) get(url string) (*http.Response, error) {
-	return c.getConditional(url, "", "")
+	return c.getConditional(context.Background(), url, "", "")
 }
 
-func (c *Client) getConditional(url, lastModified, etag string) (*http.Response, error) {
-	req, err := http.NewRequest("GET", url, nil)
+func (c *Client) getConditional(ctx context.Context, url, lastModified, etag string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
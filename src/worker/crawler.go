@@ -2,6 +2,7 @@ package worker
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -9,6 +10,7 @@ import (
 	"mime"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/thang-qt/Readn/src/content/scraper"
@@ -151,6 +153,7 @@ func ConvertItems(items []parser.Item, feed storage.Feed) []storage.Item {
 			GUID:       item.GUID,
 			FeedId:     feed.Id,
 			Title:      item.Title,
+			Author:     item.Author,
 			Link:       item.URL,
 			Content:    item.Content,
 			Date:       item.Date,
@@ -161,7 +164,7 @@ func ConvertItems(items []parser.Item, feed storage.Feed) []storage.Item {
 	return result
 }
 
-func listItems(f storage.Feed, db *storage.Storage) ([]storage.Item, error) {
+func listItems(ctx context.Context, f storage.Feed, db *storage.Storage) ([]storage.Item, error) {
 	lmod := ""
 	etag := ""
 	if state := db.GetHTTPState(f.Id); state != nil {
@@ -169,11 +172,13 @@ func listItems(f storage.Feed, db *storage.Storage) ([]storage.Item, error) {
 		etag = state.Etag
 	}
 
-	res, err := client.getConditional(f.FeedLink, lmod, etag)
+	res, err := client.getConditional(ctx, f.FeedLink, lmod, etag)
 	if err != nil {
+		fetchesTotal.Inc("error")
 		return nil, err
 	}
 	defer res.Body.Close()
+	fetchesTotal.Inc(strconv.Itoa(res.StatusCode))
 
 	switch {
 	case res.StatusCode < 200 || res.StatusCode > 399:
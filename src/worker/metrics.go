@@ -0,0 +1,27 @@
+package worker
+
+import (
+	"github.com/thang-qt/Readn/src/metrics"
+)
+
+var (
+	refreshDuration = metrics.NewHistogram(
+		"readn_refresh_duration_seconds",
+		"Time taken to refresh all the feeds.",
+		[]float64{1, 5, 10, 30, 60, 120, 300, 600},
+	)
+	fetchDuration = metrics.NewHistogram(
+		"readn_feed_fetch_duration_seconds",
+		"Time taken to fetch & parse a single feed.",
+		metrics.DefBuckets,
+	)
+	fetchesTotal = metrics.NewCounter(
+		"readn_feed_fetches_total",
+		"Feed fetches by HTTP status code (`error` if the request failed).",
+		"status",
+	)
+	itemsIngested = metrics.NewCounter(
+		"readn_items_ingested_total",
+		"New items stored during feed refreshes.",
+	)
+)
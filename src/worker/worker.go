@@ -1,7 +1,8 @@
 package worker
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -14,43 +15,141 @@ const NUM_WORKERS = 4
 type Worker struct {
 	db      *storage.Storage
 	pending *int32
-	refresh *time.Ticker
 	reflock sync.Mutex
-	stopper chan bool
+
+	// auto-refresh, changed by the settings & the config reloads
+	ratelock sync.Mutex
+	refresh  *time.Ticker
+	stopper  chan bool
+
+	// cancelled on Stop
+	ctx    context.Context
+	cancel context.CancelFunc
+	// feed refresh in progress
+	running sync.WaitGroup
+	// scheduled jobs & other background tasks
+	tasks    sync.WaitGroup
+	stopping bool
+	// end of the last refresh which wasn't cancelled
+	lastRefresh time.Time
 }
 
 func NewWorker(db *storage.Storage) *Worker {
 	pending := int32(0)
-	return &Worker{db: db, pending: &pending}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Worker{db: db, pending: &pending, ctx: ctx, cancel: cancel}
 }
 
 func (w *Worker) FeedsPending() int32 {
 	return *w.pending
 }
 
-func (w *Worker) StartFeedCleaner() {
-	go w.db.DeleteOldItems()
-	ticker := time.NewTicker(time.Hour * 24)
+// Returns `stopped`, `refreshing` or `idle`.
+func (w *Worker) State() string {
+	w.reflock.Lock()
+	defer w.reflock.Unlock()
+	switch {
+	case w.stopping:
+		return "stopped"
+	case atomic.LoadInt32(w.pending) > 0:
+		return "refreshing"
+	}
+	return "idle"
+}
+
+// Returns the time the last complete feed refresh finished (zero if none).
+func (w *Worker) LastRefresh() time.Time {
+	w.reflock.Lock()
+	defer w.reflock.Unlock()
+	return w.lastRefresh
+}
+
+// Runs the task in the background, unless the worker is stopped.
+// Stop waits for the task to finish.
+func (w *Worker) background(task func()) {
+	w.reflock.Lock()
+	defer w.reflock.Unlock()
+	if w.stopping {
+		return
+	}
+	w.tasks.Add(1)
 	go func() {
+		defer w.tasks.Done()
+		task()
+	}()
+}
+
+// Runs the job periodically until the worker is stopped.
+func (w *Worker) schedule(interval time.Duration, job func()) {
+	w.background(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
 		for {
-			<-ticker.C
-			w.db.DeleteOldItems()
+			select {
+			case <-ticker.C:
+				job()
+			case <-w.ctx.Done():
+				return
+			}
 		}
+	})
+}
+
+func (w *Worker) StartFeedCleaner() {
+	w.background(w.db.DeleteOldItems)
+	w.schedule(time.Hour*24, w.db.DeleteOldItems)
+}
+
+func (w *Worker) StartBackups(dir string, interval time.Duration, keep int) {
+	w.schedule(interval, func() {
+		if path, err := w.db.BackupToDir(dir, keep); err != nil {
+			slog.Error("failed to backup database", "dir", dir, "err", err)
+		} else {
+			slog.Info("database backup", "path", path)
+		}
+	})
+}
+
+// Stops the scheduled jobs and waits for the feed refresh in progress
+// and the background tasks. Once the context is done, the remaining
+// feed fetches get cancelled.
+func (w *Worker) Stop(ctx context.Context) {
+	w.reflock.Lock()
+	w.stopping = true
+	w.reflock.Unlock()
+
+	w.SetRefreshRate(0)
+
+	done := make(chan struct{})
+	go func() {
+		w.running.Wait()
+		close(done)
 	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		slog.Warn("cancelling feed refresh")
+	}
+	w.cancel()
+	<-done
+	w.tasks.Wait()
 }
 
 func (w *Worker) FindFavicons() {
-	go func() {
+	w.background(func() {
 		for _, feed := range w.db.ListFeedsMissingIcons() {
+			if w.ctx.Err() != nil {
+				return
+			}
 			w.FindFeedFavicon(feed)
 		}
-	}()
+	})
 }
 
 func (w *Worker) FindFeedFavicon(feed storage.Feed) {
 	icon, err := findFavicon(feed.Link, feed.FeedLink)
 	if err != nil {
-		log.Printf("Failed to find favicon for %s (%s): %s", feed.FeedLink, feed.Link, err)
+		slog.Debug("failed to find favicon", "feed_id", feed.Id, "feed_url", feed.FeedLink, "site_url", feed.Link, "err", err)
 	}
 	if icon != nil {
 		w.db.UpdateFeedIcon(feed.Id, icon)
@@ -58,6 +157,9 @@ func (w *Worker) FindFeedFavicon(feed storage.Feed) {
 }
 
 func (w *Worker) SetRefreshRate(minute int64) {
+	w.ratelock.Lock()
+	defer w.ratelock.Unlock()
+
 	if w.stopper != nil {
 		w.refresh.Stop()
 		w.refresh = nil
@@ -65,7 +167,10 @@ func (w *Worker) SetRefreshRate(minute int64) {
 		w.stopper = nil
 	}
 
-	if minute == 0 {
+	w.reflock.Lock()
+	stopping := w.stopping
+	w.reflock.Unlock()
+	if minute == 0 || stopping {
 		return
 	}
 
@@ -73,41 +178,82 @@ func (w *Worker) SetRefreshRate(minute int64) {
 	w.refresh = time.NewTicker(time.Minute * time.Duration(minute))
 
 	go func(fire <-chan time.Time, stop <-chan bool, m int64) {
-		log.Printf("auto-refresh %dm: starting", m)
+		slog.Info("auto-refresh starting", "minutes", m)
 		for {
 			select {
 			case <-fire:
-				log.Printf("auto-refresh %dm: firing", m)
+				slog.Debug("auto-refresh firing", "minutes", m)
 				w.RefreshFeeds()
 			case <-stop:
-				log.Printf("auto-refresh %dm: stopping", m)
+				slog.Info("auto-refresh stopping", "minutes", m)
 				return
 			}
 		}
 	}(w.refresh.C, w.stopper, minute)
 }
 
+// Subscribes the user to the discovered feed
+// and stores the feed together with its current items.
+func (w *Worker) CreateFeed(userId int64, result *DiscoverResult, folderId *int64) *storage.Feed {
+	feed := w.db.ForUser(userId).CreateFeed(result.Feed.Title, "", result.Feed.SiteURL, result.FeedLink, folderId)
+	if feed == nil {
+		return nil
+	}
+	items := ConvertItems(result.Feed.Items, *feed)
+	if len(items) > 0 {
+		w.db.CreateItems(items)
+		w.db.SetFeedSize(feed.Id, len(items))
+		w.db.SyncSearch()
+	}
+	w.FindFeedFavicon(*feed)
+	return feed
+}
+
 func (w *Worker) RefreshFeeds() {
+	if feeds := w.startRefresh(); feeds != nil {
+		go w.refresher(feeds)
+	}
+}
+
+// Same as RefreshFeeds, but returns once all the feeds are refreshed.
+func (w *Worker) RefreshFeedsAndWait() {
+	if feeds := w.startRefresh(); feeds != nil {
+		w.refresher(feeds)
+	}
+}
+
+func (w *Worker) startRefresh() []storage.Feed {
 	w.reflock.Lock()
 	defer w.reflock.Unlock()
 
+	if w.stopping {
+		return nil
+	}
 	if *w.pending > 0 {
-		log.Print("Refreshing already in progress")
-		return
+		slog.Info("refreshing already in progress")
+		return nil
 	}
 
-	feeds := w.db.ListFeeds()
+	feeds := make([]storage.Feed, 0)
+	for _, feed := range w.db.ListAllFeeds() {
+		if !feed.IsSaved() {
+			feeds = append(feeds, feed)
+		}
+	}
 	if len(feeds) == 0 {
-		log.Print("Nothing to refresh")
-		return
+		slog.Info("nothing to refresh")
+		return nil
 	}
 
-	log.Print("Refreshing feeds")
+	slog.Info("refreshing feeds", "count", len(feeds))
 	atomic.StoreInt32(w.pending, int32(len(feeds)))
-	go w.refresher(feeds)
+	w.running.Add(1)
+	return feeds
 }
 
 func (w *Worker) refresher(feeds []storage.Feed) {
+	defer w.running.Done()
+	start := time.Now()
 	w.db.ResetFeedErrors()
 
 	srcqueue := make(chan storage.Feed, len(feeds))
@@ -123,7 +269,8 @@ func (w *Worker) refresher(feeds []storage.Feed) {
 	for i := 0; i < len(feeds); i++ {
 		items := <-dstqueue
 		if len(items) > 0 {
-			w.db.CreateItems(items)
+			created, _ := w.db.CreateNewItems(items)
+			itemsIngested.Add(float64(created))
 			w.db.SetFeedSize(items[0].FeedId, len(items))
 		}
 		atomic.AddInt32(w.pending, -1)
@@ -132,14 +279,29 @@ func (w *Worker) refresher(feeds []storage.Feed) {
 	close(srcqueue)
 	close(dstqueue)
 
-	log.Printf("Finished refreshing %d feeds", len(feeds))
+	refreshDuration.Observe(time.Since(start).Seconds())
+	if w.ctx.Err() == nil {
+		w.reflock.Lock()
+		w.lastRefresh = time.Now()
+		w.reflock.Unlock()
+	}
+	slog.Info("finished refreshing feeds", "count", len(feeds), "duration", time.Since(start))
 }
 
 func (w *Worker) worker(srcqueue <-chan storage.Feed, dstqueue chan<- []storage.Item) {
 	for feed := range srcqueue {
-		items, err := listItems(feed, w.db)
-		if err != nil {
+		if w.ctx.Err() != nil {
+			dstqueue <- nil
+			continue
+		}
+		start := time.Now()
+		items, err := listItems(w.ctx, feed, w.db)
+		fetchDuration.Observe(time.Since(start).Seconds())
+		if err != nil && w.ctx.Err() == nil {
+			slog.Warn("failed to refresh feed", "feed_id", feed.Id, "feed_url", feed.FeedLink, "err", err)
 			w.db.SetFeedError(feed.Id, err)
+		} else {
+			slog.Debug("refreshed feed", "feed_id", feed.Id, "feed_url", feed.FeedLink, "items", len(items), "duration", time.Since(start))
 		}
 		dstqueue <- items
 	}